@@ -25,8 +25,10 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/failover"
 	"github.com/scality/cosi-driver/pkg/grpcfactory"
 	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
@@ -47,6 +49,11 @@ const (
 	defaultOtelStdout      = false
 	defaultOtelEndpoint    = ""
 	defaultOtelServiceName = "cosi.scality.com"
+	defaultProbeInterval   = failover.DefaultProbeInterval
+	defaultKeyRotation     = driver.DefaultKeyRotationCheckInterval
+	defaultSessionRefresh  = driver.DefaultSessionRefreshCheckInterval
+	defaultInventory       = driver.DefaultInventoryCheckInterval
+	defaultDrainTimeout    = grpcfactory.DefaultDrainTimeout
 )
 
 var (
@@ -58,6 +65,22 @@ var (
 	driverOtelEndpoint    = flag.String("driver-otel-endpoint", defaultOtelEndpoint, "OpenTelemetry endpoint to export traces, default: \"\"")
 	driverOtelStdout      = flag.Bool("driver-otel-stdout", defaultOtelStdout, "Enable OpenTelemetry trace export to stdout, disables endpoint if enabled, default: false")
 	driverOtelServiceName = flag.String("driver-otel-service-name", defaultOtelServiceName, "Service name for OpenTelemetry traces, default: cosi.scality.com")
+	driverProbeInterval   = flag.Duration("driver-endpoint-probe-interval", defaultProbeInterval, "Interval between health checks of object storage endpoints configured for failover, default: 30s")
+	driverKeyRotation     = flag.Duration("driver-key-rotation-check-interval", defaultKeyRotation, "Interval between checks of BucketAccesses for access keys due for rotation, 0 disables rotation, default: 1h")
+	driverSessionRefresh  = flag.Duration("driver-session-refresh-check-interval", defaultSessionRefresh, "Interval between checks of BucketAccesses for session credentials due for renewal, 0 disables renewal, default: 1m")
+	driverInventory       = flag.Duration("driver-inventory-check-interval", defaultInventory, "Interval between counts of the buckets and bucket accesses managed by the driver, 0 disables counting, default: 1m")
+	driverTLSCertFile     = flag.String("driver-tls-cert-file", "", "Certificate file of the gRPC server, required for tcp:// and dns:// driver addresses, default: \"\"")
+	driverTLSKeyFile      = flag.String("driver-tls-key-file", "", "Private key file of the gRPC server, required for tcp:// and dns:// driver addresses, default: \"\"")
+	driverReadyzEndpoints = flag.Bool("driver-readyz-check-endpoints", false, "Include the health of the object storage endpoints configured for failover in /readyz, default: false")
+	driverTLSClientCAFile = flag.String("driver-tls-client-ca-file", "", "CA file used to verify client certificates, which are required when it is set, default: \"\"")
+	driverDrainTimeout    = flag.Duration("driver-drain-timeout", defaultDrainTimeout, "Time to wait on shutdown for operations in progress before interrupting them, default: 30s")
+
+	driverMaxOperations        = flag.Int("driver-max-concurrent-operations", 0, "Maximum number of bucket and bucket access operations processed at the same time, 0 disables the limit, default: 0")
+	driverMaxQueuedOperations  = flag.Int("driver-max-queued-operations", 0, "Maximum number of operations waiting for a slot before new ones fail with ResourceExhausted, 0 disables the limit, default: 0")
+	driverBackendMaxRequests   = flag.Int("driver-backend-max-concurrent-requests", 0, "Maximum number of requests sent at the same time to each backend endpoint, 0 disables the limit, default: 0")
+	driverBackendMaxQueued     = flag.Int("driver-backend-max-queued-requests", 0, "Maximum number of requests waiting for each backend endpoint before new ones fail with ResourceExhausted, 0 disables the limit, default: 0")
+	driverBackendRequestsRate  = flag.Float64("driver-backend-requests-per-second", 0, "Rate of requests sent to each backend endpoint, 0 disables the limit, default: 0")
+	driverBackendRequestsBurst = flag.Int("driver-backend-requests-burst", 10, "Number of requests sent to each backend endpoint in a burst above --driver-backend-requests-per-second, default: 10")
 )
 
 func init() {
@@ -84,6 +107,20 @@ func init() {
 		"driverOtelEndpoint", *driverOtelEndpoint,
 		"driverOtelStdout", *driverOtelStdout,
 		"driverOtelServiceName", *driverOtelServiceName,
+		"driverProbeInterval", *driverProbeInterval,
+		"driverKeyRotation", *driverKeyRotation,
+		"driverSessionRefresh", *driverSessionRefresh,
+		"driverInventory", *driverInventory,
+		"driverTLSCertFile", *driverTLSCertFile,
+		"driverTLSClientCAFile", *driverTLSClientCAFile,
+		"driverReadyzEndpoints", *driverReadyzEndpoints,
+		"driverDrainTimeout", *driverDrainTimeout,
+		"driverMaxOperations", *driverMaxOperations,
+		"driverMaxQueuedOperations", *driverMaxQueuedOperations,
+		"driverBackendMaxRequests", *driverBackendMaxRequests,
+		"driverBackendMaxQueued", *driverBackendMaxQueued,
+		"driverBackendRequestsRate", *driverBackendRequestsRate,
+		"driverBackendRequestsBurst", *driverBackendRequestsBurst,
 	)
 }
 
@@ -133,7 +170,10 @@ func run(ctx context.Context) error {
 	registry := prometheus.NewRegistry()
 	metrics.InitializeMetrics(defaultMetricsPrefix, registry)
 
-	metricsServer, err := metrics.StartMetricsServerWithRegistry(*driverMetricsAddress, registry, *driverMetricsPath)
+	// Serve metrics along with /healthz and /readyz during startup, with /readyz failing until the
+	// driver is built and its readiness checks are set
+	var readiness metrics.DeferredChecks
+	metricsServer, err := metrics.StartMetricsServerWithRegistry(*driverMetricsAddress, registry, *driverMetricsPath, readiness.Check)
 	if err != nil {
 		return fmt.Errorf("failed to start metrics server: %w", err)
 	}
@@ -159,16 +199,64 @@ func run(ctx context.Context) error {
 		}()
 	}
 
+	// Probe failover endpoints for as long as the driver runs
+	failover.Pools = failover.NewRegistry(ctx, *driverProbeInterval, failover.DefaultPoolIdleTimeout)
+	defer failover.Pools.Stop()
+
+	// Bound the operations in progress and the requests sent to each backend endpoint
+	ratelimit.Limiters = ratelimit.NewRegistry(
+		ratelimit.Config{
+			MaxConcurrent: *driverMaxOperations,
+			MaxQueued:     *driverMaxQueuedOperations,
+		},
+		ratelimit.Config{
+			MaxConcurrent:     *driverBackendMaxRequests,
+			MaxQueued:         *driverBackendMaxQueued,
+			RequestsPerSecond: *driverBackendRequestsRate,
+			Burst:             *driverBackendRequestsBurst,
+		},
+	)
+
+	driver.KeyRotationCheckInterval = *driverKeyRotation
+	driver.SessionRefreshCheckInterval = *driverSessionRefresh
+	driver.InventoryCheckInterval = *driverInventory
+
 	driverName := *driverPrefix + "." + provisionerName
 	identityServer, bucketProvisioner, err := driver.CreateDriver(ctx, driverName)
 	if err != nil {
 		return fmt.Errorf("failed to initialize Scality driver: %w", err)
 	}
 
-	server, err := grpcfactory.NewDefaultCOSIProvisionerServer(*driverAddress, identityServer, bucketProvisioner)
+	var tlsConfig *grpcfactory.TLSConfig
+	if *driverTLSCertFile != "" || *driverTLSKeyFile != "" {
+		tlsConfig = &grpcfactory.TLSConfig{
+			CertFile: *driverTLSCertFile,
+			KeyFile:  *driverTLSKeyFile,
+			CAFile:   *driverTLSClientCAFile,
+		}
+	} else if *driverTLSClientCAFile != "" {
+		return fmt.Errorf("--driver-tls-client-ca-file requires --driver-tls-cert-file and --driver-tls-key-file")
+	}
+
+	server, err := grpcfactory.NewDefaultCOSIProvisionerServer(*driverAddress, identityServer, bucketProvisioner, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to start the provisioner server: %w", err)
 	}
+	server.SetDrainTimeout(*driverDrainTimeout)
+
+	// Report the driver services in the gRPC health service once the API server is reachable
+	go driver.WatchReadiness(ctx, bucketProvisioner, driver.DefaultReadinessCheckInterval, server.SetReady)
+
+	// Report the driver ready once /readyz checks the API server, the gRPC listener and, when enabled,
+	// the object storage endpoints configured for failover
+	checks := []metrics.ReadinessCheck{metrics.Check("grpc-listener", server.CheckListening)}
+	if provisioner, ok := bucketProvisioner.(*driver.ProvisionerServer); ok {
+		checks = append(checks, metrics.Check("apiserver", provisioner.CheckAPIServer))
+	}
+	if *driverReadyzEndpoints {
+		checks = append(checks, failover.Pools.ReadinessCheck)
+	}
+	readiness.Set(checks...)
 
 	return server.Run(ctx, registry)
 }
@@ -23,9 +23,13 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/scality/cosi-driver/pkg/driver"
 	"k8s.io/klog/v2"
 )
 
+// shutdownGracePeriod is the time left after the drain timeout to stop the servers and flush traces.
+const shutdownGracePeriod = 10 * time.Second
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -40,12 +44,15 @@ func main() {
 
 		klog.InfoS("Graceful shutdown initiated; repeat signal to force immediate shutdown")
 
+		// Operations in progress are drained first, interrupted ones are given time to return,
+		// then the servers and exporters are shut down
+		timeout := *driverDrainTimeout + driver.DrainCancelGracePeriod + shutdownGracePeriod
 		select {
 		case sig = <-sigs:
 			klog.ErrorS(nil, "Second signal received—forcing shutdown", "type", sig)
 			os.Exit(1)
-		case <-time.After(30 * time.Second):
-			klog.ErrorS(nil, "Forcing shutdown due to timeout", "timeout", 30*time.Second)
+		case <-time.After(timeout):
+			klog.ErrorS(nil, "Forcing shutdown due to timeout", "timeout", timeout)
 			os.Exit(1)
 		}
 	}()
@@ -9,3 +9,18 @@
 {{- define "scality-cosi-driver.name" -}}
 {{- .Chart.Name -}}
 {{- end -}}
+
+{{- define "scality-cosi-driver.probeArgs" -}}
+- -addr={{ .Values.probes.address | default .Values.grpc.address }}
+{{- if .Values.grpc.tls.secretName }}
+- -tls
+- -tls-ca-cert=/etc/cosi/tls/ca.crt
+{{- if .Values.probes.tls.serverName }}
+- -tls-server-name={{ .Values.probes.tls.serverName }}
+{{- end }}
+{{- if .Values.grpc.tls.verifyClients }}
+- -tls-client-cert=/etc/cosi/tls/tls.crt
+- -tls-client-key=/etc/cosi/tls/tls.key
+{{- end }}
+{{- end }}
+{{- end -}}
@@ -0,0 +1,379 @@
+package iamclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"k8s.io/klog/v2"
+)
+
+const (
+	PolicyModeInline  = "inline"  // Inline policy of the user, named after the bucket or, for shared users, the BucketAccess
+	PolicyModeManaged = "managed" // Customer-managed policy per bucket and access mode, attached to the user
+	PolicyModeGroup   = "group"   // IAM group per bucket and access mode, the user is added to it
+
+	AccessModeReadWrite = "readwrite"
+	AccessModeReadOnly  = "readonly"
+
+	// ManagedResourcePath is the IAM path of the policies and groups created by the driver
+	ManagedResourcePath = "/cosi/"
+)
+
+// accessModes lists the access modes in the order their resources are checked on revoke
+var accessModes = []string{AccessModeReadWrite, AccessModeReadOnly}
+
+// BucketPolicy selects how users are granted access to a bucket. The zero value grants read-write
+// access through an inline policy.
+type BucketPolicy struct {
+	Mode       string           // One of the PolicyMode constants, inline when empty
+	AccessMode string           // One of the AccessMode constants, read-write when empty
+	Conditions PolicyConditions // Restrictions of the requests, only supported by inline policies
+}
+
+func (p BucketPolicy) mode() string {
+	if p.Mode == "" {
+		return PolicyModeInline
+	}
+	return p.Mode
+}
+
+func (p BucketPolicy) accessMode() string {
+	if p.AccessMode == "" {
+		return AccessModeReadWrite
+	}
+	return p.AccessMode
+}
+
+// ManagedResourceName returns the name of the managed policy and of the group granting access to a bucket.
+func ManagedResourceName(bucketName, accessMode string) string {
+	return "cosi-" + bucketName + "-" + accessMode
+}
+
+// SharedPolicyName returns the name of the inline policy granting a shared user access to a bucket for one
+// BucketAccess, so that the BucketAccesses of a bucket sharing the user do not overwrite each other's policy.
+func SharedPolicyName(bucketName, accountName string) string {
+	return bucketName + "@" + accountName
+}
+
+// readOnlyActions are the S3 actions allowed in read-only access mode
+var readOnlyActions = []string{"s3:GetBucketLocation", "s3:ListBucket", "s3:ListBucketVersions", "s3:GetObject", "s3:GetObjectVersion"}
+
+// bucketPolicyDocument returns a policy granting the access mode on a specific bucket under the conditions.
+func bucketPolicyDocument(bucketName, accessMode string, conditions PolicyConditions) string {
+	actions := []string{"s3:*"}
+	if accessMode == AccessModeReadOnly {
+		actions = readOnlyActions
+	}
+	return PolicyDocument{
+		Version: policyVersion,
+		Statement: []Statement{{
+			Effect:    "Allow",
+			Action:    actions,
+			Resource:  []string{"arn:aws:s3:::" + bucketName, "arn:aws:s3:::" + bucketName + "/*"},
+			Condition: conditions.condition(),
+		}},
+	}.String()
+}
+
+// GrantBucketPolicy grants an existing IAM user access to a bucket according to the policy mode.
+// Managed policies and groups are created on first use and reused by the following grants. When the
+// grant fails, the managed policy or group it created is deleted unless another user uses it already.
+func (client *IAMClient) GrantBucketPolicy(ctx context.Context, userName, bucketName string, policy BucketPolicy) error {
+	return client.grantBucketPolicy(ctx, userName, bucketName, bucketName, policy)
+}
+
+// grantBucketPolicy grants access to a bucket, through an inline policy named policyName in inline mode.
+func (client *IAMClient) grantBucketPolicy(ctx context.Context, userName, bucketName, policyName string, policy BucketPolicy) error {
+	accessMode := policy.accessMode()
+	policyDocument := bucketPolicyDocument(bucketName, accessMode, policy.Conditions)
+	if policy.mode() != PolicyModeInline && !policy.Conditions.IsZero() {
+		// Managed policies and groups are shared by all users of the bucket and access mode
+		return fmt.Errorf("policy conditions are only supported by inline policies")
+	}
+
+	steps := newStepLog("GrantBucketPolicy", userName)
+	switch policy.mode() {
+	case PolicyModeManaged:
+		policyArn, err := client.ensureManagedPolicy(ctx, steps, ManagedResourceName(bucketName, accessMode), policyDocument)
+		if err != nil {
+			return err
+		}
+		_, err = client.IAMService.AttachUserPolicy(ctx, &iam.AttachUserPolicyInput{UserName: &userName, PolicyArn: &policyArn})
+		if err != nil {
+			steps.rollback(ctx, err)
+			return err
+		}
+		klog.V(c.LvlInfo).InfoS("Successfully attached managed policy", "userName", userName, "policyArn", policyArn)
+	case PolicyModeGroup:
+		groupName := ManagedResourceName(bucketName, accessMode)
+		if err := client.ensureGroup(ctx, steps, groupName, policyDocument); err != nil {
+			steps.rollback(ctx, err)
+			return err
+		}
+		_, err := client.IAMService.AddUserToGroup(ctx, &iam.AddUserToGroupInput{UserName: &userName, GroupName: &groupName})
+		if err != nil {
+			steps.rollback(ctx, err)
+			return err
+		}
+		klog.V(c.LvlInfo).InfoS("Successfully added user to group", "userName", userName, "groupName", groupName)
+	default:
+		_, err := client.IAMService.PutUserPolicy(ctx, &iam.PutUserPolicyInput{
+			UserName:       &userName,
+			PolicyName:     &policyName,
+			PolicyDocument: &policyDocument,
+		})
+		if err != nil {
+			return err
+		}
+		klog.V(c.LvlInfo).InfoS("Successfully attached inline policy", "userName", userName, "policyName", policyName)
+	}
+	return nil
+}
+
+// ensureManagedPolicy creates the managed policy, recording its creation in steps, or returns the
+// existing one. Existing policies are used by other users, so they are not rolled back.
+func (client *IAMClient) ensureManagedPolicy(ctx context.Context, steps *stepLog, policyName, policyDocument string) (string, error) {
+	output, err := client.IAMService.CreatePolicy(ctx, &iam.CreatePolicyInput{
+		PolicyName:     &policyName,
+		Path:           aws.String(ManagedResourcePath),
+		PolicyDocument: &policyDocument,
+		Description:    aws.String("Bucket access managed by the Scality COSI driver"),
+	})
+	if err == nil {
+		policyArn := aws.ToString(output.Policy.Arn)
+		klog.V(c.LvlInfo).InfoS("Successfully created managed policy", "policyName", policyName)
+		steps.done("CreateManagedPolicy", func(ctx context.Context) error {
+			return client.deleteUnusedManagedPolicy(ctx, policyArn)
+		})
+		return policyArn, nil
+	}
+	var alreadyExistsErr *types.EntityAlreadyExistsException
+	if !errors.As(err, &alreadyExistsErr) {
+		return "", err
+	}
+
+	policyArn, err := client.findManagedPolicy(ctx, policyName)
+	if err != nil {
+		return "", err
+	}
+	if policyArn == "" {
+		return "", fmt.Errorf("managed policy %s exists outside of path %s", policyName, ManagedResourcePath)
+	}
+	klog.V(c.LvlDebug).InfoS("Managed policy already exists, reusing it", "policyName", policyName)
+	return policyArn, nil
+}
+
+// findManagedPolicy returns the ARN of a policy created by the driver, or an empty string if there is none.
+func (client *IAMClient) findManagedPolicy(ctx context.Context, policyName string) (string, error) {
+	paginator := iam.NewListPoliciesPaginator(client.IAMService, &iam.ListPoliciesInput{
+		Scope:      types.PolicyScopeTypeLocal,
+		PathPrefix: aws.String(ManagedResourcePath),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", err
+		}
+		for _, policy := range output.Policies {
+			if aws.ToString(policy.PolicyName) == policyName {
+				return aws.ToString(policy.Arn), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// ensureGroup creates the group, recording its creation in steps, or reuses the existing one, and
+// sets its policy. Existing groups are used by other users, so they are not rolled back.
+func (client *IAMClient) ensureGroup(ctx context.Context, steps *stepLog, groupName, policyDocument string) error {
+	_, err := client.IAMService.CreateGroup(ctx, &iam.CreateGroupInput{GroupName: &groupName, Path: aws.String(ManagedResourcePath)})
+	var alreadyExistsErr *types.EntityAlreadyExistsException
+	switch {
+	case err == nil:
+		klog.V(c.LvlInfo).InfoS("Successfully created group", "groupName", groupName)
+		steps.done("CreateGroup", func(ctx context.Context) error {
+			return client.deleteUnusedGroup(ctx, groupName)
+		})
+	case errors.As(err, &alreadyExistsErr):
+		klog.V(c.LvlDebug).InfoS("Group already exists, reusing it", "groupName", groupName)
+	default:
+		return err
+	}
+
+	_, err = client.IAMService.PutGroupPolicy(ctx, &iam.PutGroupPolicyInput{
+		GroupName:      &groupName,
+		PolicyName:     &groupName,
+		PolicyDocument: &policyDocument,
+	})
+	return err
+}
+
+// revokeBucketPolicy removes the inline policy, managed policies and groups granting the user access to the bucket.
+func (client *IAMClient) revokeBucketPolicy(ctx context.Context, userName, bucketName string) error {
+	if err := client.DeleteInlinePolicy(ctx, userName, bucketName); err != nil {
+		return err
+	}
+	_, _, err := client.revokeManagedBucketPolicies(ctx, userName, bucketName)
+	return err
+}
+
+// revokeManagedBucketPolicies detaches the managed policies and leaves the groups granting the user access
+// to the bucket, and returns the ARNs of the detached policies and the names of the groups left.
+// Policies and groups no longer used by any user are deleted. A missing user has nothing to revoke.
+func (client *IAMClient) revokeManagedBucketPolicies(ctx context.Context, userName, bucketName string) ([]string, []string, error) {
+	var names []string
+	for _, accessMode := range accessModes {
+		names = append(names, ManagedResourceName(bucketName, accessMode))
+	}
+	return client.revokeManagedResources(ctx, userName, names)
+}
+
+// revokeManagedResources detaches the managed policies and leaves the groups with one of the names.
+func (client *IAMClient) revokeManagedResources(ctx context.Context, userName string, names []string) ([]string, []string, error) {
+	var detached, removed []string
+	attached, err := client.listAttachedPolicies(ctx, userName)
+	if err != nil && !isNoSuchEntity(err) {
+		return nil, nil, err
+	}
+	for _, policy := range attached {
+		if !slices.Contains(names, aws.ToString(policy.PolicyName)) {
+			continue
+		}
+		_, err := client.IAMService.DetachUserPolicy(ctx, &iam.DetachUserPolicyInput{UserName: &userName, PolicyArn: policy.PolicyArn})
+		if err != nil && !isNoSuchEntity(err) {
+			return detached, removed, err
+		}
+		if err == nil {
+			detached = append(detached, aws.ToString(policy.PolicyArn))
+			klog.V(c.LvlInfo).InfoS("Detached managed policy", "userName", userName, "policyArn", aws.ToString(policy.PolicyArn))
+		}
+		if err := client.deleteUnusedManagedPolicy(ctx, aws.ToString(policy.PolicyArn)); err != nil {
+			return detached, removed, err
+		}
+	}
+
+	groups, err := client.listGroups(ctx, userName)
+	if err != nil && !isNoSuchEntity(err) {
+		return detached, removed, err
+	}
+	for _, group := range groups {
+		if !slices.Contains(names, aws.ToString(group.GroupName)) {
+			continue
+		}
+		_, err := client.IAMService.RemoveUserFromGroup(ctx, &iam.RemoveUserFromGroupInput{UserName: &userName, GroupName: group.GroupName})
+		if err != nil && !isNoSuchEntity(err) {
+			return detached, removed, err
+		}
+		if err == nil {
+			removed = append(removed, aws.ToString(group.GroupName))
+			klog.V(c.LvlInfo).InfoS("Removed user from group", "userName", userName, "groupName", aws.ToString(group.GroupName))
+		}
+		if err := client.deleteUnusedGroup(ctx, aws.ToString(group.GroupName)); err != nil {
+			return detached, removed, err
+		}
+	}
+	return detached, removed, nil
+}
+
+func (client *IAMClient) deleteUnusedManagedPolicy(ctx context.Context, policyArn string) error {
+	output, err := client.IAMService.GetPolicy(ctx, &iam.GetPolicyInput{PolicyArn: &policyArn})
+	if err != nil {
+		if isNoSuchEntity(err) {
+			return nil
+		}
+		return err
+	}
+	if aws.ToInt32(output.Policy.AttachmentCount) > 0 {
+		return nil
+	}
+	_, err = client.IAMService.DeletePolicy(ctx, &iam.DeletePolicyInput{PolicyArn: &policyArn})
+	if err != nil && !isNoSuchEntity(err) {
+		return err
+	}
+	klog.V(c.LvlInfo).InfoS("Deleted unused managed policy", "policyArn", policyArn)
+	return nil
+}
+
+func (client *IAMClient) deleteUnusedGroup(ctx context.Context, groupName string) error {
+	output, err := client.IAMService.GetGroup(ctx, &iam.GetGroupInput{GroupName: &groupName, MaxItems: aws.Int32(1)})
+	if err != nil {
+		if isNoSuchEntity(err) {
+			return nil
+		}
+		return err
+	}
+	if len(output.Users) > 0 {
+		return nil
+	}
+	_, err = client.IAMService.DeleteGroupPolicy(ctx, &iam.DeleteGroupPolicyInput{GroupName: &groupName, PolicyName: &groupName})
+	if err != nil && !isNoSuchEntity(err) {
+		return err
+	}
+	_, err = client.IAMService.DeleteGroup(ctx, &iam.DeleteGroupInput{GroupName: &groupName})
+	if err != nil && !isNoSuchEntity(err) {
+		return err
+	}
+	klog.V(c.LvlInfo).InfoS("Deleted unused group", "groupName", groupName)
+	return nil
+}
+
+func (client *IAMClient) listAttachedPolicies(ctx context.Context, userName string) ([]types.AttachedPolicy, error) {
+	var policies []types.AttachedPolicy
+	paginator := iam.NewListAttachedUserPoliciesPaginator(client.IAMService, &iam.ListAttachedUserPoliciesInput{UserName: &userName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, output.AttachedPolicies...)
+	}
+	return policies, nil
+}
+
+func (client *IAMClient) listGroups(ctx context.Context, userName string) ([]types.Group, error) {
+	var groups []types.Group
+	paginator := iam.NewListGroupsForUserPaginator(client.IAMService, &iam.ListGroupsForUserInput{UserName: &userName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, output.Groups...)
+	}
+	return groups, nil
+}
+
+// remainingAccess returns the inline policies, attached policies and groups the user still has, which
+// happens when it is shared by BucketAccesses of other buckets. Attached policies are reported by ARN.
+func (client *IAMClient) remainingAccess(ctx context.Context, userName string) ([]string, error) {
+	remaining, err := client.ListInlinePolicies(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	attached, err := client.listAttachedPolicies(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, policy := range attached {
+		remaining = append(remaining, aws.ToString(policy.PolicyArn))
+	}
+	groups, err := client.listGroups(ctx, userName)
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		remaining = append(remaining, "group/"+aws.ToString(group.GroupName))
+	}
+	return remaining, nil
+}
+
+func isNoSuchEntity(err error) bool {
+	var noSuchEntityErr *types.NoSuchEntityException
+	return errors.As(err, &noSuchEntityErr)
+}
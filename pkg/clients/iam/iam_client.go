@@ -4,18 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/smithy-go/logging"
 	"github.com/aws/smithy-go/middleware"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
 	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/failover"
 	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
 	"github.com/scality/cosi-driver/pkg/util"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 	"k8s.io/klog/v2"
@@ -24,13 +28,35 @@ import (
 // postfix for inline policy which is created when COSI receives a BucketAccess (BA) request
 type IAMAPI interface {
 	CreateUser(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error)
+	PutUserPermissionsBoundary(ctx context.Context, input *iam.PutUserPermissionsBoundaryInput, opts ...func(*iam.Options)) (*iam.PutUserPermissionsBoundaryOutput, error)
 	PutUserPolicy(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error)
 	CreateAccessKey(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error)
 	GetUser(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error)
 	DeleteUserPolicy(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error)
+	ListUserPolicies(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error)
 	ListAccessKeys(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error)
 	DeleteAccessKey(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error)
 	DeleteUser(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error)
+	CreateRole(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error)
+	GetRole(ctx context.Context, input *iam.GetRoleInput, opts ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	PutRolePolicy(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error)
+	DeleteRolePolicy(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error)
+	DeleteRole(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error)
+	CreatePolicy(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error)
+	GetPolicy(ctx context.Context, input *iam.GetPolicyInput, opts ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	ListPolicies(ctx context.Context, input *iam.ListPoliciesInput, opts ...func(*iam.Options)) (*iam.ListPoliciesOutput, error)
+	DeletePolicy(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error)
+	AttachUserPolicy(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error)
+	DetachUserPolicy(ctx context.Context, input *iam.DetachUserPolicyInput, opts ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error)
+	ListAttachedUserPolicies(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error)
+	CreateGroup(ctx context.Context, input *iam.CreateGroupInput, opts ...func(*iam.Options)) (*iam.CreateGroupOutput, error)
+	GetGroup(ctx context.Context, input *iam.GetGroupInput, opts ...func(*iam.Options)) (*iam.GetGroupOutput, error)
+	DeleteGroup(ctx context.Context, input *iam.DeleteGroupInput, opts ...func(*iam.Options)) (*iam.DeleteGroupOutput, error)
+	PutGroupPolicy(ctx context.Context, input *iam.PutGroupPolicyInput, opts ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error)
+	DeleteGroupPolicy(ctx context.Context, input *iam.DeleteGroupPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteGroupPolicyOutput, error)
+	AddUserToGroup(ctx context.Context, input *iam.AddUserToGroupInput, opts ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error)
+	RemoveUserFromGroup(ctx context.Context, input *iam.RemoveUserFromGroupInput, opts ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error)
+	ListGroupsForUser(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error)
 }
 
 type IAMClient struct {
@@ -47,25 +73,33 @@ var InitIAMClient = func(ctx context.Context, params util.StorageClientParameter
 		logger = nil
 	}
 
-	httpClient := &http.Client{
-		Timeout: util.DefaultRequestTimeout,
+	httpClient := util.NewHTTPClient(params.IAMEndpoint, params)
+
+	limiter := ratelimit.Limiters.Backend(params.IAMEndpoint)
+	apiOptions := []func(*middleware.Stack) error{
+		func(stack *middleware.Stack) error {
+			return metrics.AttachPrometheusMiddleware(stack, metrics.IAMRequestDuration, metrics.IAMRequestsTotal)
+		},
+		func(stack *middleware.Stack) error {
+			return ratelimit.AttachRateLimitMiddleware(stack, limiter)
+		},
 	}
 
-	if strings.HasPrefix(params.IAMEndpoint, "https://") {
-		klog.V(c.LvlDebug).InfoS("Configuring TLS transport for IAM client", "IAMEndpoint", params.IAMEndpoint)
-		httpClient.Transport = util.ConfigureTLSTransport(params.TLSCert)
+	// With several endpoints, each attempt goes to a healthy endpoint and failures are reported back
+	if len(params.IAMEndpoints) > 1 {
+		pool := failover.Pools.Pool("IAM", params.IAMEndpoints, util.HTTPClientKey(params), httpClient)
+		apiOptions = append(apiOptions, func(stack *middleware.Stack) error {
+			return failover.AttachFailoverMiddleware(stack, pool)
+		})
 	}
 
 	awsCfg, err := LoadAWSConfig(ctx,
 		config.WithRegion(params.Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(params.AccessKeyID, params.SecretAccessKey, "")),
+		config.WithCredentialsProvider(stsclient.CredentialsProvider(params)),
 		config.WithHTTPClient(httpClient),
+		config.WithRetryer(util.NewRetryer(params)),
 		config.WithLogger(logger),
-		config.WithAPIOptions([]func(*middleware.Stack) error{
-			func(stack *middleware.Stack) error {
-				return metrics.AttachPrometheusMiddleware(stack, metrics.IAMRequestDuration, metrics.IAMRequestsTotal)
-			},
-		}),
+		config.WithAPIOptions(apiOptions),
 	)
 	if err != nil {
 		return nil, err
@@ -81,31 +115,45 @@ var InitIAMClient = func(ctx context.Context, params util.StorageClientParameter
 	}, nil
 }
 
+// UserOptions are the settings of the IAM users created by the driver.
+type UserOptions struct {
+	Path                string            // IAM path of the user, "/" when empty
+	Tags                map[string]string // Tags recording the origin of the user
+	PermissionsBoundary string            // ARN of the managed policy capping the permissions of the user
+}
+
 // CreateUser creates an IAM user with the specified name.
-func (client *IAMClient) CreateUser(ctx context.Context, userName string) error {
+func (client *IAMClient) CreateUser(ctx context.Context, userName string, options UserOptions) error {
 	input := &iam.CreateUserInput{
 		UserName: &userName,
 	}
+	if options.Path != "" {
+		input.Path = &options.Path
+	}
+	if options.PermissionsBoundary != "" {
+		input.PermissionsBoundary = &options.PermissionsBoundary
+	}
+	keys := make([]string, 0, len(options.Tags))
+	for key := range options.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		input.Tags = append(input.Tags, types.Tag{Key: aws.String(key), Value: aws.String(options.Tags[key])})
+	}
 
 	_, err := client.IAMService.CreateUser(ctx, input)
 	return err
 }
 
+// s3WildcardPolicyDocument returns a policy allowing all S3 actions on a specific bucket.
+func s3WildcardPolicyDocument(bucketName string) string {
+	return bucketPolicyDocument(bucketName, AccessModeReadWrite, PolicyConditions{})
+}
+
 // CreateS3WildcardInlinePolicy creates an inline policy to an IAM user for a specific bucket.
 func (client *IAMClient) CreateS3WildcardInlinePolicy(ctx context.Context, userName, bucketName string) error {
-	policyDocument := fmt.Sprintf(`{
-		"Version": "2012-10-17",
-		"Statement": [
-			{
-				"Effect": "Allow",
-				"Action": "s3:*",
-				"Resource": [
-					"arn:aws:s3:::%s",
-					"arn:aws:s3:::%s/*"
-				]
-			}
-		]
-	}`, bucketName, bucketName)
+	policyDocument := s3WildcardPolicyDocument(bucketName)
 
 	input := &iam.PutUserPolicyInput{
 		UserName:       &userName,
@@ -127,22 +175,57 @@ func (client *IAMClient) CreateAccessKey(ctx context.Context, userName string) (
 	return output, err
 }
 
+// ListAccessKeys lists the access keys of an IAM user.
+func (client *IAMClient) ListAccessKeys(ctx context.Context, userName string) ([]types.AccessKeyMetadata, error) {
+	output, err := client.IAMService.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: &userName})
+	if err != nil {
+		return nil, err
+	}
+	return output.AccessKeyMetadata, nil
+}
+
+// DeleteAccessKey deletes an access key of an IAM user. Keys that no longer exist are ignored.
+func (client *IAMClient) DeleteAccessKey(ctx context.Context, userName, accessKeyID string) error {
+	_, err := client.IAMService.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
+		UserName:    &userName,
+		AccessKeyId: &accessKeyID,
+	})
+	if err != nil {
+		var noSuchEntityErr *types.NoSuchEntityException
+		if errors.As(err, &noSuchEntityErr) {
+			klog.V(c.LvlTrace).InfoS("Access key does not exist, skipping deletion", "userName", userName, "accessKeyId", accessKeyID)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 // CreateBucketAccess is a helper that combines user creation, policy attachment, and access key generation.
-func (client *IAMClient) CreateBucketAccess(ctx context.Context, userName, bucketName string) (*iam.CreateAccessKeyOutput, error) {
-	err := client.CreateUser(ctx, userName)
+func (client *IAMClient) CreateBucketAccess(ctx context.Context, userName, bucketName string, policy BucketPolicy, options UserOptions) (*iam.CreateAccessKeyOutput, error) {
+	steps := newStepLog("CreateBucketAccess", userName)
+
+	err := client.CreateUser(ctx, userName, options)
 	if err != nil {
 		return nil, err
 	}
 	klog.V(c.LvlInfo).InfoS("Successfully created IAM user", "userName", userName)
+	steps.done("CreateUser", func(ctx context.Context) error {
+		return client.DeleteUser(ctx, userName)
+	})
 
-	err = client.CreateS3WildcardInlinePolicy(ctx, userName, bucketName)
+	err = client.GrantBucketPolicy(ctx, userName, bucketName, policy)
 	if err != nil {
+		steps.rollback(ctx, err)
 		return nil, err
 	}
-	klog.V(c.LvlInfo).InfoS("Successfully attached inline policy", "userName", userName, "policyName", bucketName)
+	steps.done("GrantBucketPolicy", func(ctx context.Context) error {
+		return client.revokeBucketPolicy(ctx, userName, bucketName)
+	})
 
 	accessKeyOutput, err := client.CreateAccessKey(ctx, userName)
 	if err != nil {
+		steps.rollback(ctx, err)
 		return nil, err
 	}
 	klog.V(c.LvlInfo).InfoS("Successfully created access key", "userName", userName)
@@ -150,90 +233,342 @@ func (client *IAMClient) CreateBucketAccess(ctx context.Context, userName, bucke
 	return accessKeyOutput, nil
 }
 
-// RevokeBucketAccess is a helper that revokes bucket access by orchestrating individual steps to delete the user, inline policy, and access keys.
-func (client *IAMClient) RevokeBucketAccess(ctx context.Context, userName, bucketName string) error {
-	err := client.EnsureUserExists(ctx, userName)
-	if err != nil {
+// CreateSharedBucketAccess grants an IAM user shared by several BucketAccesses access to a bucket.
+// The user is created if needed and gets one inline policy per bucket and BucketAccess account, see
+// SharedPolicyName; access keys are managed by the caller. The permissions boundary of the options is
+// applied to existing users, their path and tags are kept.
+func (client *IAMClient) CreateSharedBucketAccess(ctx context.Context, userName, bucketName, accountName string, policy BucketPolicy, options UserOptions) error {
+	steps := newStepLog("CreateSharedBucketAccess", userName)
+
+	err := client.CreateUser(ctx, userName, options)
+	var alreadyExistsErr *types.EntityAlreadyExistsException
+	switch {
+	case err == nil:
+		klog.V(c.LvlInfo).InfoS("Successfully created shared IAM user", "userName", userName)
+		steps.done("CreateUser", func(ctx context.Context) error {
+			return client.DeleteUser(ctx, userName)
+		})
+	case errors.As(err, &alreadyExistsErr):
+		klog.V(c.LvlDebug).InfoS("Shared IAM user already exists", "userName", userName)
+		// The boundary of the BucketAccessClass also caps the buckets granted through other classes
+		if options.PermissionsBoundary != "" {
+			_, err = client.IAMService.PutUserPermissionsBoundary(ctx, &iam.PutUserPermissionsBoundaryInput{
+				UserName:            &userName,
+				PermissionsBoundary: &options.PermissionsBoundary,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	default:
 		return err
 	}
-	klog.V(c.LvlInfo).InfoS("Verified IAM user exists", "userName", userName)
 
-	err = client.DeleteInlinePolicy(ctx, userName, bucketName)
+	if err := client.grantBucketPolicy(ctx, userName, bucketName, SharedPolicyName(bucketName, accountName), policy); err != nil {
+		steps.rollback(ctx, err)
+		return err
+	}
+	return nil
+}
+
+// ListInlinePolicies returns the names of the inline policies of an IAM user.
+func (client *IAMClient) ListInlinePolicies(ctx context.Context, userName string) ([]string, error) {
+	var policyNames []string
+	paginator := iam.NewListUserPoliciesPaginator(client.IAMService, &iam.ListUserPoliciesInput{UserName: &userName})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		policyNames = append(policyNames, output.PolicyNames...)
+	}
+	return policyNames, nil
+}
+
+// CreateBucketAccessRole creates a role that principals of trustedAccount can assume, with an inline
+// policy for a specific bucket, and returns its ARN. An existing role is reused and its policy updated.
+func (client *IAMClient) CreateBucketAccessRole(ctx context.Context, roleName, bucketName string, policy BucketPolicy, trustedAccount string, maxSessionDuration time.Duration) (string, error) {
+	trustPolicy := PolicyDocument{
+		Version: policyVersion,
+		Statement: []Statement{{
+			Effect:    "Allow",
+			Principal: map[string]string{"AWS": fmt.Sprintf("arn:aws:iam::%s:root", trustedAccount)},
+			Action:    []string{"sts:AssumeRole"},
+		}},
+	}.String()
+
+	steps := newStepLog("CreateBucketAccessRole", roleName)
+	var roleArn string
+	output, err := client.IAMService.CreateRole(ctx, &iam.CreateRoleInput{
+		RoleName:                 &roleName,
+		AssumeRolePolicyDocument: &trustPolicy,
+		MaxSessionDuration:       aws.Int32(int32(max(maxSessionDuration, time.Hour).Seconds())),
+	})
+	var alreadyExistsErr *types.EntityAlreadyExistsException
+	switch {
+	case err == nil:
+		roleArn = aws.ToString(output.Role.Arn)
+		klog.V(c.LvlInfo).InfoS("Successfully created IAM role", "roleName", roleName)
+		steps.done("CreateRole", func(ctx context.Context) error {
+			return client.DeleteBucketAccessRole(ctx, roleName, bucketName)
+		})
+	case errors.As(err, &alreadyExistsErr):
+		klog.V(c.LvlDebug).InfoS("IAM role already exists, reusing it", "roleName", roleName)
+		if roleArn, err = client.GetRoleArn(ctx, roleName); err != nil {
+			return "", err
+		}
+	default:
+		return "", err
+	}
+
+	policyDocument := bucketPolicyDocument(bucketName, policy.accessMode(), policy.Conditions)
+	_, err = client.IAMService.PutRolePolicy(ctx, &iam.PutRolePolicyInput{
+		RoleName:       &roleName,
+		PolicyName:     &bucketName,
+		PolicyDocument: &policyDocument,
+	})
 	if err != nil {
+		steps.rollback(ctx, err)
+		return "", err
+	}
+	klog.V(c.LvlInfo).InfoS("Successfully attached inline policy to role", "roleName", roleName, "policyName", bucketName)
+	return roleArn, nil
+}
+
+// GetRoleArn returns the ARN of an IAM role.
+func (client *IAMClient) GetRoleArn(ctx context.Context, roleName string) (string, error) {
+	output, err := client.IAMService.GetRole(ctx, &iam.GetRoleInput{RoleName: &roleName})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.Role.Arn), nil
+}
+
+// DeleteBucketAccessRole deletes the inline policy and the role created by CreateBucketAccessRole.
+// Missing policies or roles are ignored, so it can be called for accesses that never used a role.
+func (client *IAMClient) DeleteBucketAccessRole(ctx context.Context, roleName, bucketName string) error {
+	var noSuchEntityErr *types.NoSuchEntityException
+	_, err := client.IAMService.DeleteRolePolicy(ctx, &iam.DeleteRolePolicyInput{
+		RoleName:   &roleName,
+		PolicyName: &bucketName,
+	})
+	if err != nil && !errors.As(err, &noSuchEntityErr) {
 		return err
 	}
-	klog.V(c.LvlInfo).InfoS("Deleted inline policy if it existed", "userName", userName, "policyName", bucketName)
 
-	err = client.DeleteAllAccessKeys(ctx, userName)
+	_, err = client.IAMService.DeleteRole(ctx, &iam.DeleteRoleInput{RoleName: &roleName})
 	if err != nil {
+		if errors.As(err, &noSuchEntityErr) {
+			klog.V(c.LvlDebug).InfoS("IAM role does not exist, skipping deletion", "roleName", roleName)
+			return nil
+		}
 		return err
 	}
-	klog.V(c.LvlInfo).InfoS("Deleted all access keys if any existed", "userName", userName)
+	klog.V(c.LvlInfo).InfoS("Deleted IAM role", "roleName", roleName)
+	return nil
+}
+
+// RevokeResult reports the IAM resources actually removed by RevokeBucketAccess and RevokeSharedBucketAccess.
+type RevokeResult struct {
+	InlinePolicies  []string // Names of the deleted inline policies of the bucket
+	ManagedPolicies []string // ARNs of the managed policies of the bucket detached from the user
+	Groups          []string // Names of the groups of the bucket the user was removed from
+	AccessKeys      []string // IDs of the deleted access keys
+	UserDeleted     bool     // Whether the user was deleted
+	UserMissing     bool     // Whether the user did not exist anymore
+	Remaining       []string // Policies and groups left to the user, which is kept when there are any
+}
+
+// UserGone reports whether the user no longer exists after the revoke.
+func (r *RevokeResult) UserGone() bool {
+	return r.UserDeleted || r.UserMissing
+}
+
+// RevokeBucketAccess removes the access of the user of a BucketAccess to a bucket and deletes its access
+// keys, then deletes the user once it has no policies or groups left. Every step tolerates resources that are already gone, so a
+// revoke interrupted at any point, or repeated for a user that no longer exists, completes successfully.
+func (client *IAMClient) RevokeBucketAccess(ctx context.Context, userName, bucketName string) (*RevokeResult, error) {
+	result := &RevokeResult{}
+
+	deleted, err := client.deleteInlinePolicy(ctx, userName, bucketName)
+	if err != nil {
+		return result, err
+	}
+	if deleted {
+		result.InlinePolicies = []string{bucketName}
+	}
+	if result.ManagedPolicies, result.Groups, err = client.revokeManagedBucketPolicies(ctx, userName, bucketName); err != nil {
+		return result, err
+	}
+	// The keys belong to the revoked BucketAccess alone, even when policies added outside the driver keep the user
+	if result.AccessKeys, err = client.deleteAllAccessKeys(ctx, userName); err != nil {
+		return result, err
+	}
+	return result, client.deleteUserWithoutAccess(ctx, userName, result, false)
+}
+
+// SharedGrant is the access to a bucket that a shared user was granted for one BucketAccess.
+type SharedGrant struct {
+	AccountName string       // Account name of the BucketAccess
+	Policy      BucketPolicy // Policy of the BucketAccessClass of the BucketAccess
+}
+
+// RevokeSharedBucketAccess removes the access of a shared user to a bucket, except what the kept grants
+// of the BucketAccesses still using the user on the bucket need: their inline policies, and the managed
+// policies and groups of their access modes. The user is then deleted like in RevokeBucketAccess.
+func (client *IAMClient) RevokeSharedBucketAccess(ctx context.Context, userName, bucketName string, kept []SharedGrant) (*RevokeResult, error) {
+	result := &RevokeResult{}
+
+	keptPolicies := map[string]bool{}
+	keptManaged := map[string]bool{}
+	for _, grant := range kept {
+		if grant.Policy.mode() == PolicyModeInline {
+			keptPolicies[SharedPolicyName(bucketName, grant.AccountName)] = true
+		} else {
+			keptManaged[ManagedResourceName(bucketName, grant.Policy.accessMode())] = true
+		}
+	}
 
-	err = client.DeleteUser(ctx, userName)
+	policyNames, err := client.ListInlinePolicies(ctx, userName)
+	if isNoSuchEntity(err) {
+		klog.V(c.LvlInfo).InfoS("IAM user does not exist, nothing left to revoke", "userName", userName)
+		result.UserMissing = true
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	for _, policyName := range policyNames {
+		// The policy named after the bucket predates per-BucketAccess policies, it goes with the last grant
+		legacy := policyName == bucketName && len(kept) == 0
+		if !legacy && (!strings.HasPrefix(policyName, bucketName+"@") || keptPolicies[policyName]) {
+			continue
+		}
+		deleted, err := client.deleteInlinePolicy(ctx, userName, policyName)
+		if err != nil {
+			return result, err
+		}
+		if deleted {
+			result.InlinePolicies = append(result.InlinePolicies, policyName)
+		}
+	}
+
+	var names []string
+	for _, accessMode := range accessModes {
+		if name := ManagedResourceName(bucketName, accessMode); !keptManaged[name] {
+			names = append(names, name)
+		}
+	}
+	if result.ManagedPolicies, result.Groups, err = client.revokeManagedResources(ctx, userName, names); err != nil {
+		return result, err
+	}
+	return result, client.deleteUserWithoutAccess(ctx, userName, result, true)
+}
+
+// deleteUserWithoutAccess deletes the user once it has no policies or groups left, first deleting its
+// access keys when deleteKeys is set, and records the outcome in the result.
+func (client *IAMClient) deleteUserWithoutAccess(ctx context.Context, userName string, result *RevokeResult, deleteKeys bool) error {
+	var err error
+	// A shared user keeps its keys while it still has access to other buckets.
+	// Users with policies or groups left cannot be deleted anyway, IAM would fail with DeleteConflict.
+	result.Remaining, err = client.remainingAccess(ctx, userName)
+	if isNoSuchEntity(err) {
+		klog.V(c.LvlInfo).InfoS("IAM user does not exist, nothing left to revoke", "userName", userName)
+		result.UserMissing = true
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-	klog.V(c.LvlInfo).InfoS("Deleted IAM user", "userName", userName)
+	if len(result.Remaining) > 0 {
+		klog.V(c.LvlInfo).InfoS("IAM user still has policies or groups, keeping it", "userName", userName, "remaining", result.Remaining)
+		return nil
+	}
+
+	if deleteKeys {
+		if result.AccessKeys, err = client.deleteAllAccessKeys(ctx, userName); err != nil {
+			return err
+		}
+	}
+	if result.UserDeleted, err = client.deleteUser(ctx, userName); err != nil {
+		return err
+	}
+	result.UserMissing = !result.UserDeleted
 	return nil
 }
 
-func (client *IAMClient) EnsureUserExists(ctx context.Context, userName string) error {
-	_, err := client.IAMService.GetUser(ctx, &iam.GetUserInput{UserName: &userName})
+// DeleteInlinePolicy deletes the inline policy of a bucket. A missing policy or user is ignored.
+func (client *IAMClient) DeleteInlinePolicy(ctx context.Context, userName, bucketName string) error {
+	_, err := client.deleteInlinePolicy(ctx, userName, bucketName)
 	return err
 }
 
-func (client *IAMClient) DeleteInlinePolicy(ctx context.Context, userName, bucketName string) error {
+func (client *IAMClient) deleteInlinePolicy(ctx context.Context, userName, policyName string) (bool, error) {
 	_, err := client.IAMService.DeleteUserPolicy(ctx, &iam.DeleteUserPolicyInput{
 		UserName:   &userName,
-		PolicyName: &bucketName,
+		PolicyName: &policyName,
 	})
 	if err != nil {
-		var noSuchEntityErr *types.NoSuchEntityException
-		if errors.As(err, &noSuchEntityErr) {
-			klog.V(c.LvlDebug).InfoS("Inline policy does not exist, skipping deletion", "user", userName, "policyName", bucketName)
-			return nil
+		if isNoSuchEntity(err) {
+			klog.V(c.LvlDebug).InfoS("Inline policy does not exist, skipping deletion", "user", userName, "policyName", policyName)
+			return false, nil
 		}
-		return err
+		return false, err
 	}
-	klog.V(c.LvlDebug).InfoS("Successfully deleted inline policy", "userName", userName, "policyName", bucketName)
-	return nil
+	klog.V(c.LvlDebug).InfoS("Successfully deleted inline policy", "userName", userName, "policyName", policyName)
+	return true, nil
 }
 
+// DeleteAllAccessKeys deletes the access keys of a user. A missing user has no keys to delete.
 func (client *IAMClient) DeleteAllAccessKeys(ctx context.Context, userName string) error {
-	listKeysOutput, err := client.IAMService.ListAccessKeys(ctx, &iam.ListAccessKeysInput{UserName: &userName})
+	_, err := client.deleteAllAccessKeys(ctx, userName)
+	return err
+}
+
+func (client *IAMClient) deleteAllAccessKeys(ctx context.Context, userName string) ([]string, error) {
+	keys, err := client.ListAccessKeys(ctx, userName)
 	if err != nil {
-		return err
+		if isNoSuchEntity(err) {
+			return nil, nil
+		}
+		return nil, err
 	}
-	var noSuchEntityErr *types.NoSuchEntityException
-	for _, key := range listKeysOutput.AccessKeyMetadata {
+	var deleted []string
+	for _, key := range keys {
 		klog.V(c.LvlTrace).InfoS("Deleting access key", "userName", userName, "accessKeyId", *key.AccessKeyId)
 		_, err := client.IAMService.DeleteAccessKey(ctx, &iam.DeleteAccessKeyInput{
 			UserName:    &userName,
 			AccessKeyId: key.AccessKeyId,
 		})
 		if err != nil {
-			if errors.As(err, &noSuchEntityErr) {
+			if isNoSuchEntity(err) {
 				klog.V(c.LvlTrace).InfoS("Access key does not exist, skipping deletion", "userName", userName, "accessKeyId", *key.AccessKeyId)
 				continue
 			}
-			return err
+			return deleted, err
 		}
+		deleted = append(deleted, *key.AccessKeyId)
 		klog.V(c.LvlTrace).InfoS("Successfully deleted access key", "userName", userName, "accessKeyId", *key.AccessKeyId)
 	}
-	klog.V(c.LvlDebug).InfoS("Successfully deleted all access keys", "userName", userName)
-	return nil
+	klog.V(c.LvlDebug).InfoS("Successfully deleted all access keys", "userName", userName, "count", len(deleted))
+	return deleted, nil
 }
 
+// DeleteUser deletes an IAM user. A missing user is ignored.
 func (client *IAMClient) DeleteUser(ctx context.Context, userName string) error {
+	_, err := client.deleteUser(ctx, userName)
+	return err
+}
+
+func (client *IAMClient) deleteUser(ctx context.Context, userName string) (bool, error) {
 	_, err := client.IAMService.DeleteUser(ctx, &iam.DeleteUserInput{UserName: &userName})
 	if err != nil {
-		var noSuchEntityErr *types.NoSuchEntityException
-		if errors.As(err, &noSuchEntityErr) {
+		if isNoSuchEntity(err) {
 			klog.InfoS("IAM user does not exist, skipping deletion", "user", userName)
-			return nil // User doesn't exist, nothing to delete
+			return false, nil
 		}
-		return err
+		return false, err
 	}
-	return nil
+	klog.V(c.LvlInfo).InfoS("Deleted IAM user", "userName", userName)
+	return true, nil
 }
@@ -2,9 +2,11 @@ package iamclient_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -14,7 +16,10 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"github.com/scality/cosi-driver/pkg/metrics"
 	"github.com/scality/cosi-driver/pkg/mock"
 	"github.com/scality/cosi-driver/pkg/util"
 )
@@ -59,7 +64,29 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.CreateUser(ctx, "test-user")
+			err := client.CreateUser(ctx, "test-user", iamclient.UserOptions{})
+			Expect(err).To(BeNil())
+		})
+
+		It("should create a user with a path, tags and a permissions boundary", func(ctx SpecContext) {
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				Expect(*input.Path).To(Equal("/cosi/prod/team-a/"))
+				Expect(*input.PermissionsBoundary).To(Equal("arn:aws:iam::123456789012:policy/cosi-boundary"))
+				Expect(input.Tags).To(Equal([]types.Tag{
+					{Key: aws.String("cosi.scality.com/bucket-access"), Value: aws.String("ba-data")},
+					{Key: aws.String("cosi.scality.com/namespace"), Value: aws.String("team-a")},
+				}))
+				return &iam.CreateUserOutput{}, nil
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			err := client.CreateUser(ctx, "test-user", iamclient.UserOptions{
+				Path:                "/cosi/prod/team-a/",
+				Tags:                map[string]string{"cosi.scality.com/namespace": "team-a", "cosi.scality.com/bucket-access": "ba-data"},
+				PermissionsBoundary: "arn:aws:iam::123456789012:policy/cosi-boundary",
+			})
 			Expect(err).To(BeNil())
 		})
 
@@ -71,7 +98,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.CreateUser(ctx, "test-user")
+			err := client.CreateUser(ctx, "test-user", iamclient.UserOptions{})
 			Expect(err).NotTo(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
 		})
@@ -178,7 +205,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket")
+			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
 			Expect(err).To(BeNil())
 			Expect(output).NotTo(BeNil())
 			Expect(output.AccessKey.AccessKeyId).To(Equal(aws.String("test-access-key-id")))
@@ -193,7 +220,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket")
+			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
 			Expect(err).NotTo(BeNil())
 			Expect(output).To(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
@@ -211,7 +238,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket")
+			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
 			Expect(err).NotTo(BeNil())
 			Expect(output).To(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
@@ -233,7 +260,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket")
+			output, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
 			Expect(err).NotTo(BeNil())
 			Expect(output).To(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
@@ -292,31 +319,98 @@ var _ = Describe("IAMClient", func() {
 			mockIAM = &mock.MockIAMClient{}
 		})
 
-		It("should fail on non-existent user gracefully", func(ctx SpecContext) {
-
-			mockIAM.GetUserFunc = func(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+		It("should succeed without deleting anything when the user does not exist", func(ctx SpecContext) {
+			mockIAM.DeleteUserPolicyFunc = func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
 				return nil, noSuchEntityError
 			}
+			mockIAM.ListAttachedUserPoliciesFunc = func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+				return nil, noSuchEntityError
+			}
+			mockIAM.ListGroupsForUserFunc = func(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+				return nil, noSuchEntityError
+			}
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return nil, noSuchEntityError
+			}
+			mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				return nil, noSuchEntityError
+			}
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				Fail("a missing user should not be deleted")
+				return nil, nil
+			}
 
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "non-existent-user", "test-bucket")
-			Expect(err).NotTo(BeNil())
-			Expect(errors.As(err, &noSuchEntityError)).To(BeTrue())
+			result, err := client.RevokeBucketAccess(ctx, "non-existent-user", "test-bucket")
+			Expect(err).To(BeNil())
+			Expect(*result).To(Equal(iamclient.RevokeResult{UserMissing: true}))
+			Expect(result.UserGone()).To(BeTrue())
 		})
 
-		It("should return an error if getting user fails", func(ctx SpecContext) {
-			mockIAM.GetUserFunc = func(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+		It("should succeed when the user disappears before its access keys are deleted", func(ctx SpecContext) {
+			mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				return nil, noSuchEntityError
+			}
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
 				return nil, noSuchEntityError
 			}
 
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
-			Expect(err).NotTo(BeNil())
-			Expect(errors.As(err, &noSuchEntityError)).To(BeTrue())
+			result, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			Expect(err).To(BeNil())
+			Expect(result.UserDeleted).To(BeFalse())
+			Expect(result.UserMissing).To(BeTrue())
+		})
+
+		It("should report the resources it removed", func(ctx SpecContext) {
+			mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				return &iam.ListAccessKeysOutput{AccessKeyMetadata: []types.AccessKeyMetadata{
+					{AccessKeyId: aws.String("AKIA1")}, {AccessKeyId: aws.String("AKIA2")},
+				}}, nil
+			}
+			mockIAM.DeleteAccessKeyFunc = func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				if *input.AccessKeyId == "AKIA2" {
+					return nil, noSuchEntityError
+				}
+				return &iam.DeleteAccessKeyOutput{}, nil
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			result, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			Expect(err).To(BeNil())
+			Expect(*result).To(Equal(iamclient.RevokeResult{
+				InlinePolicies: []string{"test-bucket"},
+				AccessKeys:     []string{"AKIA1"},
+				UserDeleted:    true,
+			}))
+		})
+
+		It("should report the policies and groups left to a shared user", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"other-bucket"}}, nil
+			}
+			mockIAM.ListAttachedUserPoliciesFunc = func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+				return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: []types.AttachedPolicy{
+					{PolicyName: aws.String("cosi-third-bucket-readonly"), PolicyArn: aws.String("arn:third-bucket")},
+				}}, nil
+			}
+			mockIAM.ListGroupsForUserFunc = func(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+				return &iam.ListGroupsForUserOutput{Groups: []types.Group{{GroupName: aws.String("cosi-fourth-bucket-readwrite")}}}, nil
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			result, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			Expect(err).To(BeNil())
+			Expect(result.Remaining).To(Equal([]string{"other-bucket", "arn:third-bucket", "group/cosi-fourth-bucket-readwrite"}))
+			Expect(result.UserGone()).To(BeFalse())
 		})
 
 		It("should skip deletion if inline policy does not exist", func(ctx SpecContext) {
@@ -327,7 +421,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).To(BeNil())
 		})
 
@@ -339,7 +433,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).NotTo(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
 		})
@@ -352,7 +446,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).To(BeNil())
 		})
 
@@ -360,7 +454,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).To(BeNil())
 		})
 
@@ -372,7 +466,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).NotTo(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
 		})
@@ -385,7 +479,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).To(BeNil())
 		})
 
@@ -393,10 +487,57 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).To(BeNil())
 		})
 
+		It("should delete the access keys of a user kept by other policies", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"other-bucket"}}, nil
+			}
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				Fail("the user should not be deleted")
+				return nil, nil
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			result, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			Expect(err).To(BeNil())
+			Expect(result.AccessKeys).NotTo(BeEmpty())
+			Expect(result.UserGone()).To(BeFalse())
+		})
+
+		It("should keep the access keys of a shared user with access to other buckets", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"other-bucket@ba-1"}}, nil
+			}
+			mockIAM.DeleteAccessKeyFunc = func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				Fail("the access keys should not be deleted")
+				return nil, nil
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			result, err := client.RevokeSharedBucketAccess(ctx, "shared-user", "test-bucket", nil)
+			Expect(err).To(BeNil())
+			Expect(result.Remaining).To(Equal([]string{"other-bucket@ba-1"}))
+		})
+
+		It("should return an error if listing remaining inline policies fails", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			client, _ := iamclient.InitIAMClient(ctx, params)
+			client.IAMService = mockIAM
+
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+		})
+
 		It("should return an error if deleting user fails", func(ctx SpecContext) {
 			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
 				return nil, accessDeniedError
@@ -405,7 +546,7 @@ var _ = Describe("IAMClient", func() {
 			client, _ := iamclient.InitIAMClient(ctx, params)
 			client.IAMService = mockIAM
 
-			err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
+			_, err := client.RevokeBucketAccess(ctx, "test-user", "test-bucket")
 			Expect(err).NotTo(BeNil())
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
 		})
@@ -482,4 +623,645 @@ var _ = Describe("IAMClient", func() {
 			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
 		})
 	})
+
+	Describe("Access key management", func() {
+		var (
+			mockIAM *mock.MockIAMClient
+			client  *iamclient.IAMClient
+		)
+
+		BeforeEach(func() {
+			mockIAM = &mock.MockIAMClient{}
+			client = &iamclient.IAMClient{IAMService: mockIAM}
+		})
+
+		It("should list the access keys of a user", func(ctx SpecContext) {
+			mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				Expect(*input.UserName).To(Equal("test-user"))
+				return &iam.ListAccessKeysOutput{AccessKeyMetadata: []types.AccessKeyMetadata{
+					{AccessKeyId: aws.String("key-1")},
+					{AccessKeyId: aws.String("key-2")},
+				}}, nil
+			}
+
+			keys, err := client.ListAccessKeys(ctx, "test-user")
+			Expect(err).To(BeNil())
+			Expect(keys).To(HaveLen(2))
+		})
+
+		It("should return an error if listing access keys fails", func(ctx SpecContext) {
+			mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			_, err := client.ListAccessKeys(ctx, "test-user")
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+		})
+
+		It("should delete a single access key", func(ctx SpecContext) {
+			var deleted string
+			mockIAM.DeleteAccessKeyFunc = func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				deleted = *input.AccessKeyId
+				return &iam.DeleteAccessKeyOutput{}, nil
+			}
+
+			Expect(client.DeleteAccessKey(ctx, "test-user", "key-1")).To(Succeed())
+			Expect(deleted).To(Equal("key-1"))
+		})
+
+		It("should ignore access keys that no longer exist", func(ctx SpecContext) {
+			mockIAM.DeleteAccessKeyFunc = func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				return nil, &types.NoSuchEntityException{}
+			}
+
+			Expect(client.DeleteAccessKey(ctx, "test-user", "key-1")).To(Succeed())
+		})
+	})
+
+	Describe("Bucket access roles", func() {
+		var (
+			mockIAM *mock.MockIAMClient
+			client  *iamclient.IAMClient
+		)
+
+		BeforeEach(func() {
+			mockIAM = &mock.MockIAMClient{}
+			client = &iamclient.IAMClient{IAMService: mockIAM}
+		})
+
+		It("should create a role trusted by the account with a bucket policy", func(ctx SpecContext) {
+			mockIAM.CreateRoleFunc = func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+				Expect(*input.AssumeRolePolicyDocument).To(ContainSubstring("arn:aws:iam::123456789012:root"))
+				Expect(*input.MaxSessionDuration).To(Equal(int32(7200)))
+				return &iam.CreateRoleOutput{Role: &types.Role{Arn: aws.String("arn:aws:iam::123456789012:role/test-role")}}, nil
+			}
+			var policyName, policyDocument string
+			mockIAM.PutRolePolicyFunc = func(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+				policyName, policyDocument = *input.PolicyName, *input.PolicyDocument
+				return &iam.PutRolePolicyOutput{}, nil
+			}
+
+			roleArn, err := client.CreateBucketAccessRole(ctx, "test-role", "test-bucket", iamclient.BucketPolicy{}, "123456789012", 2*time.Hour)
+			Expect(err).To(BeNil())
+			Expect(roleArn).To(Equal("arn:aws:iam::123456789012:role/test-role"))
+			Expect(policyName).To(Equal("test-bucket"))
+			Expect(policyDocument).To(ContainSubstring("arn:aws:s3:::test-bucket/*"))
+		})
+
+		It("should allow at least one hour sessions on the role", func(ctx SpecContext) {
+			mockIAM.CreateRoleFunc = func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+				Expect(*input.MaxSessionDuration).To(Equal(int32(3600)))
+				return &iam.CreateRoleOutput{Role: &types.Role{Arn: aws.String("arn")}}, nil
+			}
+
+			_, err := client.CreateBucketAccessRole(ctx, "test-role", "test-bucket", iamclient.BucketPolicy{}, "123456789012", 15*time.Minute)
+			Expect(err).To(BeNil())
+		})
+
+		It("should reuse an existing role", func(ctx SpecContext) {
+			mockIAM.CreateRoleFunc = func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+
+			roleArn, err := client.CreateBucketAccessRole(ctx, "test-role", "test-bucket", iamclient.BucketPolicy{}, "123456789012", time.Hour)
+			Expect(err).To(BeNil())
+			Expect(roleArn).To(Equal("arn:aws:iam::123456789012:role/test-role"))
+		})
+
+		It("should return an error if the role policy cannot be attached", func(ctx SpecContext) {
+			mockIAM.PutRolePolicyFunc = func(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			_, err := client.CreateBucketAccessRole(ctx, "test-role", "test-bucket", iamclient.BucketPolicy{}, "123456789012", time.Hour)
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+		})
+
+		It("should delete the role policy and the role", func(ctx SpecContext) {
+			var calls []string
+			mockIAM.DeleteRolePolicyFunc = func(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+				calls = append(calls, "DeleteRolePolicy:"+*input.PolicyName)
+				return &iam.DeleteRolePolicyOutput{}, nil
+			}
+			mockIAM.DeleteRoleFunc = func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+				calls = append(calls, "DeleteRole:"+*input.RoleName)
+				return &iam.DeleteRoleOutput{}, nil
+			}
+
+			Expect(client.DeleteBucketAccessRole(ctx, "test-role", "test-bucket")).To(Succeed())
+			Expect(calls).To(Equal([]string{"DeleteRolePolicy:test-bucket", "DeleteRole:test-role"}))
+		})
+
+		It("should ignore roles that do not exist", func(ctx SpecContext) {
+			mockIAM.DeleteRolePolicyFunc = func(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+				return nil, &types.NoSuchEntityException{}
+			}
+			mockIAM.DeleteRoleFunc = func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+				return nil, &types.NoSuchEntityException{}
+			}
+
+			Expect(client.DeleteBucketAccessRole(ctx, "test-role", "test-bucket")).To(Succeed())
+		})
+	})
+
+	Describe("Shared bucket access", func() {
+		var (
+			mockIAM *mock.MockIAMClient
+			client  *iamclient.IAMClient
+		)
+
+		BeforeEach(func() {
+			mockIAM = &mock.MockIAMClient{}
+			client = &iamclient.IAMClient{IAMService: mockIAM}
+		})
+
+		It("should add a bucket policy to an existing user", func(ctx SpecContext) {
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			var policyName string
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				policyName = *input.PolicyName
+				return &iam.PutUserPolicyOutput{}, nil
+			}
+
+			Expect(client.CreateSharedBucketAccess(ctx, "shared-user", "second-bucket", "ba-1", iamclient.BucketPolicy{}, iamclient.UserOptions{})).To(Succeed())
+			Expect(policyName).To(Equal("second-bucket@ba-1"))
+		})
+
+		It("should apply the permissions boundary to an existing user", func(ctx SpecContext) {
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			var boundary string
+			mockIAM.PutUserPermissionsBoundaryFunc = func(ctx context.Context, input *iam.PutUserPermissionsBoundaryInput, opts ...func(*iam.Options)) (*iam.PutUserPermissionsBoundaryOutput, error) {
+				boundary = *input.PermissionsBoundary
+				return &iam.PutUserPermissionsBoundaryOutput{}, nil
+			}
+
+			options := iamclient.UserOptions{PermissionsBoundary: "arn:aws:iam::123456789012:policy/cosi-boundary"}
+			Expect(client.CreateSharedBucketAccess(ctx, "shared-user", "test-bucket", "ba-1", iamclient.BucketPolicy{}, options)).To(Succeed())
+			Expect(boundary).To(Equal(options.PermissionsBoundary))
+		})
+
+		It("should return an error if the user cannot be created", func(ctx SpecContext) {
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			err := client.CreateSharedBucketAccess(ctx, "shared-user", "test-bucket", "ba-1", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+		})
+
+		It("should list the inline policies of a user", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				Expect(*input.UserName).To(Equal("shared-user"))
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"bucket-a", "bucket-b"}}, nil
+			}
+
+			policies, err := client.ListInlinePolicies(ctx, "shared-user")
+			Expect(err).To(BeNil())
+			Expect(policies).To(Equal([]string{"bucket-a", "bucket-b"}))
+		})
+
+		It("should keep the policies of the remaining grants on the bucket", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"test-bucket", "test-bucket@ba-1", "test-bucket@ba-2", "other-bucket@ba-1"}}, nil
+			}
+			mockIAM.ListAttachedUserPoliciesFunc = func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+				return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: []types.AttachedPolicy{
+					{PolicyName: aws.String("cosi-test-bucket-readwrite"), PolicyArn: aws.String("arn:readwrite")},
+					{PolicyName: aws.String("cosi-test-bucket-readonly"), PolicyArn: aws.String("arn:readonly")},
+				}}, nil
+			}
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				Fail("the user should not be deleted")
+				return nil, nil
+			}
+
+			kept := []iamclient.SharedGrant{
+				{AccountName: "ba-2"},
+				{AccountName: "ba-3", Policy: iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged, AccessMode: iamclient.AccessModeReadOnly}},
+			}
+			result, err := client.RevokeSharedBucketAccess(ctx, "shared-user", "test-bucket", kept)
+			Expect(err).To(BeNil())
+			Expect(result.InlinePolicies).To(Equal([]string{"test-bucket@ba-1"}))
+			Expect(result.ManagedPolicies).To(Equal([]string{"arn:readwrite"}))
+		})
+
+		It("should remove every policy of the bucket without remaining grants", func(ctx SpecContext) {
+			mockIAM.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: []string{"test-bucket", "test-bucket@ba-1", "other-bucket@ba-1"}}, nil
+			}
+
+			result, err := client.RevokeSharedBucketAccess(ctx, "shared-user", "test-bucket", nil)
+			Expect(err).To(BeNil())
+			Expect(result.InlinePolicies).To(Equal([]string{"test-bucket", "test-bucket@ba-1"}))
+		})
+	})
+
+	Describe("Bucket policy modes", func() {
+		var (
+			mockIAM *mock.MockIAMClient
+			client  *iamclient.IAMClient
+		)
+
+		BeforeEach(func() {
+			mockIAM = &mock.MockIAMClient{}
+			client = &iamclient.IAMClient{IAMService: mockIAM}
+		})
+
+		It("should grant read-only access through an inline policy", func(ctx SpecContext) {
+			var document string
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				document = *input.PolicyDocument
+				return &iam.PutUserPolicyOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{AccessMode: iamclient.AccessModeReadOnly}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).To(Succeed())
+			Expect(document).To(ContainSubstring(`"s3:GetObject"`))
+			Expect(document).NotTo(ContainSubstring(`"s3:*"`))
+		})
+
+		It("should add the conditions of the policy to its statement", func(ctx SpecContext) {
+			var document iamclient.PolicyDocument
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				Expect(json.Unmarshal([]byte(*input.PolicyDocument), &document)).To(Succeed())
+				return &iam.PutUserPolicyOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Conditions: iamclient.PolicyConditions{
+				SourceCIDRs:            []string{"10.0.0.0/8", "192.168.1.0/24"},
+				RequireSecureTransport: true,
+				ExpiresAt:              time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+			}}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).To(Succeed())
+			Expect(document.Statement).To(HaveLen(1))
+			Expect(document.Statement[0].Action).To(Equal([]string{"s3:*"}))
+			Expect(document.Statement[0].Condition).To(Equal(iamclient.Condition{
+				"IpAddress":    {"aws:SourceIp": []interface{}{"10.0.0.0/8", "192.168.1.0/24"}},
+				"Bool":         {"aws:SecureTransport": "true"},
+				"DateLessThan": {"aws:CurrentTime": "2030-01-02T03:04:05Z"},
+			}))
+		})
+
+		It("should not add conditions to policies without restrictions", func(ctx SpecContext) {
+			var document string
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				document = *input.PolicyDocument
+				return &iam.PutUserPolicyOutput{}, nil
+			}
+
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{})).To(Succeed())
+			Expect(document).NotTo(ContainSubstring("Condition"))
+		})
+
+		It("should reject conditions on shared managed policies", func(ctx SpecContext) {
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				Fail("managed policy must not be created")
+				return nil, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged, Conditions: iamclient.PolicyConditions{RequireSecureTransport: true}}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).NotTo(Succeed())
+		})
+
+		It("should create a managed policy and attach it to the user", func(ctx SpecContext) {
+			var created *iam.CreatePolicyInput
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				created = input
+				return &iam.CreatePolicyOutput{Policy: &types.Policy{Arn: aws.String("arn:aws:iam::123456789012:policy/cosi/cosi-test-bucket-readwrite")}}, nil
+			}
+			var attached string
+			mockIAM.AttachUserPolicyFunc = func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+				Expect(*input.UserName).To(Equal("test-user"))
+				attached = *input.PolicyArn
+				return &iam.AttachUserPolicyOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).To(Succeed())
+			Expect(*created.PolicyName).To(Equal("cosi-test-bucket-readwrite"))
+			Expect(*created.Path).To(Equal(iamclient.ManagedResourcePath))
+			Expect(attached).To(Equal("arn:aws:iam::123456789012:policy/cosi/cosi-test-bucket-readwrite"))
+		})
+
+		It("should reuse an existing managed policy", func(ctx SpecContext) {
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			mockIAM.ListPoliciesFunc = func(ctx context.Context, input *iam.ListPoliciesInput, opts ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+				Expect(*input.PathPrefix).To(Equal(iamclient.ManagedResourcePath))
+				return &iam.ListPoliciesOutput{Policies: []types.Policy{
+					{PolicyName: aws.String("cosi-other-bucket-readonly"), Arn: aws.String("arn:other")},
+					{PolicyName: aws.String("cosi-test-bucket-readonly"), Arn: aws.String("arn:existing")},
+				}}, nil
+			}
+			var attached string
+			mockIAM.AttachUserPolicyFunc = func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+				attached = *input.PolicyArn
+				return &iam.AttachUserPolicyOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged, AccessMode: iamclient.AccessModeReadOnly}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).To(Succeed())
+			Expect(attached).To(Equal("arn:existing"))
+		})
+
+		It("should fail when a policy with the same name exists outside of the driver path", func(ctx SpecContext) {
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).NotTo(Succeed())
+		})
+
+		It("should delete the managed policy it created when attaching it fails", func(ctx SpecContext) {
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				return &iam.CreatePolicyOutput{Policy: &types.Policy{Arn: aws.String("arn:created")}}, nil
+			}
+			mockIAM.AttachUserPolicyFunc = func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+				return nil, &types.NoSuchEntityException{}
+			}
+			mockIAM.GetPolicyFunc = func(ctx context.Context, input *iam.GetPolicyInput, opts ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+				return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: input.PolicyArn, AttachmentCount: aws.Int32(0)}}, nil
+			}
+			var deleted []string
+			mockIAM.DeletePolicyFunc = func(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+				deleted = append(deleted, *input.PolicyArn)
+				return &iam.DeletePolicyOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).NotTo(Succeed())
+			Expect(deleted).To(Equal([]string{"arn:created"}))
+		})
+
+		It("should keep a reused managed policy when attaching it fails", func(ctx SpecContext) {
+			mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			mockIAM.ListPoliciesFunc = func(ctx context.Context, input *iam.ListPoliciesInput, opts ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+				return &iam.ListPoliciesOutput{Policies: []types.Policy{{PolicyName: aws.String("cosi-test-bucket-readwrite"), Arn: aws.String("arn:existing")}}}, nil
+			}
+			mockIAM.AttachUserPolicyFunc = func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+				return nil, &types.NoSuchEntityException{}
+			}
+			mockIAM.DeletePolicyFunc = func(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+				Fail("a reused managed policy must not be deleted")
+				return nil, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeManaged}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).NotTo(Succeed())
+		})
+
+		It("should delete the group it created when adding the user fails", func(ctx SpecContext) {
+			mockIAM.CreateGroupFunc = func(ctx context.Context, input *iam.CreateGroupInput, opts ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+				return &iam.CreateGroupOutput{}, nil
+			}
+			mockIAM.PutGroupPolicyFunc = func(ctx context.Context, input *iam.PutGroupPolicyInput, opts ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error) {
+				return &iam.PutGroupPolicyOutput{}, nil
+			}
+			mockIAM.AddUserToGroupFunc = func(ctx context.Context, input *iam.AddUserToGroupInput, opts ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+				return nil, &types.LimitExceededException{}
+			}
+			mockIAM.GetGroupFunc = func(ctx context.Context, input *iam.GetGroupInput, opts ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+				return &iam.GetGroupOutput{Group: &types.Group{GroupName: input.GroupName}}, nil
+			}
+			mockIAM.DeleteGroupPolicyFunc = func(ctx context.Context, input *iam.DeleteGroupPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteGroupPolicyOutput, error) {
+				return &iam.DeleteGroupPolicyOutput{}, nil
+			}
+			var deleted []string
+			mockIAM.DeleteGroupFunc = func(ctx context.Context, input *iam.DeleteGroupInput, opts ...func(*iam.Options)) (*iam.DeleteGroupOutput, error) {
+				deleted = append(deleted, *input.GroupName)
+				return &iam.DeleteGroupOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeGroup}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).NotTo(Succeed())
+			Expect(deleted).To(Equal([]string{"cosi-test-bucket-readwrite"}))
+		})
+
+		It("should add the user to the group of the bucket", func(ctx SpecContext) {
+			mockIAM.CreateGroupFunc = func(ctx context.Context, input *iam.CreateGroupInput, opts ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			var groupPolicy *iam.PutGroupPolicyInput
+			mockIAM.PutGroupPolicyFunc = func(ctx context.Context, input *iam.PutGroupPolicyInput, opts ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error) {
+				groupPolicy = input
+				return &iam.PutGroupPolicyOutput{}, nil
+			}
+			var group string
+			mockIAM.AddUserToGroupFunc = func(ctx context.Context, input *iam.AddUserToGroupInput, opts ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+				Expect(*input.UserName).To(Equal("test-user"))
+				group = *input.GroupName
+				return &iam.AddUserToGroupOutput{}, nil
+			}
+
+			policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeGroup}
+			Expect(client.GrantBucketPolicy(ctx, "test-user", "test-bucket", policy)).To(Succeed())
+			Expect(group).To(Equal("cosi-test-bucket-readwrite"))
+			Expect(*groupPolicy.GroupName).To(Equal(group))
+		})
+
+		It("should detach and delete unused managed policies and groups on revoke", func(ctx SpecContext) {
+			var detached, deletedPolicies []string
+			mockIAM.DetachUserPolicyFunc = func(ctx context.Context, input *iam.DetachUserPolicyInput, opts ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error) {
+				detached = append(detached, *input.PolicyArn)
+				return &iam.DetachUserPolicyOutput{}, nil
+			}
+			mockIAM.DeletePolicyFunc = func(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+				deletedPolicies = append(deletedPolicies, *input.PolicyArn)
+				return &iam.DeletePolicyOutput{}, nil
+			}
+			removed := false
+			mockIAM.ListGroupsForUserFunc = func(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+				if removed {
+					return &iam.ListGroupsForUserOutput{}, nil
+				}
+				return &iam.ListGroupsForUserOutput{Groups: []types.Group{{GroupName: aws.String("cosi-test-bucket-readonly")}}}, nil
+			}
+			mockIAM.RemoveUserFromGroupFunc = func(ctx context.Context, input *iam.RemoveUserFromGroupInput, opts ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error) {
+				removed = true
+				return &iam.RemoveUserFromGroupOutput{}, nil
+			}
+			var deletedGroups []string
+			mockIAM.DeleteGroupFunc = func(ctx context.Context, input *iam.DeleteGroupInput, opts ...func(*iam.Options)) (*iam.DeleteGroupOutput, error) {
+				deletedGroups = append(deletedGroups, *input.GroupName)
+				return &iam.DeleteGroupOutput{}, nil
+			}
+			mockIAM.ListAttachedUserPoliciesFunc = func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+				if len(detached) > 0 {
+					return &iam.ListAttachedUserPoliciesOutput{}, nil
+				}
+				return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: []types.AttachedPolicy{
+					{PolicyName: aws.String("cosi-test-bucket-readwrite"), PolicyArn: aws.String("arn:test-bucket")},
+				}}, nil
+			}
+			userDeleted := false
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				userDeleted = true
+				return &iam.DeleteUserOutput{}, nil
+			}
+
+			Expect(client.RevokeBucketAccess(ctx, "test-user", "test-bucket")).Error().To(Succeed())
+			Expect(detached).To(Equal([]string{"arn:test-bucket"}))
+			Expect(deletedPolicies).To(Equal([]string{"arn:test-bucket"}))
+			Expect(deletedGroups).To(Equal([]string{"cosi-test-bucket-readonly"}))
+			Expect(userDeleted).To(BeTrue())
+		})
+
+		It("should keep managed policies still attached to other users", func(ctx SpecContext) {
+			mockIAM.ListAttachedUserPoliciesFunc = func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+				return &iam.ListAttachedUserPoliciesOutput{AttachedPolicies: []types.AttachedPolicy{
+					{PolicyName: aws.String("cosi-test-bucket-readwrite"), PolicyArn: aws.String("arn:test-bucket")},
+					{PolicyName: aws.String("cosi-other-bucket-readwrite"), PolicyArn: aws.String("arn:other-bucket")},
+				}}, nil
+			}
+			var detached []string
+			mockIAM.DetachUserPolicyFunc = func(ctx context.Context, input *iam.DetachUserPolicyInput, opts ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error) {
+				detached = append(detached, *input.PolicyArn)
+				return &iam.DetachUserPolicyOutput{}, nil
+			}
+			mockIAM.GetPolicyFunc = func(ctx context.Context, input *iam.GetPolicyInput, opts ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+				return &iam.GetPolicyOutput{Policy: &types.Policy{AttachmentCount: aws.Int32(2)}}, nil
+			}
+			mockIAM.DeletePolicyFunc = func(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+				Fail("policy attached to other users must not be deleted")
+				return nil, nil
+			}
+			mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				Fail("user with access to other buckets must not be deleted")
+				return nil, nil
+			}
+
+			Expect(client.RevokeBucketAccess(ctx, "test-user", "test-bucket")).Error().To(Succeed())
+			Expect(detached).To(Equal([]string{"arn:test-bucket"}))
+		})
+	})
+
+	Describe("Rollback of partial grants", func() {
+		var (
+			mockIAM *mock.MockIAMClient
+			client  *iamclient.IAMClient
+			undone  []string
+		)
+
+		BeforeEach(func() {
+			metrics.InitializeMetrics("test_iam", prometheus.NewRegistry())
+			undone = nil
+			mockIAM = &mock.MockIAMClient{
+				DeleteUserPolicyFunc: func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+					undone = append(undone, "DeleteUserPolicy "+*input.PolicyName)
+					return &iam.DeleteUserPolicyOutput{}, nil
+				},
+				DeleteUserFunc: func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+					Expect(ctx.Err()).To(BeNil())
+					undone = append(undone, "DeleteUser "+*input.UserName)
+					return &iam.DeleteUserOutput{}, nil
+				},
+			}
+			client = &iamclient.IAMClient{IAMService: mockIAM}
+		})
+
+		rollbacks := func(step, status string) float64 {
+			return testutil.ToFloat64(metrics.IAMRollbacksTotal.WithLabelValues(step, status))
+		}
+
+		It("should delete the policy and the user when the access key cannot be created", func(ctx SpecContext) {
+			mockIAM.CreateAccessKeyFunc = func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			_, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+			Expect(undone).To(Equal([]string{"DeleteUserPolicy test-bucket", "DeleteUser test-user"}))
+			Expect(rollbacks("GrantBucketPolicy", "success")).To(Equal(1.0))
+			Expect(rollbacks("CreateUser", "success")).To(Equal(1.0))
+		})
+
+		It("should delete the user when the policy cannot be granted", func(ctx SpecContext) {
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			_, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+			Expect(undone).To(Equal([]string{"DeleteUser test-user"}))
+		})
+
+		It("should not undo anything when the user cannot be created", func(ctx SpecContext) {
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+
+			_, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(err).NotTo(BeNil())
+			Expect(undone).To(BeEmpty())
+		})
+
+		It("should undo the remaining steps when a compensating action fails", func(ctx SpecContext) {
+			mockIAM.CreateAccessKeyFunc = func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+				return nil, accessDeniedError
+			}
+			mockIAM.DeleteUserPolicyFunc = func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+				return nil, errors.New("connection reset")
+			}
+
+			_, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+			Expect(undone).To(Equal([]string{"DeleteUser test-user"}))
+			Expect(rollbacks("GrantBucketPolicy", "failure")).To(Equal(1.0))
+			Expect(rollbacks("CreateUser", "success")).To(Equal(1.0))
+		})
+
+		It("should roll back even when the request context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			mockIAM.CreateAccessKeyFunc = func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+				cancel()
+				return nil, context.Canceled
+			}
+
+			_, err := client.CreateBucketAccess(ctx, "test-user", "test-bucket", iamclient.BucketPolicy{}, iamclient.UserOptions{})
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+			Expect(undone).To(ContainElement("DeleteUser test-user"))
+		})
+
+		It("should only delete shared users created by the failed grant", func(ctx SpecContext) {
+			mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				return nil, accessDeniedError
+			}
+
+			Expect(client.CreateSharedBucketAccess(ctx, "shared-user", "test-bucket", "ba-1", iamclient.BucketPolicy{}, iamclient.UserOptions{})).NotTo(Succeed())
+			Expect(undone).To(Equal([]string{"DeleteUser shared-user"}))
+
+			undone = nil
+			mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				return nil, &types.EntityAlreadyExistsException{}
+			}
+			Expect(client.CreateSharedBucketAccess(ctx, "shared-user", "test-bucket", "ba-1", iamclient.BucketPolicy{}, iamclient.UserOptions{})).NotTo(Succeed())
+			Expect(undone).To(BeEmpty())
+		})
+
+		It("should delete a role created by the failed grant", func(ctx SpecContext) {
+			mockIAM.CreateRoleFunc = func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+				return &iam.CreateRoleOutput{Role: &types.Role{Arn: aws.String("arn:aws:iam::123456789012:role/test-role")}}, nil
+			}
+			mockIAM.PutRolePolicyFunc = func(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+				return nil, accessDeniedError
+			}
+			mockIAM.DeleteRoleFunc = func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+				undone = append(undone, "DeleteRole "+*input.RoleName)
+				return &iam.DeleteRoleOutput{}, nil
+			}
+
+			_, err := client.CreateBucketAccessRole(ctx, "test-role", "test-bucket", iamclient.BucketPolicy{}, "123456789012", time.Hour)
+			Expect(errors.As(err, &accessDeniedError)).To(BeTrue())
+			Expect(undone).To(Equal([]string{"DeleteRole test-role"}))
+			Expect(rollbacks("CreateRole", "success")).To(Equal(1.0))
+		})
+	})
 })
@@ -0,0 +1,65 @@
+package iamclient
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const policyVersion = "2012-10-17"
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string      `json:"Version"`
+	Statement []Statement `json:"Statement"`
+}
+
+// Statement is a statement of an IAM policy document.
+type Statement struct {
+	Effect    string            `json:"Effect"`
+	Principal map[string]string `json:"Principal,omitempty"`
+	Action    []string          `json:"Action"`
+	Resource  []string          `json:"Resource,omitempty"`
+	Condition Condition         `json:"Condition,omitempty"`
+}
+
+// Condition maps condition operators, such as IpAddress, to the values of their condition keys.
+type Condition map[string]map[string]interface{}
+
+// String returns the JSON encoding of the policy document.
+func (document PolicyDocument) String() string {
+	data, err := json.Marshal(document)
+	if err != nil {
+		// Policy documents only hold strings, maps and slices, which always encode
+		panic(err)
+	}
+	return string(data)
+}
+
+// PolicyConditions restricts the requests allowed by a bucket policy. The zero value adds no condition.
+type PolicyConditions struct {
+	SourceCIDRs            []string  // Networks requests must come from, any network when empty
+	RequireSecureTransport bool      // Whether requests must use HTTPS
+	ExpiresAt              time.Time // Time after which requests are denied, never when zero
+}
+
+// IsZero reports whether the conditions allow all requests.
+func (conditions PolicyConditions) IsZero() bool {
+	return len(conditions.SourceCIDRs) == 0 && !conditions.RequireSecureTransport && conditions.ExpiresAt.IsZero()
+}
+
+func (conditions PolicyConditions) condition() Condition {
+	if conditions.IsZero() {
+		return nil
+	}
+	condition := Condition{}
+	if len(conditions.SourceCIDRs) > 0 {
+		condition["IpAddress"] = map[string]interface{}{"aws:SourceIp": conditions.SourceCIDRs}
+	}
+	if conditions.RequireSecureTransport {
+		condition["Bool"] = map[string]interface{}{"aws:SecureTransport": "true"}
+	}
+	if !conditions.ExpiresAt.IsZero() {
+		condition["DateLessThan"] = map[string]interface{}{"aws:CurrentTime": conditions.ExpiresAt.UTC().Format(time.RFC3339)}
+	}
+	return condition
+}
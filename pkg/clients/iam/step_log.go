@@ -0,0 +1,64 @@
+package iamclient
+
+import (
+	"context"
+	"time"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// rollbackTimeout bounds the compensating actions run after a failure, which may be caused by the
+// cancellation of the request context
+const rollbackTimeout = 30 * time.Second
+
+// stepLog records the completed steps of an IAM operation with the actions undoing them, so that a
+// failing operation does not leave orphan users, roles or policies behind.
+type stepLog struct {
+	operation string
+	resource  string
+	steps     []step
+}
+
+type step struct {
+	name string
+	undo func(ctx context.Context) error
+}
+
+func newStepLog(operation, resource string) *stepLog {
+	return &stepLog{operation: operation, resource: resource}
+}
+
+// done records a completed step and the action undoing it.
+func (l *stepLog) done(name string, undo func(ctx context.Context) error) {
+	l.steps = append(l.steps, step{name: name, undo: undo})
+}
+
+// rollback undoes the completed steps in reverse order, after the operation failed with cause.
+// Compensating actions are best effort: failures are logged and counted, and the next steps are still undone.
+func (l *stepLog) rollback(ctx context.Context, cause error) {
+	if len(l.steps) == 0 {
+		return
+	}
+	klog.V(c.LvlInfo).InfoS("Rolling back partially completed IAM operation", "operation", l.operation, "resource", l.resource,
+		"steps", len(l.steps), "cause", cause.Error())
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	for i := len(l.steps) - 1; i >= 0; i-- {
+		step := l.steps[i]
+		status := "success"
+		if err := step.undo(ctx); err != nil {
+			status = "failure"
+			klog.ErrorS(err, "Failed to roll back IAM step", "operation", l.operation, "resource", l.resource, "step", step.name)
+		} else {
+			klog.V(c.LvlInfo).InfoS("Rolled back IAM step", "operation", l.operation, "resource", l.resource, "step", step.name)
+		}
+		if metrics.IAMRollbacksTotal != nil {
+			metrics.IAMRollbacksTotal.WithLabelValues(step.name, status).Inc()
+		}
+	}
+	l.steps = nil
+}
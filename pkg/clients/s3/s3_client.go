@@ -2,18 +2,18 @@ package s3client
 
 import (
 	"context"
-	"net/http"
 	"os"
-	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go/logging"
 	"github.com/aws/smithy-go/middleware"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
+	"github.com/scality/cosi-driver/pkg/failover"
 	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
 	"github.com/scality/cosi-driver/pkg/util"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 )
@@ -37,24 +37,33 @@ var InitS3Client = func(ctx context.Context, params util.StorageClientParameters
 		logger = nil
 	}
 
-	httpClient := &http.Client{
-		Timeout: util.DefaultRequestTimeout,
+	httpClient := util.NewHTTPClient(params.Endpoint, params)
+
+	limiter := ratelimit.Limiters.Backend(params.Endpoint)
+	apiOptions := []func(*middleware.Stack) error{
+		func(stack *middleware.Stack) error {
+			return metrics.AttachPrometheusMiddleware(stack, metrics.S3RequestDuration, metrics.S3RequestsTotal)
+		},
+		func(stack *middleware.Stack) error {
+			return ratelimit.AttachRateLimitMiddleware(stack, limiter)
+		},
 	}
 
-	if strings.HasPrefix(params.Endpoint, "https://") {
-		httpClient.Transport = util.ConfigureTLSTransport(params.TLSCert)
+	// With several endpoints, each attempt goes to a healthy endpoint and failures are reported back
+	if len(params.Endpoints) > 1 {
+		pool := failover.Pools.Pool("S3", params.Endpoints, util.HTTPClientKey(params), httpClient)
+		apiOptions = append(apiOptions, func(stack *middleware.Stack) error {
+			return failover.AttachFailoverMiddleware(stack, pool)
+		})
 	}
 
 	awsCfg, err := LoadAWSConfig(ctx,
 		config.WithRegion(params.Region),
-		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(params.AccessKeyID, params.SecretAccessKey, "")),
+		config.WithCredentialsProvider(stsclient.CredentialsProvider(params)),
 		config.WithHTTPClient(httpClient),
+		config.WithRetryer(util.NewRetryer(params)),
 		config.WithLogger(logger),
-		config.WithAPIOptions([]func(*middleware.Stack) error{
-			func(stack *middleware.Stack) error {
-				return metrics.AttachPrometheusMiddleware(stack, metrics.S3RequestDuration, metrics.S3RequestsTotal)
-			},
-		}),
+		config.WithAPIOptions(apiOptions),
 	)
 	if err != nil {
 		return nil, err
@@ -62,7 +71,7 @@ var InitS3Client = func(ctx context.Context, params util.StorageClientParameters
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
 	s3Client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
-		o.UsePathStyle = true
+		o.UsePathStyle = params.ResolvedAddressingStyle() == util.AddressingStylePath
 		o.BaseEndpoint = aws.String(params.Endpoint)
 	})
 
@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -13,7 +16,9 @@ import (
 	"github.com/aws/smithy-go"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
 	s3client "github.com/scality/cosi-driver/pkg/clients/s3"
+	"github.com/scality/cosi-driver/pkg/metrics"
 	"github.com/scality/cosi-driver/pkg/mock"
 	"github.com/scality/cosi-driver/pkg/util"
 )
@@ -54,6 +59,27 @@ var _ = Describe("S3Client", func() {
 			Expect(opts.Region).To(Equal("us-east-1"))
 		})
 
+		It("should use path-style addressing by default", func(ctx SpecContext) {
+			client, err := s3client.InitS3Client(ctx, params)
+			Expect(err).To(BeNil())
+			Expect(client.S3Service.(*s3.Client).Options().UsePathStyle).To(BeTrue())
+		})
+
+		It("should use virtual-hosted-style addressing when configured", func(ctx SpecContext) {
+			params.AddressingStyle = util.AddressingStyleVirtual
+			client, err := s3client.InitS3Client(ctx, params)
+			Expect(err).To(BeNil())
+			Expect(client.S3Service.(*s3.Client).Options().UsePathStyle).To(BeFalse())
+		})
+
+		It("should use the configured retry policy", func(ctx SpecContext) {
+			params.MaxAttempts = 6
+			client, err := s3client.InitS3Client(ctx, params)
+			Expect(err).To(BeNil())
+			opts := client.S3Service.(*s3.Client).Options()
+			Expect(opts.Retryer.MaxAttempts()).To(Equal(6))
+		})
+
 		It("should return an error if AWS config loading fails", func(ctx SpecContext) {
 			originalLoadAWSConfig := s3client.LoadAWSConfig
 			defer func() { s3client.LoadAWSConfig = originalLoadAWSConfig }()
@@ -93,6 +119,35 @@ var _ = Describe("S3Client", func() {
 		})
 	})
 
+	Describe("Endpoint failover", func() {
+		var unavailable, healthy *httptest.Server
+
+		BeforeEach(func() {
+			metrics.InitializeMetrics("test_s3_failover", prometheus.NewRegistry())
+			unavailable = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			healthy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			params.Endpoint = unavailable.URL
+			params.Endpoints = []string{unavailable.URL, healthy.URL}
+			params.MaxBackoff = time.Millisecond
+		})
+
+		AfterEach(func() {
+			unavailable.Close()
+			healthy.Close()
+		})
+
+		It("should retry on the next endpoint when the first one fails", func(ctx SpecContext) {
+			client, err := s3client.InitS3Client(ctx, params)
+			Expect(err).To(BeNil())
+
+			Expect(client.DeleteBucket(ctx, "failover-bucket")).To(Succeed())
+		})
+	})
+
 	Describe("CreateBucket", func() {
 		var mockS3 *mock.MockS3Client
 
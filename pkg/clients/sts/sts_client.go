@@ -0,0 +1,163 @@
+package stsclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/aws/smithy-go/logging"
+	"github.com/aws/smithy-go/middleware"
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+	"github.com/scality/cosi-driver/pkg/util"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"k8s.io/klog/v2"
+)
+
+type STSAPI interface {
+	AssumeRole(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	GetCallerIdentity(ctx context.Context, input *sts.GetCallerIdentityInput, opts ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+type STSClient struct {
+	STSService STSAPI
+}
+
+var LoadAWSConfig = config.LoadDefaultConfig
+
+var InitSTSClient = func(ctx context.Context, params util.StorageClientParameters) (*STSClient, error) {
+	var logger logging.Logger
+	if params.Debug {
+		logger = logging.NewStandardLogger(os.Stdout)
+	} else {
+		logger = nil
+	}
+
+	endpoint := params.STSEndpoint
+	if endpoint == "" {
+		endpoint = params.IAMEndpoint
+	}
+
+	awsCfg, err := LoadAWSConfig(ctx,
+		config.WithRegion(params.Region),
+		config.WithCredentialsProvider(CredentialsProvider(params)),
+		config.WithHTTPClient(util.NewHTTPClient(endpoint, params)),
+		config.WithRetryer(util.NewRetryer(params)),
+		config.WithLogger(logger),
+		config.WithAPIOptions(apiOptions(endpoint)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
+
+	stsClient := sts.NewFromConfig(awsCfg, func(o *sts.Options) {
+		o.BaseEndpoint = &endpoint
+	})
+
+	return &STSClient{
+		STSService: stsClient,
+	}, nil
+}
+
+// apiOptions reports STS requests in the metrics and makes them wait for the limiter of the endpoint,
+// shared with the IAM clients when STS is served by the IAM endpoint.
+func apiOptions(endpoint string) []func(*middleware.Stack) error {
+	limiter := ratelimit.Limiters.Backend(endpoint)
+	return []func(*middleware.Stack) error{
+		func(stack *middleware.Stack) error {
+			return metrics.AttachPrometheusMiddleware(stack, metrics.STSRequestDuration, metrics.STSRequestsTotal)
+		},
+		func(stack *middleware.Stack) error {
+			return ratelimit.AttachRateLimitMiddleware(stack, limiter)
+		},
+	}
+}
+
+// AssumeRole returns temporary credentials of the role, valid for the given duration.
+func (client *STSClient) AssumeRole(ctx context.Context, roleArn, sessionName string, duration time.Duration) (*types.Credentials, error) {
+	output, err := client.STSService.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         &roleArn,
+		RoleSessionName: &sessionName,
+		DurationSeconds: aws.Int32(int32(duration.Seconds())),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Credentials, nil
+}
+
+// GetCallerAccount returns the account of the identity used by the driver.
+func (client *STSClient) GetCallerAccount(ctx context.Context) (string, error) {
+	output, err := client.STSService.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(output.Account), nil
+}
+
+// RoleSessionName identifies the driver in the sessions created when assuming a role
+const RoleSessionName = "scality-cosi-driver"
+
+// S3/IAM clients are rebuilt for every request, so web identity credentials are cached per role
+// to avoid calling AssumeRoleWithWebIdentity each time. The cache refreshes them before expiry.
+var (
+	providersMu sync.Mutex
+	providers   = map[string]*aws.CredentialsCache{}
+)
+
+// NewWebIdentityRoleProvider builds the provider assuming the role with the token file. It is a variable for testing.
+var NewWebIdentityRoleProvider = func(params util.StorageClientParameters) aws.CredentialsProvider {
+	stsClient := sts.New(sts.Options{
+		Region:       params.Region,
+		BaseEndpoint: aws.String(params.STSEndpoint),
+		HTTPClient:   util.NewHTTPClient(params.STSEndpoint, params),
+		Retryer:      util.NewRetryer(params)(),
+		APIOptions:   apiOptions(params.STSEndpoint),
+	})
+	return stscreds.NewWebIdentityRoleProvider(stsClient, params.RoleARN, stscreds.IdentityTokenFile(params.WebIdentityTokenFile),
+		func(o *stscreds.WebIdentityRoleOptions) {
+			o.RoleSessionName = RoleSessionName
+		})
+}
+
+// CredentialsProvider returns the credentials used by S3/IAM clients: the static keys of the
+// secret, or temporary credentials of RoleARN obtained with the web identity token.
+func CredentialsProvider(params util.StorageClientParameters) aws.CredentialsProvider {
+	if params.RoleARN == "" {
+		return credentials.NewStaticCredentialsProvider(params.AccessKeyID, params.SecretAccessKey, "")
+	}
+
+	key := providerKey(params)
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if provider, ok := providers[key]; ok {
+		return provider
+	}
+	klog.V(c.LvlInfo).InfoS("Using web identity credentials", "roleArn", params.RoleARN, "stsEndpoint", params.STSEndpoint, "tokenFile", params.WebIdentityTokenFile)
+	provider := aws.NewCredentialsCache(NewWebIdentityRoleProvider(params))
+	providers[key] = provider
+	return provider
+}
+
+// providerKey identifies the settings a cached provider was built with, including the TLS
+// certificates so that a rotated CA bundle leads to a new STS client.
+func providerKey(params util.StorageClientParameters) string {
+	certHash := sha256.Sum256(params.TLSCert)
+	return strings.Join([]string{
+		params.RoleARN, params.WebIdentityTokenFile, params.STSEndpoint, params.Region,
+		params.HTTPProxy, params.NoProxy, hex.EncodeToString(certHash[:]),
+	}, "|")
+}
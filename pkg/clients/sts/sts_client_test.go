@@ -0,0 +1,181 @@
+package stsclient_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/mock"
+	"github.com/scality/cosi-driver/pkg/util"
+)
+
+func TestSTSClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "STSClient Test Suite")
+}
+
+const assumeRoleWithWebIdentityResponse = `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>session-access-key</AccessKeyId>
+      <SecretAccessKey>session-secret-key</SecretAccessKey>
+      <SessionToken>session-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+
+var _ = Describe("CredentialsProvider", func() {
+	var params util.StorageClientParameters
+
+	BeforeEach(func() {
+		params = *util.NewStorageClientParameters()
+		params.Endpoint = "https://s3.mock.endpoint"
+		params.IAMEndpoint = "https://iam.mock.endpoint"
+	})
+
+	It("should return the static keys when no role is configured", func(ctx SpecContext) {
+		params.AccessKeyID = "test-access-key"
+		params.SecretAccessKey = "test-secret-key"
+
+		creds, err := stsclient.CredentialsProvider(params).Retrieve(ctx)
+		Expect(err).To(BeNil())
+		Expect(creds.AccessKeyID).To(Equal("test-access-key"))
+		Expect(creds.SecretAccessKey).To(Equal("test-secret-key"))
+		Expect(creds.SessionToken).To(BeEmpty())
+	})
+
+	Context("with a role to assume", func() {
+		var (
+			originalNewWebIdentityRoleProvider func(util.StorageClientParameters) aws.CredentialsProvider
+			builtProviders                     int
+		)
+
+		BeforeEach(func() {
+			originalNewWebIdentityRoleProvider = stsclient.NewWebIdentityRoleProvider
+			builtProviders = 0
+			stsclient.NewWebIdentityRoleProvider = func(params util.StorageClientParameters) aws.CredentialsProvider {
+				builtProviders++
+				return aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+					return aws.Credentials{AccessKeyID: params.RoleARN, SecretAccessKey: "secret", SessionToken: "token"}, nil
+				})
+			}
+			// providers are cached for the lifetime of the process, so every spec uses its own role
+			params.RoleARN = fmt.Sprintf("arn:aws:iam::123456789012:role/cosi-%d", time.Now().UnixNano())
+			params.WebIdentityTokenFile = "/var/run/secrets/token"
+			params.STSEndpoint = "https://sts.mock.endpoint"
+		})
+
+		AfterEach(func() {
+			stsclient.NewWebIdentityRoleProvider = originalNewWebIdentityRoleProvider
+		})
+
+		It("should reuse the provider of the same role across clients", func(ctx SpecContext) {
+			first := stsclient.CredentialsProvider(params)
+			second := stsclient.CredentialsProvider(params)
+			Expect(second).To(BeIdenticalTo(first))
+			Expect(builtProviders).To(Equal(1))
+
+			creds, err := first.Retrieve(ctx)
+			Expect(err).To(BeNil())
+			Expect(creds.AccessKeyID).To(Equal(params.RoleARN))
+		})
+
+		It("should build a new provider when the role or TLS settings change", func() {
+			first := stsclient.CredentialsProvider(params)
+
+			params.RoleARN += "-other"
+			Expect(stsclient.CredentialsProvider(params)).NotTo(BeIdenticalTo(first))
+
+			params.TLSCert = []byte("rotated-ca")
+			Expect(stsclient.CredentialsProvider(params)).NotTo(BeIdenticalTo(first))
+			Expect(builtProviders).To(Equal(3))
+		})
+	})
+
+	It("should assume the role with the web identity token", func(ctx SpecContext) {
+		metrics.InitializeMetrics("test_sts", prometheus.NewRegistry())
+		tokenFile := filepath.Join(GinkgoT().TempDir(), "token")
+		Expect(os.WriteFile(tokenFile, []byte("projected-sa-token"), 0o600)).To(Succeed())
+
+		var form map[string][]string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			form = r.PostForm
+			w.Header().Set("Content-Type", "text/xml")
+			_, _ = w.Write([]byte(assumeRoleWithWebIdentityResponse))
+		}))
+		defer server.Close()
+
+		params.RoleARN = "arn:aws:iam::123456789012:role/cosi-driver"
+		params.WebIdentityTokenFile = tokenFile
+		params.STSEndpoint = server.URL
+
+		creds, err := stsclient.CredentialsProvider(params).Retrieve(ctx)
+		Expect(err).To(BeNil())
+		Expect(creds.AccessKeyID).To(Equal("session-access-key"))
+		Expect(creds.SessionToken).To(Equal("session-token"))
+		Expect(creds.CanExpire).To(BeTrue())
+
+		Expect(form["Action"]).To(ConsistOf("AssumeRoleWithWebIdentity"))
+		Expect(form["RoleArn"]).To(ConsistOf(params.RoleARN))
+		Expect(form["WebIdentityToken"]).To(ConsistOf("projected-sa-token"))
+		Expect(form["RoleSessionName"]).To(ConsistOf(stsclient.RoleSessionName))
+		Expect(testutil.ToFloat64(metrics.STSRequestsTotal.WithLabelValues("AssumeRoleWithWebIdentity", "success", "", "200"))).To(Equal(1.0))
+	})
+})
+
+var _ = Describe("STSClient", func() {
+	var (
+		mockSTS *mock.MockSTSClient
+		client  *stsclient.STSClient
+	)
+
+	BeforeEach(func() {
+		mockSTS = &mock.MockSTSClient{}
+		client = &stsclient.STSClient{STSService: mockSTS}
+	})
+
+	It("should assume a role for the requested duration", func(ctx SpecContext) {
+		mockSTS.AssumeRoleFunc = func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+			Expect(*input.RoleArn).To(Equal("arn:aws:iam::123456789012:role/test-role"))
+			Expect(*input.RoleSessionName).To(Equal("test-role"))
+			Expect(*input.DurationSeconds).To(Equal(int32(1800)))
+			return &sts.AssumeRoleOutput{Credentials: &types.Credentials{SessionToken: aws.String("token")}}, nil
+		}
+
+		credentials, err := client.AssumeRole(ctx, "arn:aws:iam::123456789012:role/test-role", "test-role", 30*time.Minute)
+		Expect(err).To(BeNil())
+		Expect(*credentials.SessionToken).To(Equal("token"))
+	})
+
+	It("should return an error if the role cannot be assumed", func(ctx SpecContext) {
+		mockSTS.AssumeRoleFunc = func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+			return nil, errors.New("access denied")
+		}
+
+		_, err := client.AssumeRole(ctx, "arn", "test-role", time.Hour)
+		Expect(err).To(MatchError("access denied"))
+	})
+
+	It("should return the account of the caller", func(ctx SpecContext) {
+		account, err := client.GetCallerAccount(ctx)
+		Expect(err).To(BeNil())
+		Expect(account).To(Equal("123456789012"))
+	})
+})
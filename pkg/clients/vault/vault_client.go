@@ -0,0 +1,266 @@
+package vaultclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+	"github.com/scality/cosi-driver/pkg/util"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// apiVersion is the version of the Vault administration API
+	apiVersion = "2010-05-08"
+	// signingService is the service name Vault expects in the SigV4 signature of administration requests
+	signingService = "iam"
+)
+
+// Account is a Vault account, which owns its buckets, users and policies.
+type Account struct {
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Arn          string `json:"arn"`
+	CanonicalID  string `json:"canonicalId"`
+	EmailAddress string `json:"emailAddress"`
+}
+
+// AccessKey is an access key of a Vault account.
+type AccessKey struct {
+	AccessKeyID     string `json:"id"`
+	SecretAccessKey string `json:"value"`
+}
+
+// VaultClient calls the administration API of Scality Vault, which manages accounts. Requests wait
+// for the limiter of the endpoint, and failed attempts are retried with the retryer, like the
+// requests of the AWS SDK clients.
+type VaultClient struct {
+	Endpoint    string
+	Region      string
+	HTTPClient  *http.Client
+	Credentials aws.CredentialsProvider
+	Signer      *v4.Signer
+	Retryer     aws.Retryer
+	Limiter     *ratelimit.Limiter
+}
+
+var InitVaultClient = func(ctx context.Context, params util.StorageClientParameters) (*VaultClient, error) {
+	if params.VaultEndpoint == "" {
+		return nil, errors.New("vaultEndpoint is required to manage Vault accounts")
+	}
+	if params.VaultAccessKeyID == "" || params.VaultSecretAccessKey == "" {
+		return nil, errors.New("vaultAccessKeyId and vaultSecretAccessKey are required to manage Vault accounts")
+	}
+
+	return &VaultClient{
+		Endpoint:    params.VaultEndpoint,
+		Region:      params.Region,
+		HTTPClient:  util.NewHTTPClient(params.VaultEndpoint, params),
+		Credentials: aws.NewCredentialsCache(credentialsProvider(params)),
+		Signer:      v4.NewSigner(),
+		Retryer:     util.NewRetryer(params)(),
+		Limiter:     ratelimit.Limiters.Backend(params.VaultEndpoint),
+	}, nil
+}
+
+func credentialsProvider(params util.StorageClientParameters) aws.CredentialsProviderFunc {
+	return func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: params.VaultAccessKeyID, SecretAccessKey: params.VaultSecretAccessKey}, nil
+	}
+}
+
+// CreateAccount creates a Vault account.
+func (client *VaultClient) CreateAccount(ctx context.Context, name, emailAddress string) (*Account, error) {
+	var output struct {
+		Account struct {
+			Data Account `json:"data"`
+		} `json:"account"`
+	}
+	err := client.call(ctx, "CreateAccount", url.Values{"name": {name}, "emailAddress": {emailAddress}}, &output)
+	if err != nil {
+		return nil, err
+	}
+	klog.V(c.LvlInfo).InfoS("Successfully created Vault account", "accountName", name)
+	return &output.Account.Data, nil
+}
+
+// GetAccount returns the Vault account with the given name.
+func (client *VaultClient) GetAccount(ctx context.Context, name string) (*Account, error) {
+	var account Account
+	if err := client.call(ctx, "GetAccount", url.Values{"accountName": {name}}, &account); err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// EnsureAccount creates the Vault account, or returns it if it already exists.
+func (client *VaultClient) EnsureAccount(ctx context.Context, name, emailAddress string) (*Account, error) {
+	account, err := client.CreateAccount(ctx, name, emailAddress)
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "EntityAlreadyExists" {
+		klog.V(c.LvlDebug).InfoS("Vault account already exists, reusing it", "accountName", name)
+		return client.GetAccount(ctx, name)
+	}
+	return account, err
+}
+
+// GenerateAccountAccessKey creates an access key for the Vault account.
+func (client *VaultClient) GenerateAccountAccessKey(ctx context.Context, accountName string) (*AccessKey, error) {
+	var accessKey AccessKey
+	if err := client.call(ctx, "GenerateAccountAccessKey", url.Values{"AccountName": {accountName}}, &accessKey); err != nil {
+		return nil, err
+	}
+	klog.V(c.LvlInfo).InfoS("Successfully generated Vault account access key", "accountName", accountName, "accessKeyId", accessKey.AccessKeyID)
+	return &accessKey, nil
+}
+
+// DeleteAccessKey deletes an access key of a Vault account.
+func (client *VaultClient) DeleteAccessKey(ctx context.Context, accessKeyID string) error {
+	if err := client.call(ctx, "DeleteAccessKey", url.Values{"AccessKeyId": {accessKeyID}}, nil); err != nil {
+		return err
+	}
+	klog.V(c.LvlInfo).InfoS("Successfully deleted Vault account access key", "accessKeyId", accessKeyID)
+	return nil
+}
+
+// errorResponse is the error document returned by Vault, in the format of the IAM API
+type errorResponse struct {
+	Error struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+// responseError is an error returned by Vault. Its HTTP status lets the retryer retry server errors.
+type responseError struct {
+	*smithy.GenericAPIError
+	statusCode int
+}
+
+func (e *responseError) HTTPStatusCode() int { return e.statusCode }
+
+// call sends a signed administration request and decodes its JSON response into output, unless output is nil.
+// Errors reported by Vault are returned as smithy.APIError, like the errors of the AWS SDK.
+func (client *VaultClient) call(ctx context.Context, action string, parameters url.Values, output interface{}) error {
+	parameters.Set("Action", action)
+	parameters.Set("Version", apiVersion)
+	body := parameters.Encode()
+
+	var data []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		if data, err = client.send(ctx, action, body); err == nil || !client.retry(ctx, action, attempt, err) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if output == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, output); err != nil {
+		return fmt.Errorf("failed to decode Vault %s response: %w", action, err)
+	}
+	return nil
+}
+
+// send makes one attempt of a request, once the limiter of the endpoint lets it through, and returns the response body.
+func (client *VaultClient) send(ctx context.Context, action, body string) ([]byte, error) {
+	release, err := client.Limiter.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, client.Endpoint, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	request.Header.Set("Accept", "application/json")
+
+	credentials, err := client.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := sha256.Sum256([]byte(body))
+	err = client.Signer.SignHTTP(ctx, credentials, request, hex.EncodeToString(payloadHash[:]), signingService, client.Region, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign Vault request: %w", err)
+	}
+
+	klog.V(c.LvlTrace).InfoS("Calling Vault administration API", "action", action, "endpoint", client.Endpoint)
+	start := time.Now()
+	statusCode, data, err := client.do(request)
+	metrics.ObserveRequest(metrics.VaultRequestDuration, metrics.VaultRequestsTotal, action, statusCode, time.Since(start), err)
+	if err != nil {
+		klog.ErrorS(err, "Vault request failed", "action", action)
+	}
+	return data, err
+}
+
+func (client *VaultClient) do(request *http.Request) (int, []byte, error) {
+	response, err := client.HTTPClient.Do(request)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return response.StatusCode, nil, err
+	}
+	if response.StatusCode >= http.StatusBadRequest {
+		return response.StatusCode, nil, parseError(response.StatusCode, data)
+	}
+	return response.StatusCode, data, nil
+}
+
+// retry waits before the next attempt of a request that failed with err, and reports whether to make it.
+func (client *VaultClient) retry(ctx context.Context, action string, attempt int, err error) bool {
+	if client.Retryer == nil || attempt >= client.Retryer.MaxAttempts() || !client.Retryer.IsErrorRetryable(err) {
+		return false
+	}
+	delay, delayErr := client.Retryer.RetryDelay(attempt, err)
+	if delayErr != nil {
+		return false
+	}
+	klog.V(c.LvlDebug).InfoS("Retrying Vault request", "action", action, "attempt", attempt, "delay", delay, "error", err)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func parseError(statusCode int, data []byte) error {
+	var response errorResponse
+	if err := xml.Unmarshal(bytes.TrimSpace(data), &response); err == nil && response.Error.Code != "" {
+		return &responseError{GenericAPIError: &smithy.GenericAPIError{Code: response.Error.Code, Message: response.Error.Message}, statusCode: statusCode}
+	}
+	return &responseError{
+		GenericAPIError: &smithy.GenericAPIError{Code: strings.ReplaceAll(http.StatusText(statusCode), " ", ""), Message: string(data)},
+		statusCode:      statusCode,
+	}
+}
@@ -0,0 +1,215 @@
+package vaultclient_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	vaultclient "github.com/scality/cosi-driver/pkg/clients/vault"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+	"github.com/scality/cosi-driver/pkg/util"
+)
+
+func TestVaultClient(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "VaultClient Test Suite")
+}
+
+const accountExistsResponse = `<ErrorResponse>
+  <Error>
+    <Code>EntityAlreadyExists</Code>
+    <Message>The request was rejected because it attempted to create a resource that already exists.</Message>
+  </Error>
+</ErrorResponse>`
+
+var _ = Describe("VaultClient", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests []*http.Request
+		forms    []map[string]string
+		client   *vaultclient.VaultClient
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		requests, forms = nil, nil
+		handler = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.ParseForm()).To(Succeed())
+			form := map[string]string{}
+			for key := range r.PostForm {
+				form[key] = r.PostForm.Get(key)
+			}
+			requests = append(requests, r)
+			forms = append(forms, form)
+			handler(w, r)
+		}))
+
+		var err error
+		client, err = vaultclient.InitVaultClient(ctx, util.StorageClientParameters{
+			Region:               "us-east-1",
+			VaultEndpoint:        server.URL,
+			VaultAccessKeyID:     "vault-admin-key",
+			VaultSecretAccessKey: "vault-admin-secret",
+		})
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should require the Vault endpoint and keys", func(ctx SpecContext) {
+		_, err := vaultclient.InitVaultClient(ctx, util.StorageClientParameters{VaultEndpoint: server.URL})
+		Expect(err).NotTo(BeNil())
+		_, err = vaultclient.InitVaultClient(ctx, util.StorageClientParameters{VaultAccessKeyID: "key", VaultSecretAccessKey: "secret"})
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("should create an account with a signed request", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"account":{"data":{"id":"123456789012","name":"cosi-team-a","arn":"arn:aws:iam::123456789012:/cosi-team-a/"}}}`)
+		}
+
+		account, err := client.CreateAccount(ctx, "cosi-team-a", "cosi-team-a@example.com")
+		Expect(err).To(BeNil())
+		Expect(account.ID).To(Equal("123456789012"))
+		Expect(account.Name).To(Equal("cosi-team-a"))
+		Expect(forms[0]).To(Equal(map[string]string{
+			"Action":       "CreateAccount",
+			"Version":      "2010-05-08",
+			"name":         "cosi-team-a",
+			"emailAddress": "cosi-team-a@example.com",
+		}))
+		authorization := requests[0].Header.Get("Authorization")
+		Expect(authorization).To(HavePrefix("AWS4-HMAC-SHA256 Credential=vault-admin-key/"))
+		Expect(authorization).To(ContainSubstring("/us-east-1/iam/aws4_request"))
+	})
+
+	It("should return an existing account", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if r.PostForm.Get("Action") == "CreateAccount" {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, accountExistsResponse)
+				return
+			}
+			fmt.Fprint(w, `{"id":"123456789012","name":"cosi-team-a"}`)
+		}
+
+		account, err := client.EnsureAccount(ctx, "cosi-team-a", "cosi-team-a@example.com")
+		Expect(err).To(BeNil())
+		Expect(account.ID).To(Equal("123456789012"))
+		Expect(forms[1]["Action"]).To(Equal("GetAccount"))
+		Expect(forms[1]["accountName"]).To(Equal("cosi-team-a"))
+	})
+
+	It("should return Vault errors as API errors", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, accountExistsResponse)
+		}
+
+		_, err := client.CreateAccount(ctx, "cosi-team-a", "cosi-team-a@example.com")
+		var apiErr smithy.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.ErrorCode()).To(Equal("EntityAlreadyExists"))
+	})
+
+	It("should name errors without a document after their HTTP status", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+
+		_, err := client.GetAccount(ctx, "cosi-team-a")
+		var apiErr smithy.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.ErrorCode()).To(Equal("Forbidden"))
+	})
+
+	It("should generate account access keys", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"id":"ACCOUNTKEY","value":"account-secret","status":"Active"}`)
+		}
+
+		accessKey, err := client.GenerateAccountAccessKey(ctx, "cosi-team-a")
+		Expect(err).To(BeNil())
+		Expect(accessKey.AccessKeyID).To(Equal("ACCOUNTKEY"))
+		Expect(accessKey.SecretAccessKey).To(Equal("account-secret"))
+		Expect(forms[0]["AccountName"]).To(Equal("cosi-team-a"))
+	})
+
+	It("should delete access keys", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {}
+
+		Expect(client.DeleteAccessKey(ctx, "ACCOUNTKEY")).To(Succeed())
+		Expect(forms[0]["Action"]).To(Equal("DeleteAccessKey"))
+		Expect(forms[0]["AccessKeyId"]).To(Equal("ACCOUNTKEY"))
+	})
+
+	It("should retry server errors and report each attempt in the metrics", func(ctx SpecContext) {
+		metrics.InitializeMetrics("test_vault", prometheus.NewRegistry())
+		client.Retryer = util.NewRetryer(util.StorageClientParameters{MaxBackoff: 10 * time.Millisecond})()
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			if len(requests) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{"id":"123456789012","name":"cosi-team-a"}`)
+		}
+
+		account, err := client.GetAccount(ctx, "cosi-team-a")
+		Expect(err).To(BeNil())
+		Expect(account.ID).To(Equal("123456789012"))
+		Expect(requests).To(HaveLen(2))
+		Expect(testutil.CollectAndCount(metrics.VaultRequestsTotal)).To(Equal(2))
+		Expect(testutil.ToFloat64(metrics.VaultRequestsTotal.WithLabelValues("GetAccount", "success", "", "200"))).To(Equal(1.0))
+	})
+
+	It("should not retry client errors", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, accountExistsResponse)
+		}
+
+		_, err := client.CreateAccount(ctx, "cosi-team-a", "cosi-team-a@example.com")
+		Expect(err).NotTo(BeNil())
+		Expect(requests).To(HaveLen(1))
+	})
+
+	It("should wait for the limiter of the endpoint", func(ctx SpecContext) {
+		client.Limiter = ratelimit.NewLimiter(server.URL, ratelimit.Config{MaxConcurrent: 1})
+		release, err := client.Limiter.Acquire(ctx)
+		Expect(err).To(BeNil())
+		handler = func(w http.ResponseWriter, r *http.Request) {}
+
+		// The request waits for the slot held above
+		deleted := make(chan error, 1)
+		go func() { deleted <- client.DeleteAccessKey(ctx, "ACCOUNTKEY") }()
+		Consistently(deleted, 100*time.Millisecond).ShouldNot(Receive())
+
+		release()
+		Expect(<-deleted).To(Succeed())
+		Expect(forms).To(HaveLen(1))
+		Expect(forms[0]["AccessKeyId"]).To(Equal("ACCOUNTKEY"))
+	}, SpecTimeout(5*time.Second))
+
+	It("should fail on responses that are not JSON", func(ctx SpecContext) {
+		handler = func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<html></html>")
+		}
+
+		_, err := client.GetAccount(ctx, "cosi-team-a")
+		Expect(err).NotTo(BeNil())
+		Expect(strings.Contains(err.Error(), "GetAccount")).To(BeTrue())
+	})
+})
@@ -18,4 +18,6 @@ const (
 	ActionDeleteBucket       = "DeleteBucket"
 	ActionGrantBucketAccess  = "GrantBucketAccess"
 	ActionRevokeBucketAccess = "RevokeBucketAccess"
+	ActionRotateAccessKey    = "RotateAccessKey"
+	ActionRefreshSession     = "RefreshSessionCredentials"
 )
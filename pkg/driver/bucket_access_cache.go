@@ -0,0 +1,116 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientset "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned"
+	bucketinformers "sigs.k8s.io/container-object-storage-interface-api/client/informers/externalversions"
+	bucketlisters "sigs.k8s.io/container-object-storage-interface-api/client/listers/objectstorage/v1alpha1"
+)
+
+// accountIndex indexes BucketAccesses by the account name the COSI sidecar derives from their UID.
+const accountIndex = "account"
+
+// bucketAccessCache serves the BucketAccesses and BucketAccessClasses from shared informers, so that
+// grants and the periodic checks do not list them from the API server every time. The informers are
+// started on first use. The zero value is ready to use. Objects returned by the cache must not be modified.
+type bucketAccessCache struct {
+	mu       sync.Mutex
+	stop     chan struct{}
+	accesses cache.Indexer
+	classes  bucketlisters.BucketAccessClassLister
+	synced   []cache.InformerSynced
+}
+
+// start starts the informers if needed, and waits for their first sync.
+func (c *bucketAccessCache) start(ctx context.Context, clientset bucketclientset.Interface) error {
+	c.mu.Lock()
+	if c.stop == nil {
+		factory := bucketinformers.NewSharedInformerFactory(clientset, 0)
+		accesses := factory.Objectstorage().V1alpha1().BucketAccesses()
+		if err := accesses.Informer().AddIndexers(cache.Indexers{accountIndex: func(obj interface{}) ([]string, error) {
+			access, ok := obj.(*bucketv1alpha1.BucketAccess)
+			if !ok {
+				return nil, nil
+			}
+			return []string{bucketAccessAccountPrefix + string(access.UID)}, nil
+		}}); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		classes := factory.Objectstorage().V1alpha1().BucketAccessClasses()
+
+		c.accesses = accesses.Informer().GetIndexer()
+		c.classes = classes.Lister()
+		c.synced = []cache.InformerSynced{accesses.Informer().HasSynced, classes.Informer().HasSynced}
+		c.stop = make(chan struct{})
+		factory.Start(c.stop)
+		klog.V(constants.LvlDebug).InfoS("Started watching BucketAccesses and BucketAccessClasses")
+	}
+	synced := c.synced
+	c.mu.Unlock()
+
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		return fmt.Errorf("timed out waiting for BucketAccesses to sync")
+	}
+	return nil
+}
+
+// Stop stops the informers. The cache can be reused afterwards.
+func (c *bucketAccessCache) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// bucketAccessByAccount returns the BucketAccess the COSI sidecar named accountName after, or nil.
+func (c *bucketAccessCache) bucketAccessByAccount(accountName string) (*bucketv1alpha1.BucketAccess, error) {
+	objs, err := c.accesses.ByIndex(accountIndex, accountName)
+	if err != nil || len(objs) == 0 {
+		return nil, err
+	}
+	access, _ := objs[0].(*bucketv1alpha1.BucketAccess)
+	return access, nil
+}
+
+// bucketAccesses returns all the BucketAccesses.
+func (c *bucketAccessCache) bucketAccesses() []*bucketv1alpha1.BucketAccess {
+	objs := c.accesses.List()
+	accesses := make([]*bucketv1alpha1.BucketAccess, 0, len(objs))
+	for _, obj := range objs {
+		if access, ok := obj.(*bucketv1alpha1.BucketAccess); ok {
+			accesses = append(accesses, access)
+		}
+	}
+	return accesses
+}
+
+// bucketAccessClasses returns all the BucketAccessClasses.
+func (c *bucketAccessCache) bucketAccessClasses() ([]*bucketv1alpha1.BucketAccessClass, error) {
+	return c.classes.List(labels.Everything())
+}
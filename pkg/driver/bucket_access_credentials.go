@@ -0,0 +1,112 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+// bucketInfoSecretKey is the key of the credentials secret written by the COSI sidecar
+const bucketInfoSecretKey = "BucketInfo"
+
+// errNoBucketInfo is returned for credentials secrets without S3 bucket info.
+var errNoBucketInfo = errors.New("no S3 bucket info")
+
+// credentialsSecret is the credentials secret of a BucketAccess. The bucket info is kept as raw JSON
+// so that fields unknown to the COSI API, such as sessionToken, are preserved on update.
+type credentialsSecret struct {
+	secret     *corev1.Secret
+	bucketInfo map[string]interface{}
+	s3         map[string]interface{}
+}
+
+func getCredentialsSecret(ctx context.Context, clientset kubernetes.Interface, access *bucketv1alpha1.BucketAccess) (*credentialsSecret, error) {
+	secret, err := clientset.CoreV1().Secrets(access.Namespace).Get(ctx, access.Spec.CredentialsSecretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials secret: %w", err)
+	}
+
+	var bucketInfo map[string]interface{}
+	if err := json.Unmarshal(secret.Data[bucketInfoSecretKey], &bucketInfo); err == nil {
+		if spec, ok := bucketInfo["spec"].(map[string]interface{}); ok {
+			if s3, ok := spec["secretS3"].(map[string]interface{}); ok {
+				return &credentialsSecret{secret: secret, bucketInfo: bucketInfo, s3: s3}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("credentials secret %s/%s has %w", secret.Namespace, secret.Name, errNoBucketInfo)
+}
+
+// get returns a field of the S3 credentials, or an empty string if it is not set.
+func (c *credentialsSecret) get(field string) string {
+	value, _ := c.s3[field].(string)
+	return value
+}
+
+func (c *credentialsSecret) set(field, value string) {
+	c.s3[field] = value
+}
+
+func (c *credentialsSecret) update(ctx context.Context, clientset kubernetes.Interface) error {
+	data, err := json.Marshal(c.bucketInfo)
+	if err != nil {
+		return err
+	}
+	c.secret.Data[bucketInfoSecretKey] = data
+	_, err = clientset.CoreV1().Secrets(c.secret.Namespace).Update(ctx, c.secret, metav1.UpdateOptions{})
+	return err
+}
+
+// forEachGrantedBucketAccess calls fn for every granted BucketAccess whose BucketAccessClass belongs
+// to this driver and is selected by selectClass. The objects come from the cache and must not be modified.
+func (s *ProvisionerServer) forEachGrantedBucketAccess(ctx context.Context,
+	selectClass func(*bucketv1alpha1.BucketAccessClass) bool,
+	fn func(*bucketv1alpha1.BucketAccess, *bucketv1alpha1.BucketAccessClass)) error {
+	if err := s.bucketAccesses.start(ctx, s.BucketClientset); err != nil {
+		return err
+	}
+	classes, err := s.bucketAccesses.bucketAccessClasses()
+	if err != nil {
+		return fmt.Errorf("failed to list BucketAccessClasses: %w", err)
+	}
+
+	selected := map[string]*bucketv1alpha1.BucketAccessClass{}
+	for _, class := range classes {
+		if class.DriverName == s.Provisioner && selectClass(class) {
+			selected[class.Name] = class
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	for _, access := range s.bucketAccesses.bucketAccesses() {
+		class, ok := selected[access.Spec.BucketAccessClassName]
+		if !ok || !access.Status.AccessGranted || access.Status.AccountID == "" || access.DeletionTimestamp != nil {
+			continue
+		}
+		fn(access, class)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ParseBucketPolicy reads the policyMode and accessMode parameters, which select how users are granted
+// access to the bucket and which actions they are allowed, and the conditions restricting their requests.
+func ParseBucketPolicy(parameters map[string]string) (iamclient.BucketPolicy, error) {
+	policy := iamclient.BucketPolicy{Mode: iamclient.PolicyModeInline, AccessMode: iamclient.AccessModeReadWrite}
+
+	switch mode := parameters["policyMode"]; mode {
+	case "", iamclient.PolicyModeInline:
+	case iamclient.PolicyModeManaged, iamclient.PolicyModeGroup:
+		if parameters["credentialType"] == CredentialTypeSession {
+			return policy, status.Error(codes.InvalidArgument, "policyMode must be inline with session credentials")
+		}
+		policy.Mode = mode
+	default:
+		return policy, status.Errorf(codes.InvalidArgument, "policyMode must be one of %q, %q or %q, got %q",
+			iamclient.PolicyModeInline, iamclient.PolicyModeManaged, iamclient.PolicyModeGroup, mode)
+	}
+
+	switch accessMode := parameters["accessMode"]; accessMode {
+	case "", iamclient.AccessModeReadWrite:
+	case iamclient.AccessModeReadOnly:
+		policy.AccessMode = accessMode
+	default:
+		return policy, status.Errorf(codes.InvalidArgument, "accessMode must be %q or %q, got %q",
+			iamclient.AccessModeReadWrite, iamclient.AccessModeReadOnly, accessMode)
+	}
+
+	conditions, err := parsePolicyConditions(parameters)
+	if err != nil {
+		return policy, err
+	}
+	if !conditions.IsZero() && policy.Mode != iamclient.PolicyModeInline {
+		return policy, status.Error(codes.InvalidArgument, "allowedSourceCIDRs, requireSecureTransport and accessExpiresAt require policyMode inline")
+	}
+	policy.Conditions = conditions
+	return policy, nil
+}
+
+// parsePolicyConditions reads the allowedSourceCIDRs, requireSecureTransport and accessExpiresAt parameters.
+func parsePolicyConditions(parameters map[string]string) (iamclient.PolicyConditions, error) {
+	var conditions iamclient.PolicyConditions
+
+	if value := parameters["allowedSourceCIDRs"]; value != "" {
+		for _, cidr := range strings.Split(value, ",") {
+			if cidr = strings.TrimSpace(cidr); cidr == "" {
+				continue
+			}
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return conditions, status.Errorf(codes.InvalidArgument, "allowedSourceCIDRs must be a comma-separated list of CIDRs, got %q", cidr)
+			}
+			conditions.SourceCIDRs = append(conditions.SourceCIDRs, cidr)
+		}
+	}
+	if value := parameters["requireSecureTransport"]; value != "" {
+		secure, err := strconv.ParseBool(value)
+		if err != nil {
+			return conditions, status.Errorf(codes.InvalidArgument, "requireSecureTransport must be true or false, got %q", value)
+		}
+		conditions.RequireSecureTransport = secure
+	}
+	if value := parameters["accessExpiresAt"]; value != "" {
+		expiresAt, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return conditions, status.Errorf(codes.InvalidArgument, "accessExpiresAt must be an RFC 3339 time, got %q", value)
+		}
+		if !expiresAt.After(time.Now()) {
+			return conditions, status.Errorf(codes.InvalidArgument, "accessExpiresAt %s is in the past", value)
+		}
+		conditions.ExpiresAt = expiresAt
+	}
+	return conditions, nil
+}
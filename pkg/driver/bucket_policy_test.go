@@ -0,0 +1,147 @@
+package driver_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/kubernetes/fake"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/mock"
+)
+
+var _ = Describe("ParseBucketPolicy", func() {
+	It("should default to read-write inline policies", func() {
+		policy, err := driver.ParseBucketPolicy(map[string]string{})
+		Expect(err).To(BeNil())
+		Expect(policy).To(Equal(iamclient.BucketPolicy{Mode: iamclient.PolicyModeInline, AccessMode: iamclient.AccessModeReadWrite}))
+	})
+
+	It("should read the policy and access modes", func() {
+		policy, err := driver.ParseBucketPolicy(map[string]string{"policyMode": "group", "accessMode": "readonly"})
+		Expect(err).To(BeNil())
+		Expect(policy).To(Equal(iamclient.BucketPolicy{Mode: iamclient.PolicyModeGroup, AccessMode: iamclient.AccessModeReadOnly}))
+	})
+
+	It("should allow read-only session credentials", func() {
+		policy, err := driver.ParseBucketPolicy(map[string]string{"credentialType": "session", "accessMode": "readonly"})
+		Expect(err).To(BeNil())
+		Expect(policy.AccessMode).To(Equal(iamclient.AccessModeReadOnly))
+	})
+
+	It("should read the policy conditions", func() {
+		policy, err := driver.ParseBucketPolicy(map[string]string{
+			"allowedSourceCIDRs":     "10.0.0.0/8, fd00::/8",
+			"requireSecureTransport": "true",
+			"accessExpiresAt":        "2099-12-31T23:59:59Z",
+		})
+		Expect(err).To(BeNil())
+		Expect(policy.Conditions).To(Equal(iamclient.PolicyConditions{
+			SourceCIDRs:            []string{"10.0.0.0/8", "fd00::/8"},
+			RequireSecureTransport: true,
+			ExpiresAt:              time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC),
+		}))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(parameters map[string]string) {
+			_, err := driver.ParseBucketPolicy(parameters)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("unknown policy mode", map[string]string{"policyMode": "bucket"}),
+		Entry("unknown access mode", map[string]string{"accessMode": "writeonly"}),
+		Entry("managed policy with session credentials", map[string]string{"policyMode": "managed", "credentialType": "session"}),
+		Entry("invalid CIDR", map[string]string{"allowedSourceCIDRs": "10.0.0.0/8,10.0.0.1"}),
+		Entry("invalid secure transport flag", map[string]string{"requireSecureTransport": "always"}),
+		Entry("invalid expiry", map[string]string{"accessExpiresAt": "2099-12-31"}),
+		Entry("expiry in the past", map[string]string{"accessExpiresAt": "2000-01-01T00:00:00Z"}),
+		Entry("conditions on group policies", map[string]string{"policyMode": "group", "requireSecureTransport": "true"}),
+	)
+})
+
+var _ = Describe("Bucket policy modes", func() {
+	var (
+		mockIAM     *mock.MockIAMClient
+		provisioner *driver.ProvisionerServer
+	)
+
+	BeforeEach(func() {
+		provisioner = createTestProvisionerServer(fake.NewSimpleClientset(), bucketclientfake.NewSimpleClientset())
+		mockIAM = &mock.MockIAMClient{
+			PutUserPolicyFunc: func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				Fail("inline policies must not be used in managed mode")
+				return nil, nil
+			},
+		}
+		iamParams := createTestIAMParams()
+		mockInitializeClient("IAM", &iamclient.IAMClient{IAMService: mockIAM}, &iamParams, nil)
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+	})
+
+	It("should attach the read-only managed policy of the bucket", func(ctx SpecContext) {
+		var policyName string
+		mockIAM.CreatePolicyFunc = func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+			policyName = *input.PolicyName
+			return &iam.CreatePolicyOutput{Policy: &types.Policy{Arn: aws.String("arn:aws:iam::123456789012:policy/cosi/" + policyName)}}, nil
+		}
+		attached := false
+		mockIAM.AttachUserPolicyFunc = func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+			attached = true
+			return &iam.AttachUserPolicyOutput{}, nil
+		}
+
+		response, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       "ba-managed",
+			Parameters: map[string]string{"policyMode": "managed", "accessMode": "readonly"},
+		})
+		Expect(err).To(BeNil())
+		Expect(response.AccountId).To(Equal("ba-managed"))
+		Expect(policyName).To(Equal(iamclient.ManagedResourceName(testBucketName, iamclient.AccessModeReadOnly)))
+		Expect(attached).To(BeTrue())
+	})
+
+	It("should restrict the inline policy to the allowed networks", func(ctx SpecContext) {
+		var document string
+		mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+			document = *input.PolicyDocument
+			return &iam.PutUserPolicyOutput{}, nil
+		}
+
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       "ba-restricted",
+			Parameters: map[string]string{"allowedSourceCIDRs": "10.42.0.0/16", "requireSecureTransport": "true"},
+		})
+		Expect(err).To(BeNil())
+		Expect(document).To(ContainSubstring(`"IpAddress":{"aws:SourceIp":["10.42.0.0/16"]}`))
+		Expect(document).To(ContainSubstring(`"Bool":{"aws:SecureTransport":"true"}`))
+	})
+
+	It("should reject an invalid policy mode before creating the user", func(ctx SpecContext) {
+		mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+			Fail("user must not be created")
+			return nil, nil
+		}
+
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       "ba-managed",
+			Parameters: map[string]string{"policyMode": "bucket"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
@@ -19,10 +19,14 @@ package driver
 import (
 	"context"
 
+	"github.com/scality/cosi-driver/pkg/util"
 	"k8s.io/klog/v2"
 	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
+// CABundles serves the CA bundle ConfigMaps referenced by object storage provider secrets, until the driver stops
+var CABundles = util.NewCABundleWatcher()
+
 // CreateDriver initializes both the IdentityServer and ProvisionerServer for the COSI driver
 func CreateDriver(ctx context.Context, driverName string) (cosiapi.IdentityServer, cosiapi.ProvisionerServer, error) {
 	provisioner, err := InitProvisionerServer(driverName)
@@ -37,5 +41,23 @@ func CreateDriver(ctx context.Context, driverName string) (cosiapi.IdentityServe
 		return nil, nil, err
 	}
 
+	go func() {
+		<-ctx.Done()
+		CABundles.Stop()
+		if server, ok := provisioner.(*ProvisionerServer); ok {
+			server.bucketAccesses.Stop()
+		}
+	}()
+
+	if server, ok := provisioner.(*ProvisionerServer); ok && KeyRotationCheckInterval > 0 {
+		go NewKeyRotator(server).Run(ctx, KeyRotationCheckInterval)
+	}
+	if server, ok := provisioner.(*ProvisionerServer); ok && SessionRefreshCheckInterval > 0 {
+		go NewSessionRefresher(server).Run(ctx, SessionRefreshCheckInterval)
+	}
+	if server, ok := provisioner.(*ProvisionerServer); ok && InventoryCheckInterval > 0 {
+		go server.WatchInventory(ctx, InventoryCheckInterval)
+	}
+
 	return identity, provisioner, nil
 }
@@ -0,0 +1,87 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+const DefaultInventoryCheckInterval = time.Minute
+
+// InventoryCheckInterval is how often the buckets and bucket accesses managed by the driver are counted. Zero disables counting.
+var InventoryCheckInterval = DefaultInventoryCheckInterval
+
+// WatchInventory counts the buckets and bucket accesses managed by the driver every interval until ctx is done.
+func (s *ProvisionerServer) WatchInventory(ctx context.Context, interval time.Duration) {
+	klog.V(constants.LvlInfo).InfoS("Starting inventory of managed buckets and bucket accesses", "checkInterval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ReportInventory(ctx); err != nil {
+			klog.ErrorS(err, "Failed to count managed buckets and bucket accesses")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReportInventory sets the managed_buckets and managed_bucket_accesses gauges from the ready Buckets
+// and granted BucketAccesses of the driver. The gauges keep their previous values when listing fails.
+func (s *ProvisionerServer) ReportInventory(ctx context.Context) error {
+	buckets, err := s.BucketClientset.ObjectstorageV1alpha1().Buckets().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list Buckets: %w", err)
+	}
+	bucketsByClass := map[string]int{}
+	for i := range buckets.Items {
+		bucket := &buckets.Items[i]
+		if bucket.Spec.DriverName == s.Provisioner && bucket.Status.BucketReady && bucket.DeletionTimestamp == nil {
+			bucketsByClass[bucket.Spec.BucketClassName]++
+		}
+	}
+
+	accessesByClass := map[string]int{}
+	selectAll := func(*bucketv1alpha1.BucketAccessClass) bool { return true }
+	err = s.forEachGrantedBucketAccess(ctx, selectAll, func(_ *bucketv1alpha1.BucketAccess, class *bucketv1alpha1.BucketAccessClass) {
+		accessesByClass[class.Name]++
+	})
+	if err != nil {
+		return err
+	}
+
+	metrics.ManagedBuckets.Reset()
+	for class, count := range bucketsByClass {
+		metrics.ManagedBuckets.WithLabelValues(class).Set(float64(count))
+	}
+	metrics.ManagedBucketAccesses.Reset()
+	for class, count := range accessesByClass {
+		metrics.ManagedBucketAccesses.WithLabelValues(class).Set(float64(count))
+	}
+	klog.V(constants.LvlDebug).InfoS("Counted managed buckets and bucket accesses", "buckets", bucketsByClass, "bucketAccesses", accessesByClass)
+	return nil
+}
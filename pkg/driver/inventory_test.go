@@ -0,0 +1,90 @@
+package driver_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/metrics"
+)
+
+var _ = Describe("ReportInventory", func() {
+	var (
+		bucketClientset *bucketclientfake.Clientset
+		provisioner     *driver.ProvisionerServer
+	)
+
+	bucket := func(name, driverName, className string, ready bool) *bucketv1alpha1.Bucket {
+		return &bucketv1alpha1.Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       bucketv1alpha1.BucketSpec{DriverName: driverName, BucketClassName: className},
+			Status:     bucketv1alpha1.BucketStatus{BucketReady: ready},
+		}
+	}
+
+	access := func(name, className string, granted bool) *bucketv1alpha1.BucketAccess {
+		return &bucketv1alpha1.BucketAccess{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"},
+			Spec:       bucketv1alpha1.BucketAccessSpec{BucketAccessClassName: className},
+			Status:     bucketv1alpha1.BucketAccessStatus{AccountID: name + "-user", AccessGranted: granted},
+		}
+	}
+
+	BeforeEach(func() {
+		deleting := bucket("bucket-deleting", testProvisionerName, "standard", true)
+		deleting.DeletionTimestamp = &metav1.Time{}
+		deleting.Finalizers = []string{"cosi.objectstorage.k8s.io/bucket-protection"}
+
+		bucketClientset = bucketclientfake.NewSimpleClientset(
+			bucket("bucket-a", testProvisionerName, "standard", true),
+			bucket("bucket-b", testProvisionerName, "standard", true),
+			bucket("bucket-c", testProvisionerName, "archive", true),
+			bucket("bucket-pending", testProvisionerName, "standard", false),
+			bucket("bucket-other", "other.driver", "standard", true),
+			deleting,
+			&bucketv1alpha1.BucketAccessClass{ObjectMeta: metav1.ObjectMeta{Name: "read-write"}, DriverName: testProvisionerName},
+			&bucketv1alpha1.BucketAccessClass{ObjectMeta: metav1.ObjectMeta{Name: "other-class"}, DriverName: "other.driver"},
+			access("ba-granted", "read-write", true),
+			access("ba-pending", "read-write", false),
+			access("ba-other", "other-class", true),
+		)
+		provisioner = createTestProvisionerServer(nil, bucketClientset)
+	})
+
+	It("should count the ready buckets and granted bucket accesses of the driver", func(ctx SpecContext) {
+		Expect(provisioner.ReportInventory(ctx)).To(Succeed())
+
+		Expect(testutil.ToFloat64(metrics.ManagedBuckets.WithLabelValues("standard"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.ManagedBuckets.WithLabelValues("archive"))).To(Equal(1.0))
+		Expect(testutil.CollectAndCount(metrics.ManagedBuckets)).To(Equal(2))
+		Expect(testutil.ToFloat64(metrics.ManagedBucketAccesses.WithLabelValues("read-write"))).To(Equal(1.0))
+		Expect(testutil.CollectAndCount(metrics.ManagedBucketAccesses)).To(Equal(1))
+	})
+
+	It("should drop the classes without managed resources left", func(ctx SpecContext) {
+		Expect(provisioner.ReportInventory(ctx)).To(Succeed())
+		Expect(bucketClientset.ObjectstorageV1alpha1().Buckets().Delete(ctx, "bucket-c", metav1.DeleteOptions{})).To(Succeed())
+
+		Expect(provisioner.ReportInventory(ctx)).To(Succeed())
+		Expect(testutil.CollectAndCount(metrics.ManagedBuckets)).To(Equal(1))
+	})
+
+	It("should keep the previous counts when listing fails", func(ctx SpecContext) {
+		Expect(provisioner.ReportInventory(ctx)).To(Succeed())
+		bucketClientset.PrependReactor("list", "buckets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		Expect(provisioner.ReportInventory(ctx)).To(MatchError(ContainSubstring("connection refused")))
+		Expect(testutil.ToFloat64(metrics.ManagedBuckets.WithLabelValues("standard"))).To(Equal(2.0))
+		Expect(testutil.ToFloat64(metrics.ManagedBucketAccesses.WithLabelValues("read-write"))).To(Equal(1.0))
+	})
+})
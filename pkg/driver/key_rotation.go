@@ -0,0 +1,229 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+const (
+	DefaultKeyRotationCheckInterval = time.Hour
+	DefaultKeyRotationGracePeriod   = 24 * time.Hour
+)
+
+// KeyRotationCheckInterval is how often BucketAccesses are checked for keys due for rotation. Zero disables rotation.
+var KeyRotationCheckInterval = DefaultKeyRotationCheckInterval
+
+// KeyRotationPolicy holds the key rotation settings of a BucketAccessClass.
+type KeyRotationPolicy struct {
+	Interval    time.Duration // Age after which a new access key is issued, zero when rotation is disabled
+	GracePeriod time.Duration // Time the previous key stays valid after the secret is updated
+}
+
+// ParseKeyRotationPolicy reads the keyRotationInterval and keyRotationGracePeriod parameters.
+func ParseKeyRotationPolicy(parameters map[string]string) (KeyRotationPolicy, error) {
+	policy := KeyRotationPolicy{GracePeriod: DefaultKeyRotationGracePeriod}
+
+	value := parameters["keyRotationInterval"]
+	if value == "" {
+		return policy, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval <= 0 {
+		return policy, status.Errorf(codes.InvalidArgument, "keyRotationInterval must be a positive duration, got %q", value)
+	}
+	policy.Interval = interval
+
+	if value := parameters["keyRotationGracePeriod"]; value != "" {
+		gracePeriod, err := time.ParseDuration(value)
+		if err != nil || gracePeriod < 0 {
+			return policy, status.Errorf(codes.InvalidArgument, "keyRotationGracePeriod must be a non-negative duration, got %q", value)
+		}
+		policy.GracePeriod = gracePeriod
+	}
+	if policy.GracePeriod >= policy.Interval {
+		return policy, status.Error(codes.InvalidArgument, "keyRotationGracePeriod must be shorter than keyRotationInterval")
+	}
+	return policy, nil
+}
+
+// KeyRotator rotates the access keys of BucketAccesses whose BucketAccessClass sets keyRotationInterval.
+// It keeps no state: the key referenced by the credentials secret is the current one, and any other
+// key of the IAM user is a previous key, deleted once the current key is older than the grace period.
+type KeyRotator struct {
+	server *ProvisionerServer
+
+	mu sync.Mutex
+	// reported holds the namespace and name of the BucketAccesses whose key age was reported by the last check
+	reported map[[2]string]bool
+}
+
+// NewKeyRotator creates a KeyRotator for the BucketAccesses provisioned by the server.
+func NewKeyRotator(server *ProvisionerServer) *KeyRotator {
+	return &KeyRotator{server: server}
+}
+
+// Run checks the BucketAccesses every interval until ctx is done.
+func (r *KeyRotator) Run(ctx context.Context, interval time.Duration) {
+	klog.V(constants.LvlInfo).InfoS("Starting access key rotation", "checkInterval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.RotateAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RotateAll rotates the keys of all BucketAccesses that are due for rotation.
+// Failures are logged and retried on the next check.
+func (r *KeyRotator) RotateAll(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := map[[2]string]bool{}
+	policies := map[string]KeyRotationPolicy{}
+	selectClass := func(class *bucketv1alpha1.BucketAccessClass) bool {
+		policy, err := ParseKeyRotationPolicy(class.Parameters)
+		if err != nil {
+			klog.ErrorS(err, "Invalid key rotation settings", "bucketAccessClass", class.Name)
+			return false
+		}
+		policies[class.Name] = policy
+		return policy.Interval > 0
+	}
+	err := r.server.forEachGrantedBucketAccess(ctx, selectClass, func(access *bucketv1alpha1.BucketAccess, class *bucketv1alpha1.BucketAccessClass) {
+		// Rotation runs as an operation on the IAM user, so that it does not interleave with a grant or revoke of the same user
+		userName := access.Status.AccountID
+		seen[[2]string{access.Namespace, access.Name}] = true
+		req := wrapperspb.String(access.Namespace + "/" + access.Name)
+		_, err := r.server.operations.run(ctx, constants.ActionRotateAccessKey, []string{accountResource(userName)}, req, func(ctx context.Context) (interface{}, error) {
+			return nil, r.rotate(ctx, access, class.Parameters, policies[class.Name])
+		})
+		if status.Code(err) == codes.Aborted {
+			klog.V(constants.LvlInfo).InfoS("Skipped access key rotation of a busy user", "namespace", access.Namespace, "bucketAccess", access.Name, "userName", userName)
+		} else if err != nil {
+			klog.ErrorS(err, "Failed to rotate access key", "namespace", access.Namespace, "bucketAccess", access.Name, "userName", userName)
+		}
+	})
+	if err != nil {
+		// Keep reporting the previous ages rather than dropping them all
+		klog.ErrorS(err, "Failed to list BucketAccesses for key rotation")
+		return
+	}
+
+	// Drop the ages of the BucketAccesses that were deleted or no longer rotate their keys, without
+	// resetting the others, so that they do not disappear from scrapes during the check
+	for labels := range r.reported {
+		if !seen[labels] && metrics.AccessKeyAge != nil {
+			metrics.AccessKeyAge.DeleteLabelValues(labels[0], labels[1])
+		}
+	}
+	r.reported = seen
+}
+
+func (r *KeyRotator) rotate(ctx context.Context, access *bucketv1alpha1.BucketAccess, parameters map[string]string, policy KeyRotationPolicy) error {
+	userName := access.Status.AccountID
+
+	credentials, err := getCredentialsSecret(ctx, r.server.Clientset, access)
+	if err != nil {
+		return err
+	}
+	currentKeyID := credentials.get("accessKeyID")
+
+	client, _, err := InitializeClient(ctx, r.server.Clientset, parameters, "IAM")
+	if err != nil {
+		return err
+	}
+	iamClient, ok := client.(*iamclient.IAMClient)
+	if !ok {
+		return fmt.Errorf("unsupported client type for key rotation")
+	}
+
+	keys, err := iamClient.ListAccessKeys(ctx, userName)
+	if err != nil {
+		return err
+	}
+	var currentKeyCreated *time.Time
+	for _, key := range keys {
+		if key.AccessKeyId != nil && *key.AccessKeyId == currentKeyID {
+			currentKeyCreated = key.CreateDate
+		}
+	}
+	if currentKeyCreated == nil {
+		return fmt.Errorf("access key %s of the credentials secret not found for user %s", currentKeyID, userName)
+	}
+	age := time.Since(*currentKeyCreated)
+	setAccessKeyAge(access, age)
+
+	// Keys replaced by the current one stay valid for the grace period, so workloads can pick up the new secret
+	if age >= policy.GracePeriod {
+		for _, key := range keys {
+			if key.AccessKeyId == nil || *key.AccessKeyId == currentKeyID {
+				continue
+			}
+			if err := iamClient.DeleteAccessKey(ctx, userName, *key.AccessKeyId); err != nil {
+				return err
+			}
+			klog.V(constants.LvlInfo).InfoS("Deleted previous access key", "namespace", access.Namespace, "bucketAccess", access.Name, "userName", userName, "accessKeyId", *key.AccessKeyId)
+		}
+	}
+	if age < policy.Interval {
+		return nil
+	}
+
+	newKey, err := iamClient.CreateAccessKey(ctx, userName)
+	if err != nil {
+		return err
+	}
+	credentials.set("accessKeyID", *newKey.AccessKey.AccessKeyId)
+	credentials.set("accessSecretKey", *newKey.AccessKey.SecretAccessKey)
+	if err := credentials.update(ctx, r.server.Clientset); err != nil {
+		// The new key is not used by anyone, delete it so that the next check can issue another one
+		if deleteErr := iamClient.DeleteAccessKey(ctx, userName, *newKey.AccessKey.AccessKeyId); deleteErr != nil {
+			klog.ErrorS(deleteErr, "Failed to delete unused access key", "userName", userName, "accessKeyId", *newKey.AccessKey.AccessKeyId)
+		}
+		return fmt.Errorf("failed to update credentials secret: %w", err)
+	}
+
+	setAccessKeyAge(access, 0)
+	klog.V(constants.LvlInfo).InfoS("Rotated access key", "namespace", access.Namespace, "bucketAccess", access.Name, "userName", userName,
+		"previousAccessKeyId", currentKeyID, "accessKeyId", *newKey.AccessKey.AccessKeyId, "gracePeriod", policy.GracePeriod)
+	return nil
+}
+
+// setAccessKeyAge reports the age of the current access key of the BucketAccess.
+func setAccessKeyAge(access *bucketv1alpha1.BucketAccess, age time.Duration) {
+	if metrics.AccessKeyAge != nil {
+		metrics.AccessKeyAge.WithLabelValues(access.Namespace, access.Name).Set(age.Seconds())
+	}
+}
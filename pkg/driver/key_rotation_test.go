@@ -0,0 +1,274 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	cosiapis "sigs.k8s.io/container-object-storage-interface-api/apis"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/mock"
+)
+
+var _ = Describe("ParseKeyRotationPolicy", func() {
+	It("should disable rotation when no interval is set", func() {
+		policy, err := driver.ParseKeyRotationPolicy(map[string]string{})
+		Expect(err).To(BeNil())
+		Expect(policy.Interval).To(BeZero())
+	})
+
+	It("should parse the interval and default the grace period", func() {
+		policy, err := driver.ParseKeyRotationPolicy(map[string]string{"keyRotationInterval": "720h"})
+		Expect(err).To(BeNil())
+		Expect(policy.Interval).To(Equal(720 * time.Hour))
+		Expect(policy.GracePeriod).To(Equal(driver.DefaultKeyRotationGracePeriod))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(parameters map[string]string) {
+			_, err := driver.ParseKeyRotationPolicy(parameters)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("non-duration interval", map[string]string{"keyRotationInterval": "monthly"}),
+		Entry("negative interval", map[string]string{"keyRotationInterval": "-1h"}),
+		Entry("non-duration grace period", map[string]string{"keyRotationInterval": "720h", "keyRotationGracePeriod": "1 day"}),
+		Entry("grace period longer than interval", map[string]string{"keyRotationInterval": "1h", "keyRotationGracePeriod": "2h"}),
+	)
+})
+
+var _ = Describe("KeyRotator", func() {
+	const (
+		accessNamespace = "team-a"
+		accessName      = "ba-data"
+		userName        = "ba-3d8b7f2e"
+		secretName      = "data-credentials"
+		className       = "rotating-class"
+		currentKeyID    = "current-key"
+		previousKeyID   = "previous-key"
+	)
+
+	var (
+		mockIAM         *mock.MockIAMClient
+		clientset       *fake.Clientset
+		bucketClientset *bucketclientfake.Clientset
+		provisioner     *driver.ProvisionerServer
+		rotator         *driver.KeyRotator
+		keys            []types.AccessKeyMetadata
+		created         []string
+		deleted         []string
+	)
+
+	keyCreatedAgo := func(id string, age time.Duration) types.AccessKeyMetadata {
+		return types.AccessKeyMetadata{AccessKeyId: aws.String(id), CreateDate: aws.Time(time.Now().Add(-age))}
+	}
+
+	secretKeyID := func(ctx context.Context) string {
+		secret, err := clientset.CoreV1().Secrets(accessNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		var bucketInfo cosiapis.BucketInfo
+		Expect(json.Unmarshal(secret.Data["BucketInfo"], &bucketInfo)).To(Succeed())
+		return bucketInfo.Spec.S3.AccessKeyID
+	}
+
+	BeforeEach(func() {
+		bucketInfo, err := json.Marshal(cosiapis.BucketInfo{
+			Spec: cosiapis.BucketInfoSpec{
+				BucketName: testBucketName,
+				S3:         &cosiapis.SecretS3{Endpoint: testEndpoint, Region: testRegion, AccessKeyID: currentKeyID, AccessSecretKey: "current-secret"},
+			},
+		})
+		Expect(err).To(BeNil())
+		clientset = fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: accessNamespace},
+			Data:       map[string][]byte{"BucketInfo": bucketInfo},
+		})
+
+		bucketClientset = bucketclientfake.NewSimpleClientset(
+			&bucketv1alpha1.BucketAccessClass{
+				ObjectMeta: metav1.ObjectMeta{Name: className},
+				DriverName: testProvisionerName,
+				Parameters: map[string]string{
+					"objectStorageSecretName":      testSecretName,
+					"objectStorageSecretNamespace": testNamespace,
+					"keyRotationInterval":          "720h",
+					"keyRotationGracePeriod":       "24h",
+				},
+			},
+			&bucketv1alpha1.BucketAccessClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "static-class"},
+				DriverName: testProvisionerName,
+			},
+			&bucketv1alpha1.BucketAccess{
+				ObjectMeta: metav1.ObjectMeta{Name: accessName, Namespace: accessNamespace},
+				Spec:       bucketv1alpha1.BucketAccessSpec{BucketAccessClassName: className, CredentialsSecretName: secretName},
+				Status:     bucketv1alpha1.BucketAccessStatus{AccountID: userName, AccessGranted: true},
+			},
+			&bucketv1alpha1.BucketAccess{
+				ObjectMeta: metav1.ObjectMeta{Name: "ba-static", Namespace: accessNamespace},
+				Spec:       bucketv1alpha1.BucketAccessSpec{BucketAccessClassName: "static-class", CredentialsSecretName: "static-credentials"},
+				Status:     bucketv1alpha1.BucketAccessStatus{AccountID: "ba-static-user", AccessGranted: true},
+			},
+		)
+
+		created, deleted = nil, nil
+		mockIAM = &mock.MockIAMClient{
+			ListAccessKeysFunc: func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+				Expect(*input.UserName).To(Equal(userName))
+				return &iam.ListAccessKeysOutput{AccessKeyMetadata: keys}, nil
+			},
+			CreateAccessKeyFunc: func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+				created = append(created, *input.UserName)
+				return &iam.CreateAccessKeyOutput{AccessKey: &types.AccessKey{AccessKeyId: aws.String("new-key"), SecretAccessKey: aws.String("new-secret")}}, nil
+			},
+			DeleteAccessKeyFunc: func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				deleted = append(deleted, *input.AccessKeyId)
+				return &iam.DeleteAccessKeyOutput{}, nil
+			},
+		}
+		iamParams := createTestIAMParams()
+		mockInitializeClient("IAM", &iamclient.IAMClient{IAMService: mockIAM}, &iamParams, nil)
+
+		provisioner = createTestProvisionerServer(clientset, bucketClientset)
+		rotator = driver.NewKeyRotator(provisioner)
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+	})
+
+	It("should issue a new key and update the credentials secret once the interval has passed", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(currentKeyID, 721*time.Hour)}
+
+		rotator.RotateAll(ctx)
+
+		Expect(created).To(Equal([]string{userName}))
+		Expect(deleted).To(BeEmpty())
+		Expect(secretKeyID(ctx)).To(Equal("new-key"))
+		Expect(testutil.ToFloat64(metrics.AccessKeyAge.WithLabelValues(accessNamespace, accessName))).To(BeZero())
+	})
+
+	It("should keep the previous key during the grace period", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(previousKeyID, 745*time.Hour), keyCreatedAgo(currentKeyID, time.Hour)}
+
+		rotator.RotateAll(ctx)
+
+		Expect(created).To(BeEmpty())
+		Expect(deleted).To(BeEmpty())
+		Expect(secretKeyID(ctx)).To(Equal(currentKeyID))
+		Expect(testutil.ToFloat64(metrics.AccessKeyAge.WithLabelValues(accessNamespace, accessName))).To(BeNumerically("~", time.Hour.Seconds(), 60))
+	})
+
+	It("should only drop the key age of BucketAccesses no longer rotated", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(currentKeyID, time.Hour)}
+		metrics.AccessKeyAge.Reset()
+		metrics.AccessKeyAge.WithLabelValues(accessNamespace, "ba-unknown").Set(1)
+
+		rotator.RotateAll(ctx)
+		Expect(testutil.CollectAndCount(metrics.AccessKeyAge)).To(Equal(2))
+
+		Expect(bucketClientset.ObjectstorageV1alpha1().BucketAccesses(accessNamespace).Delete(ctx, accessName, metav1.DeleteOptions{})).To(Succeed())
+		Eventually(func() int {
+			rotator.RotateAll(ctx)
+			return testutil.CollectAndCount(metrics.AccessKeyAge)
+		}).Should(Equal(1))
+		Expect(testutil.ToFloat64(metrics.AccessKeyAge.WithLabelValues(accessNamespace, "ba-unknown"))).To(Equal(1.0))
+	})
+
+	It("should delete the previous key after the grace period", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(previousKeyID, 770*time.Hour), keyCreatedAgo(currentKeyID, 25*time.Hour)}
+
+		rotator.RotateAll(ctx)
+
+		Expect(deleted).To(Equal([]string{previousKeyID}))
+		Expect(created).To(BeEmpty())
+	})
+
+	It("should delete the new key if the credentials secret cannot be updated", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(currentKeyID, 721*time.Hour)}
+		clientset.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("conflict")
+		})
+
+		rotator.RotateAll(ctx)
+
+		Expect(created).To(Equal([]string{userName}))
+		Expect(deleted).To(Equal([]string{"new-key"}))
+		Expect(secretKeyID(ctx)).To(Equal(currentKeyID))
+	})
+
+	It("should not touch keys when the key of the secret is unknown to IAM", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(previousKeyID, 800*time.Hour)}
+
+		rotator.RotateAll(ctx)
+
+		Expect(created).To(BeEmpty())
+		Expect(deleted).To(BeEmpty())
+	})
+
+	It("should skip BucketAccesses that are not granted yet", func(ctx SpecContext) {
+		access, err := bucketClientset.ObjectstorageV1alpha1().BucketAccesses(accessNamespace).Get(ctx, accessName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		access.Status.AccessGranted = false
+		_, err = bucketClientset.ObjectstorageV1alpha1().BucketAccesses(accessNamespace).Update(ctx, access, metav1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(currentKeyID, 800*time.Hour)}
+
+		rotator.RotateAll(ctx)
+
+		Expect(created).To(BeEmpty())
+	})
+
+	It("should hold the user during rotation", func(ctx SpecContext) {
+		keys = []types.AccessKeyMetadata{keyCreatedAgo(currentKeyID, 721*time.Hour)}
+		started, release := make(chan struct{}), make(chan struct{})
+		listAccessKeys := mockIAM.ListAccessKeysFunc
+		mockIAM.ListAccessKeysFunc = func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
+			close(started)
+			<-release
+			return listAccessKeys(ctx, input, opts...)
+		}
+		rotated := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			rotator.RotateAll(ctx)
+			close(rotated)
+		}()
+		Eventually(started).Should(BeClosed())
+
+		_, err := provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: testBucketName, AccountId: userName})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+		close(release)
+		Eventually(rotated).Should(BeClosed())
+		Expect(created).To(Equal([]string{userName}))
+	}, SpecTimeout(5*time.Second))
+
+	It("should reject invalid rotation settings when granting access", func(ctx SpecContext) {
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       userName,
+			Parameters: map[string]string{"keyRotationInterval": "monthly"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
@@ -0,0 +1,256 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/klog/v2"
+)
+
+// DrainCancelGracePeriod is how long Drain waits for the operations it interrupts to return.
+var DrainCancelGracePeriod = 5 * time.Second
+
+// bucketResource and accountResource name the resources serialized by operations.
+func bucketResource(bucketID string) string   { return "bucket/" + bucketID }
+func accountResource(accountID string) string { return "account/" + accountID }
+
+// operations serializes the requests acting on the same bucket or account. Identical concurrent
+// requests share the result of the first one, other requests on a busy resource fail with
+// codes.Aborted and are retried by the sidecar. A request holds all its resources or none. Operations then wait for the operations limiter.
+// The zero value is ready to use.
+type operations struct {
+	group singleflight.Group
+
+	mu       sync.Mutex
+	inFlight map[string]*operation // by resource, an operation is listed under each of its resources
+	idle     chan struct{}         // closed when the last operation in progress completes
+	running  sync.WaitGroup        // operations holding their resources
+}
+
+// operation is an operation in progress, cancelled when it is interrupted by a shutdown.
+type operation struct {
+	action    string
+	resources []string
+	started   time.Time
+	cancel    context.CancelFunc
+}
+
+// Drain waits for the operations in progress to complete, so that a shutdown does not abort
+// them halfway. When ctx is done first, it cancels them and returns the interrupted ones.
+func (s *ProvisionerServer) Drain(ctx context.Context) []string {
+	return s.operations.drain(ctx)
+}
+
+// run calls fn unless another request is in progress for one of the resources. fn keeps running when the
+// caller goes away, for example when the sidecar stops first, so that multi-step operations are
+// not aborted halfway: it only stops at the deadline of the first of the identical requests, or
+// when it is interrupted by Drain. Callers stop waiting when their own context is done.
+func (o *operations) run(ctx context.Context, action string, resources []string, req proto.Message,
+	fn func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	resource := strings.Join(resources, ",")
+	fingerprint, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+	if err != nil {
+		klog.ErrorS(err, "Failed to marshal request", "action", action, "resource", resource)
+		return nil, status.Error(codes.Internal, "failed to marshal request")
+	}
+
+	results := o.group.DoChan(action+"/"+string(fingerprint), func() (resp interface{}, err error) {
+		opCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		if deadline, ok := ctx.Deadline(); ok {
+			opCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		}
+		defer cancel()
+
+		labels := &operationLabels{}
+		opCtx = context.WithValue(opCtx, operationLabelsKey{}, labels)
+		defer observeOperation(action, labels, time.Now(), &err)
+		// DoChan re-panics in a goroutine of its own, out of reach of the gRPC recovery interceptor
+		defer recoverOperation(action, resource, &resp, &err)
+
+		if err := o.acquire(action, resources, cancel); err != nil {
+			return nil, err
+		}
+		defer o.release(resources)
+
+		release, err := ratelimit.Limiters.Operations().Acquire(opCtx)
+		if err != nil {
+			if errors.Is(err, ratelimit.ErrLimitExceeded) {
+				klog.V(constants.LvlInfo).InfoS("Too many operations in progress", "action", action, "resource", resource)
+				return nil, status.Error(codes.ResourceExhausted, "too many operations in progress, retry later")
+			}
+			return nil, status.FromContextError(err).Err()
+		}
+		defer release()
+		return fn(opCtx)
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case result := <-results:
+		if result.Shared {
+			klog.V(constants.LvlDebug).InfoS("Identical requests were collapsed", "action", action, "resource", resource)
+		}
+		return result.Val, result.Err
+	}
+}
+
+// operationLabels holds the labels of the metrics of an operation that are only known once it
+// has loaded its parameters, such as the Bucket of a DeleteBucket request.
+type operationLabels struct {
+	secret string
+}
+
+type operationLabelsKey struct{}
+
+// setOperationSecret labels the metrics of the operation running in ctx with the object storage
+// secret referenced by parameters, as "<namespace>/<name>".
+func setOperationSecret(ctx context.Context, parameters map[string]string) {
+	labels, ok := ctx.Value(operationLabelsKey{}).(*operationLabels)
+	if !ok || parameters["objectStorageSecretName"] == "" {
+		return
+	}
+	namespace := parameters["objectStorageSecretNamespace"]
+	if namespace == "" {
+		namespace = os.Getenv("POD_NAMESPACE")
+	}
+	labels.secret = namespace + "/" + parameters["objectStorageSecretName"]
+}
+
+// recoverOperation turns a panic of an operation into a codes.Internal error, so that only the
+// affected request fails instead of the whole driver.
+func recoverOperation(action, resource string, resp *interface{}, err *error) {
+	if r := recover(); r != nil {
+		klog.ErrorS(fmt.Errorf("%v", r), "Recovered from panic during operation", "action", action, "resource", resource, "stack", string(debug.Stack()))
+		if metrics.PanicsTotal != nil {
+			metrics.PanicsTotal.WithLabelValues(metrics.PanicSourceOperation, action).Inc()
+		}
+		*resp, *err = nil, status.Errorf(codes.Internal, "internal error during %s", action)
+	}
+}
+
+// observeOperation counts an operation that started at start and failed with *err, if any.
+func observeOperation(action string, labels *operationLabels, start time.Time, err *error) {
+	code := status.Code(*err).String()
+	if metrics.OperationsTotal != nil {
+		metrics.OperationsTotal.WithLabelValues(action, labels.secret, code).Inc()
+	}
+	if metrics.OperationDuration != nil {
+		metrics.OperationDuration.WithLabelValues(action, labels.secret, code).Observe(time.Since(start).Seconds())
+	}
+}
+
+// drain waits for the operations in progress to complete. When ctx is done first, it cancels
+// them, waits up to DrainCancelGracePeriod for them to return, and returns them as
+// "<action> <resources>", with the resources separated by commas.
+func (o *operations) drain(ctx context.Context) []string {
+	o.mu.Lock()
+	if len(o.inFlight) == 0 {
+		o.mu.Unlock()
+		return nil
+	}
+	if o.idle == nil {
+		o.idle = make(chan struct{})
+	}
+	idle := o.idle
+	klog.V(constants.LvlInfo).InfoS("Waiting for operations in progress", "resources", len(o.inFlight))
+	o.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+	}
+
+	o.mu.Lock()
+	var interrupted []string
+	cancelled := map[*operation]bool{}
+	for _, op := range o.inFlight {
+		if cancelled[op] {
+			continue
+		}
+		cancelled[op] = true
+		klog.ErrorS(ctx.Err(), "Interrupting operation in progress", "action", op.action, "resources", op.resources, "elapsed", time.Since(op.started))
+		op.cancel()
+		interrupted = append(interrupted, op.action+" "+strings.Join(op.resources, ","))
+	}
+	o.mu.Unlock()
+	sort.Strings(interrupted)
+
+	// Give the operations the time to stop their current request and release their resources,
+	// so that the process does not exit in the middle of a backend call
+	returned := make(chan struct{})
+	go func() {
+		o.running.Wait()
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(DrainCancelGracePeriod):
+		klog.ErrorS(nil, "Interrupted operations did not return in time", "operations", interrupted, "gracePeriod", DrainCancelGracePeriod)
+	}
+	return interrupted
+}
+
+func (o *operations) acquire(action string, resources []string, cancel context.CancelFunc) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, resource := range resources {
+		if current, ok := o.inFlight[resource]; ok {
+			klog.V(constants.LvlInfo).InfoS("Operation already in progress", "action", action, "resource", resource, "inProgress", current.action)
+			return status.Errorf(codes.Aborted, "%s is already in progress for %s", current.action, resource)
+		}
+	}
+	if o.inFlight == nil {
+		o.inFlight = map[string]*operation{}
+	}
+	op := &operation{action: action, resources: resources, started: time.Now(), cancel: cancel}
+	for _, resource := range resources {
+		o.inFlight[resource] = op
+	}
+	o.running.Add(1)
+	return nil
+}
+
+func (o *operations) release(resources []string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, resource := range resources {
+		delete(o.inFlight, resource)
+	}
+	o.running.Done()
+	if len(o.inFlight) == 0 && o.idle != nil {
+		close(o.idle)
+		o.idle = nil
+	}
+}
@@ -0,0 +1,343 @@
+package driver_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/client-go/kubernetes/fake"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	s3client "github.com/scality/cosi-driver/pkg/clients/s3"
+	"github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/mock"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+)
+
+var _ = Describe("ProvisionerServer concurrent operations", func() {
+	var (
+		provisioner *driver.ProvisionerServer
+		calls       atomic.Int32
+		started     chan string
+		release     chan struct{}
+	)
+
+	BeforeEach(func() {
+		calls.Store(0)
+		started = make(chan string, 10)
+		release = make(chan struct{})
+
+		mockS3 := &mock.MockS3Client{
+			CreateBucketFunc: func(ctx context.Context, input *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+				calls.Add(1)
+				started <- *input.Bucket
+				<-release
+				return &s3.CreateBucketOutput{}, nil
+			},
+		}
+		s3Params := createTestS3Params()
+		mockInitializeClient("S3", &s3client.S3Client{S3Service: mockS3}, &s3Params, nil)
+		provisioner = &driver.ProvisionerServer{
+			Provisioner:     testProvisionerName,
+			Clientset:       fake.NewSimpleClientset(),
+			BucketClientset: bucketclientfake.NewSimpleClientset(),
+		}
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+	})
+
+	createBucket := func(ctx context.Context, wg *sync.WaitGroup, req *cosiapi.DriverCreateBucketRequest, errs chan<- error) {
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			_, err := provisioner.DriverCreateBucket(ctx, req)
+			errs <- err
+		}()
+	}
+
+	It("should collapse identical concurrent requests", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+		Eventually(started).Should(Receive(Equal(testBucketName)))
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+
+		// Let the second request join the first one before it completes
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		Expect(<-errs).To(Succeed())
+		Expect(<-errs).To(Succeed())
+		Expect(calls.Load()).To(Equal(int32(1)))
+	}, SpecTimeout(5*time.Second))
+
+	It("should abort conflicting requests on the same bucket", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+		Eventually(started).Should(Receive(Equal(testBucketName)))
+
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{
+			Name:       testBucketName,
+			Parameters: map[string]string{"region": "eu-west-1"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+		close(release)
+		wg.Wait()
+		Expect(<-errs).To(Succeed())
+
+		// The bucket is released once the first request completes
+		_, err = provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(calls.Load()).To(Equal(int32(2)))
+	}, SpecTimeout(5*time.Second))
+
+	It("should abort access changes on a busy bucket", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+		Eventually(started).Should(Receive(Equal(testBucketName)))
+
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{BucketId: testBucketName, Name: "ba-test"})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+		_, err = provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: testBucketName, AccountId: "ba-test"})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+		close(release)
+		wg.Wait()
+		Expect(<-errs).To(Succeed())
+	}, SpecTimeout(5*time.Second))
+
+	It("should run requests on different buckets concurrently", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 2)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: "bucket-a"}, errs)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: "bucket-b"}, errs)
+		Eventually(started).Should(Receive())
+		Eventually(started).Should(Receive())
+
+		close(release)
+		wg.Wait()
+		Expect(<-errs).To(Succeed())
+		Expect(<-errs).To(Succeed())
+	}, SpecTimeout(5*time.Second))
+
+	It("should stop waiting for an identical request when the context is done", func(ctx SpecContext) {
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+		Eventually(started).Should(Receive(Equal(testBucketName)))
+
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		_, err := provisioner.DriverCreateBucket(waitCtx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName})
+		Expect(status.Code(err)).To(Equal(codes.DeadlineExceeded))
+
+		close(release)
+		wg.Wait()
+		Expect(<-errs).To(Succeed())
+	}, SpecTimeout(5*time.Second))
+
+	It("should count operations by secret and result code", func(ctx SpecContext) {
+		const secret = "default/s3-secret"
+		parameters := map[string]string{"objectStorageSecretName": "s3-secret", "objectStorageSecretNamespace": "default"}
+		succeeded := metrics.OperationsTotal.WithLabelValues(constants.ActionCreateBucket, secret, codes.OK.String())
+		aborted := metrics.OperationsTotal.WithLabelValues(constants.ActionCreateBucket, "", codes.Aborted.String())
+		initialSucceeded, initialAborted := testutil.ToFloat64(succeeded), testutil.ToFloat64(aborted)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 1)
+		createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName, Parameters: parameters}, errs)
+		Eventually(started).Should(Receive(Equal(testBucketName)))
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+		close(release)
+		wg.Wait()
+		Expect(<-errs).To(Succeed())
+		Expect(testutil.ToFloat64(succeeded)).To(Equal(initialSucceeded + 1))
+		Expect(testutil.ToFloat64(aborted)).To(Equal(initialAborted + 1))
+		Expect(testutil.CollectAndCount(metrics.OperationDuration, "test_driver_prefix_operation_duration_seconds")).To(BeNumerically(">=", 2))
+	}, SpecTimeout(5*time.Second))
+
+	It("should fail the request with codes.Internal when an operation panics", func(ctx SpecContext) {
+		mockS3 := &mock.MockS3Client{
+			CreateBucketFunc: func(ctx context.Context, input *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+				var output *s3.CreateBucketOutput
+				_ = *output.Location
+				return output, nil
+			},
+		}
+		s3Params := createTestS3Params()
+		mockInitializeClient("S3", &s3client.S3Client{S3Service: mockS3}, &s3Params, nil)
+		panics := metrics.PanicsTotal.WithLabelValues(metrics.PanicSourceOperation, constants.ActionCreateBucket)
+		initialPanics := testutil.ToFloat64(panics)
+
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(testutil.ToFloat64(panics)).To(Equal(initialPanics + 1))
+
+		// The bucket is released and the driver keeps serving requests
+		_, err = provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(testutil.ToFloat64(panics)).To(Equal(initialPanics + 2))
+	}, SpecTimeout(5*time.Second))
+
+	Context("when draining operations", func() {
+		var (
+			opCtxs       chan context.Context
+			ignoreCancel atomic.Bool
+			returned     atomic.Int32
+		)
+
+		BeforeEach(func() {
+			opCtxs = make(chan context.Context, 1)
+			ignoreCancel.Store(false)
+			returned.Store(0)
+			originalGracePeriod := driver.DrainCancelGracePeriod
+			DeferCleanup(func() { driver.DrainCancelGracePeriod = originalGracePeriod })
+			mockS3 := &mock.MockS3Client{
+				CreateBucketFunc: func(ctx context.Context, input *s3.CreateBucketInput, _ ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+					defer returned.Add(1)
+					opCtxs <- ctx
+					started <- *input.Bucket
+					if ignoreCancel.Load() {
+						<-release
+						return &s3.CreateBucketOutput{}, nil
+					}
+					select {
+					case <-release:
+						return &s3.CreateBucketOutput{}, nil
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				},
+			}
+			s3Params := createTestS3Params()
+			mockInitializeClient("S3", &s3client.S3Client{S3Service: mockS3}, &s3Params, nil)
+		})
+
+		It("should return immediately when no operation is in progress", func(ctx SpecContext) {
+			Expect(provisioner.Drain(ctx)).To(BeEmpty())
+		}, SpecTimeout(5*time.Second))
+
+		It("should wait for operations in progress to complete", func(ctx SpecContext) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 1)
+			createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+			Eventually(started).Should(Receive(Equal(testBucketName)))
+
+			drained := make(chan []string, 1)
+			go func() {
+				drained <- provisioner.Drain(ctx)
+			}()
+			Consistently(drained, 100*time.Millisecond).ShouldNot(Receive())
+
+			close(release)
+			Eventually(drained).Should(Receive(BeEmpty()))
+			wg.Wait()
+			Expect(<-errs).To(Succeed())
+		}, SpecTimeout(5*time.Second))
+
+		It("should keep operations running when the caller goes away", func(ctx SpecContext) {
+			callerCtx, cancel := context.WithCancel(ctx)
+			var wg sync.WaitGroup
+			errs := make(chan error, 1)
+			createBucket(callerCtx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+			Eventually(started).Should(Receive(Equal(testBucketName)))
+			opCtx := <-opCtxs
+
+			cancel()
+			wg.Wait()
+			Expect(status.Code(<-errs)).To(Equal(codes.Canceled))
+			Consistently(opCtx.Done(), 100*time.Millisecond).ShouldNot(BeClosed())
+
+			close(release)
+			Eventually(func() []string { return provisioner.Drain(ctx) }).Should(BeEmpty())
+		}, SpecTimeout(5*time.Second))
+
+		It("should interrupt operations still in progress when the drain times out", func(ctx SpecContext) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 1)
+			createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+			Eventually(started).Should(Receive(Equal(testBucketName)))
+			opCtx := <-opCtxs
+
+			drainCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			Expect(provisioner.Drain(drainCtx)).To(Equal([]string{"CreateBucket bucket/" + testBucketName}))
+			Expect(opCtx.Done()).To(BeClosed())
+			// Drain waits for the interrupted operation to return
+			Expect(returned.Load()).To(Equal(int32(1)))
+
+			wg.Wait()
+			Expect(<-errs).To(HaveOccurred())
+		}, SpecTimeout(5*time.Second))
+
+		It("should stop waiting for interrupted operations after the grace period", func(ctx SpecContext) {
+			driver.DrainCancelGracePeriod = 100 * time.Millisecond
+			ignoreCancel.Store(true)
+			var wg sync.WaitGroup
+			errs := make(chan error, 1)
+			createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: testBucketName}, errs)
+			Eventually(started).Should(Receive(Equal(testBucketName)))
+
+			drainCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+			defer cancel()
+			Expect(provisioner.Drain(drainCtx)).To(Equal([]string{"CreateBucket bucket/" + testBucketName}))
+			Expect(returned.Load()).To(BeZero())
+
+			close(release)
+			wg.Wait()
+			Expect(<-errs).To(Succeed())
+		}, SpecTimeout(5*time.Second))
+	})
+
+	Context("with a limit on concurrent operations", func() {
+		var originalLimiters *ratelimit.Registry
+
+		BeforeEach(func() {
+			originalLimiters = ratelimit.Limiters
+			ratelimit.Limiters = ratelimit.NewRegistry(ratelimit.Config{MaxConcurrent: 1, MaxQueued: 1}, ratelimit.Config{})
+		})
+
+		AfterEach(func() {
+			ratelimit.Limiters = originalLimiters
+		})
+
+		It("should queue operations over the limit and reject them once the queue is full", func(ctx SpecContext) {
+			var wg sync.WaitGroup
+			errs := make(chan error, 2)
+			createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: "bucket-a"}, errs)
+			Eventually(started).Should(Receive(Equal("bucket-a")))
+			createBucket(ctx, &wg, &cosiapi.DriverCreateBucketRequest{Name: "bucket-b"}, errs)
+			Eventually(func() float64 {
+				return testutil.ToFloat64(metrics.LimiterQueueDepth.WithLabelValues(ratelimit.OperationsLimiter))
+			}).Should(Equal(1.0))
+
+			_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: "bucket-c"})
+			Expect(status.Code(err)).To(Equal(codes.ResourceExhausted))
+
+			close(release)
+			wg.Wait()
+			Expect(<-errs).To(Succeed())
+			Expect(<-errs).To(Succeed())
+			Expect(calls.Load()).To(Equal(int32(2)))
+		}, SpecTimeout(5*time.Second))
+	})
+})
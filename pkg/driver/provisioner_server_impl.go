@@ -19,18 +19,24 @@ import (
 	"context"
 	"errors"
 	"os"
+	"slices"
+	"strings"
 
 	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
 	s3client "github.com/scality/cosi-driver/pkg/clients/s3"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
+	vaultclient "github.com/scality/cosi-driver/pkg/clients/vault"
 	constants "github.com/scality/cosi-driver/pkg/constants"
 	"github.com/scality/cosi-driver/pkg/osperrors"
 	"github.com/scality/cosi-driver/pkg/util"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
 	bucketclientset "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned"
 	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
 )
@@ -40,6 +46,9 @@ type ProvisionerServer struct {
 	Clientset       kubernetes.Interface
 	KubeConfig      *rest.Config
 	BucketClientset bucketclientset.Interface
+
+	operations     operations
+	bucketAccesses bucketAccessCache
 }
 
 var _ cosiapi.ProvisionerServer = &ProvisionerServer{}
@@ -55,6 +64,7 @@ var (
 	}
 )
 var InitializeClient = initializeObjectStorageClient
+var NewStorageClient = newStorageClient
 var FetchSecretInformation = fetchObjectStorageProviderSecretInfo
 var FetchParameters = fetchS3Parameters
 
@@ -105,15 +115,41 @@ func InitProvisionerServer(provisioner string) (cosiapi.ProvisionerServer, error
 //	codes.AlreadyExists -   Bucket already exists. No more retries
 //	non-nil err -           Internal error                                [requeue'd with exponential backoff]
 func (s *ProvisionerServer) DriverCreateBucket(ctx context.Context,
+	req *cosiapi.DriverCreateBucketRequest) (*cosiapi.DriverCreateBucketResponse, error) {
+	resp, err := s.operations.run(ctx, constants.ActionCreateBucket, []string{bucketResource(req.GetName())}, req, func(ctx context.Context) (interface{}, error) {
+		return s.createBucket(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*cosiapi.DriverCreateBucketResponse), nil
+}
+
+func (s *ProvisionerServer) createBucket(ctx context.Context,
 	req *cosiapi.DriverCreateBucketRequest) (*cosiapi.DriverCreateBucketResponse, error) {
 	klog.V(constants.LvlTrace).InfoS("DriverCreateBucket request received", "request", req)
 	bucketName := req.GetName()
 	parameters := req.GetParameters()
 	service := "S3"
+	setOperationSecret(ctx, parameters)
 
 	klog.V(constants.LvlInfo).InfoS("Processing DriverCreateBucket request", "bucketName", bucketName)
 
-	client, s3Params, err := InitializeClient(ctx, s.Clientset, parameters, service)
+	accountScope, err := ParseVaultAccountScope(parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid Vault account settings", "bucketName", bucketName)
+		return nil, err
+	}
+	var bucket *bucketv1alpha1.Bucket
+	if accountScope == VaultAccountScopeNamespace {
+		bucket, err = s.BucketClientset.ObjectstorageV1alpha1().Buckets().Get(ctx, bucketName, metav1.GetOptions{})
+		if err != nil {
+			klog.ErrorS(err, "Failed to fetch bucket object", "bucketName", bucketName)
+			return nil, status.Error(codes.Internal, "failed to get bucket object from kubernetes")
+		}
+	}
+
+	client, s3Params, err := s.initializeBucketClient(ctx, constants.ActionCreateBucket, bucket, parameters, service)
 	if err != nil {
 		klog.ErrorS(err, "Failed to initialize S3 client", "bucketName", bucketName)
 		return nil, status.Error(codes.Internal, "failed to initialize object storage provider S3 client")
@@ -147,6 +183,17 @@ func (s *ProvisionerServer) DriverCreateBucket(ctx context.Context,
 //	nil -                   Bucket successfully deleted
 //	non-nil err -           Internal error                                [requeue'd with exponential backoff]
 func (s *ProvisionerServer) DriverDeleteBucket(ctx context.Context,
+	req *cosiapi.DriverDeleteBucketRequest) (*cosiapi.DriverDeleteBucketResponse, error) {
+	resp, err := s.operations.run(ctx, constants.ActionDeleteBucket, []string{bucketResource(req.GetBucketId())}, req, func(ctx context.Context) (interface{}, error) {
+		return s.deleteBucket(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*cosiapi.DriverDeleteBucketResponse), nil
+}
+
+func (s *ProvisionerServer) deleteBucket(ctx context.Context,
 	req *cosiapi.DriverDeleteBucketRequest) (*cosiapi.DriverDeleteBucketResponse, error) {
 	klog.V(constants.LvlTrace).InfoS("DriverDeleteBucket request received", "request", req)
 
@@ -159,8 +206,9 @@ func (s *ProvisionerServer) DriverDeleteBucket(ctx context.Context,
 		return nil, status.Error(codes.Internal, "failed to get bucket object from kubernetes")
 	}
 	klog.V(constants.LvlTrace).InfoS("Successfully fetched Bucket object", "bucketName", bucket.Name, "parameters", bucket.Spec.Parameters)
+	setOperationSecret(ctx, bucket.Spec.Parameters)
 
-	client, _, err := InitializeClient(ctx, s.Clientset, bucket.Spec.Parameters, "S3")
+	client, _, err := s.initializeBucketClient(ctx, constants.ActionDeleteBucket, bucket, bucket.Spec.Parameters, "S3")
 	if err != nil {
 		klog.ErrorS(err, "Failed to initialize S3 client for bucket deletion", "bucketName", bucketName)
 		return nil, status.Error(codes.Internal, "failed to initialize object storage provider S3 client")
@@ -192,15 +240,72 @@ func (s *ProvisionerServer) DriverDeleteBucket(ctx context.Context,
 //	non-nil err -           Internal error                                [requeue'd with exponential backoff]
 func (s *ProvisionerServer) DriverGrantBucketAccess(ctx context.Context,
 	req *cosiapi.DriverGrantBucketAccessRequest) (*cosiapi.DriverGrantBucketAccessResponse, error) {
+	access, err := s.findBucketAccess(ctx, req.GetName(), bucketAccessRequired(req.GetParameters()))
+	if err != nil {
+		klog.V(constants.LvlDebug).InfoS("BucketAccess of the account not found", "userName", req.GetName(), "error", err)
+	}
+	// Lock the user revokes act on, which differs from the account for shared users, and the bucket DeleteBucket acts on
+	resources := []string{bucketResource(req.GetBucketId()), accountResource(grantUserName(req, access))}
+	resp, err := s.operations.run(ctx, constants.ActionGrantBucketAccess, resources, req, func(ctx context.Context) (interface{}, error) {
+		return s.grantBucketAccess(ctx, req, access)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*cosiapi.DriverGrantBucketAccessResponse), nil
+}
+
+func (s *ProvisionerServer) grantBucketAccess(ctx context.Context,
+	req *cosiapi.DriverGrantBucketAccessRequest, access *bucketv1alpha1.BucketAccess) (*cosiapi.DriverGrantBucketAccessResponse, error) {
 	klog.V(constants.LvlTrace).InfoS("DriverGrantBucketAccess request received", "request", req)
 
 	bucketName := req.GetBucketId()
 	userName := req.GetName()
 	parameters := req.GetParameters()
+	setOperationSecret(ctx, parameters)
 
 	klog.V(constants.LvlInfo).InfoS("Processing DriverGrantBucketAccess request", "bucketName", bucketName, "userName", userName)
 
-	client, iamParams, err := InitializeClient(ctx, s.Clientset, parameters, "IAM")
+	if _, err := ParseKeyRotationPolicy(parameters); err != nil {
+		klog.ErrorS(err, "Invalid key rotation settings", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+	sessionPolicy, err := ParseSessionPolicy(parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid session credential settings", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+	userScope, err := ParseUserScope(parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid IAM user scope", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+	userOptions, err := ParseUserOptions(parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid IAM user settings", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+	bucketPolicy, err := ParseBucketPolicy(parameters)
+	if err != nil {
+		klog.ErrorS(err, "Invalid bucket policy settings", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+
+	// The Bucket object is only needed to find its Vault account, without it the object storage secret is used
+	bucket, err := s.BucketClientset.ObjectstorageV1alpha1().Buckets().Get(ctx, bucketName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.ErrorS(err, "Failed to fetch bucket object", "bucketName", bucketName)
+			return nil, status.Error(codes.Internal, "failed to get bucket object from kubernetes")
+		}
+		bucket = nil
+	}
+	if err := checkVaultAccountSupport(bucket, parameters); err != nil {
+		klog.ErrorS(err, "Unsupported settings for buckets of Vault accounts", "bucketName", bucketName, "userName", userName)
+		return nil, err
+	}
+
+	client, iamParams, err := s.initializeBucketClient(ctx, constants.ActionGrantBucketAccess, bucket, parameters, "IAM")
 
 	if err != nil {
 		klog.ErrorS(err, "Failed to initialize IAM client", "bucketName", bucketName, "userName", userName)
@@ -213,11 +318,62 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(ctx context.Context,
 		return nil, status.Error(codes.Internal, "failed to initialize object storage provider IAM client")
 	}
 
-	klog.V(constants.LvlInfo).InfoS("Granting bucket access", "bucketName", bucketName, "userName", userName)
-	userInfo, err := iamClient.CreateBucketAccess(ctx, userName, bucketName)
-	if err != nil {
-		if translatedErr := osperrors.TranslateIAMError(constants.ActionGrantBucketAccess, userName, err); translatedErr != nil {
-			return nil, translatedErr
+	// The COSI sidecar only writes the endpoint, region and access keys to the credentials secret
+	secrets := map[string]string{
+		"endpoint": iamParams.Endpoint,
+		"region":   iamParams.Region,
+	}
+
+	if sessionPolicy.Enabled {
+		client, _, err := InitializeClient(ctx, s.Clientset, parameters, "STS")
+		if err != nil {
+			klog.ErrorS(err, "Failed to initialize STS client", "bucketName", bucketName, "userName", userName)
+			return nil, status.Error(codes.Internal, "failed to initialize object storage provider STS client")
+		}
+		stsClient, ok := client.(*stsclient.STSClient)
+		if !ok {
+			klog.ErrorS(nil, "Unsupported client type for session credentials", "bucketName", bucketName, "userName", userName)
+			return nil, status.Error(codes.Internal, "failed to initialize object storage provider STS client")
+		}
+
+		klog.V(constants.LvlInfo).InfoS("Granting bucket access with session credentials", "bucketName", bucketName, "roleName", userName, "sessionDuration", sessionPolicy.Duration)
+		session, err := grantSessionAccess(ctx, iamClient, stsClient, userName, bucketName, bucketPolicy, sessionPolicy)
+		if err != nil {
+			return nil, osperrors.TranslateIAMError(constants.ActionGrantBucketAccess, userName, err)
+		}
+		// The COSI sidecar only writes the access keys to the credentials secret, the session token and
+		// expiration are added once it is created. Without the BucketAccess, the refresh check renews them.
+		secrets["accessKeyID"] = *session.AccessKeyId
+		secrets["accessSecretKey"] = *session.SecretAccessKey
+		if access != nil {
+			go s.completeSessionSecret(context.WithoutCancel(ctx), access, userName, session)
+		}
+		userName = sessionAccountPrefix + userName
+	} else {
+		options, err := s.resolveUserOptions(userOptions, userScope, access)
+		if err != nil {
+			return nil, err
+		}
+
+		if userScope != UserScopeBucketAccess {
+			sharedUserName, keySecret, err := s.grantSharedAccess(ctx, iamClient, userScope, access, bucketName, bucketPolicy, options)
+			if err != nil {
+				return nil, err
+			}
+			userName = sharedUserName
+			secrets["accessKeyID"] = string(keySecret.Data["accessKeyID"])
+			secrets["accessSecretKey"] = string(keySecret.Data["accessSecretKey"])
+		} else {
+			klog.V(constants.LvlInfo).InfoS("Granting bucket access", "bucketName", bucketName, "userName", userName, "path", options.Path,
+				"policyMode", bucketPolicy.Mode, "accessMode", bucketPolicy.AccessMode)
+			userInfo, err := iamClient.CreateBucketAccess(ctx, userName, bucketName, bucketPolicy, options)
+			if err != nil {
+				if translatedErr := osperrors.TranslateIAMError(constants.ActionGrantBucketAccess, userName, err); translatedErr != nil {
+					return nil, translatedErr
+				}
+			}
+			secrets["accessKeyID"] = *userInfo.AccessKey.AccessKeyId
+			secrets["accessSecretKey"] = *userInfo.AccessKey.SecretAccessKey
 		}
 	}
 
@@ -226,12 +382,7 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(ctx context.Context,
 		AccountId: userName,
 		Credentials: map[string]*cosiapi.CredentialDetails{
 			"s3": {
-				Secrets: map[string]string{
-					"accessKeyID":     *userInfo.AccessKey.AccessKeyId,
-					"accessSecretKey": *userInfo.AccessKey.SecretAccessKey,
-					"endpoint":        iamParams.Endpoint,
-					"region":          iamParams.Region,
-				},
+				Secrets: secrets,
 			},
 		},
 	}, nil
@@ -246,6 +397,18 @@ func (s *ProvisionerServer) DriverGrantBucketAccess(ctx context.Context,
 //	nil -                   Bucket access successfully deleted
 //	non-nil err -           Internal error                                [requeue'd with exponential backoff]
 func (s *ProvisionerServer) DriverRevokeBucketAccess(ctx context.Context,
+	req *cosiapi.DriverRevokeBucketAccessRequest) (*cosiapi.DriverRevokeBucketAccessResponse, error) {
+	resources := []string{bucketResource(req.GetBucketId()), accountResource(accountUserName(req.GetAccountId()))}
+	resp, err := s.operations.run(ctx, constants.ActionRevokeBucketAccess, resources, req, func(ctx context.Context) (interface{}, error) {
+		return s.revokeBucketAccess(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.(*cosiapi.DriverRevokeBucketAccessResponse), nil
+}
+
+func (s *ProvisionerServer) revokeBucketAccess(ctx context.Context,
 	req *cosiapi.DriverRevokeBucketAccessRequest) (*cosiapi.DriverRevokeBucketAccessResponse, error) {
 	klog.V(constants.LvlTrace).InfoS("DriverRevokeBucketAccess request received", "request", req)
 
@@ -261,8 +424,9 @@ func (s *ProvisionerServer) DriverRevokeBucketAccess(ctx context.Context,
 		return nil, status.Error(codes.Internal, "failed to get bucket object from kubernetes")
 	}
 	klog.V(constants.LvlTrace).InfoS("Successfully fetched Bucket object", "bucketName", bucket.Name, "parameters", bucket.Spec.Parameters)
+	setOperationSecret(ctx, bucket.Spec.Parameters)
 
-	client, _, err := InitializeClient(ctx, s.Clientset, bucket.Spec.Parameters, "IAM")
+	client, _, err := s.initializeBucketClient(ctx, constants.ActionRevokeBucketAccess, bucket, bucket.Spec.Parameters, "IAM")
 	if err != nil {
 		klog.ErrorS(err, "Failed to initialize IAM client", "bucketName", bucketName, "userName", userName)
 		return nil, status.Error(codes.Internal, "failed to initialize object storage provider IAM client")
@@ -275,14 +439,35 @@ func (s *ProvisionerServer) DriverRevokeBucketAccess(ctx context.Context,
 	}
 
 	klog.V(constants.LvlInfo).InfoS("Revoking bucket access", "bucketName", bucketName, "userName", userName)
-	err = iamClient.RevokeBucketAccess(ctx, userName, bucketName)
+	result := &iamclient.RevokeResult{}
+	roleName, isSession := sessionRoleName(userName)
+	switch {
+	case isSession:
+		// Session credentials are issued for a role, the account has no IAM user
+		err = iamClient.DeleteBucketAccessRole(ctx, roleName, bucketName)
+	case strings.HasPrefix(userName, bucketAccessAccountPrefix):
+		result, err = iamClient.RevokeBucketAccess(ctx, userName, bucketName)
+	default:
+		result, err = s.revokeSharedAccess(ctx, iamClient, userName, bucketName)
+	}
 	if err != nil {
 		if translatedErr := osperrors.TranslateIAMError(constants.ActionRevokeBucketAccess, userName, err); translatedErr != nil {
+			klog.ErrorS(err, "Failed to revoke bucket access", "bucketName", bucketName, "userName", userName, "removed", result)
 			return nil, translatedErr
 		}
 	}
 
-	klog.V(constants.LvlInfo).InfoS("Successfully revoked bucket access", "bucketName", bucketName, "userName", userName)
+	// Shared IAM users are only deleted with their last bucket, their stored access key goes with them
+	if result.UserGone() {
+		if err := s.deleteSharedUserSecret(ctx, userName); err != nil {
+			klog.ErrorS(err, "Failed to delete access key secret of shared IAM user", "userName", userName)
+			return nil, status.Error(codes.Internal, "failed to delete shared IAM user secret")
+		}
+	}
+
+	klog.V(constants.LvlInfo).InfoS("Successfully revoked bucket access", "bucketName", bucketName, "userName", userName,
+		"inlinePoliciesDeleted", result.InlinePolicies, "managedPoliciesDetached", result.ManagedPolicies, "groupsLeft", result.Groups,
+		"accessKeysDeleted", result.AccessKeys, "userDeleted", result.UserDeleted, "userMissing", result.UserMissing, "remaining", result.Remaining)
 	return &cosiapi.DriverRevokeBucketAccessResponse{}, nil
 }
 
@@ -309,27 +494,69 @@ func initializeObjectStorageClient(ctx context.Context, clientset kubernetes.Int
 		return nil, nil, err
 	}
 
-	var client interface{}
+	// BucketClass and BucketAccessClass parameters override the retry settings of the secret
+	if err := storageClientParameters.SetRetryOptions(parameters); err != nil {
+		klog.ErrorS(err, "Invalid retry settings in parameters", "secretName", ospSecretName)
+		return nil, nil, err
+	}
+
+	if storageClientParameters.CABundleConfigMap != "" {
+		caBundle, err := CABundles.Get(ctx, clientset, namespace, storageClientParameters.CABundleConfigMap, storageClientParameters.CABundleConfigMapKey)
+		if err != nil {
+			klog.ErrorS(err, "Failed to load CA bundle", "configMap", storageClientParameters.CABundleConfigMap, "namespace", namespace)
+			return nil, nil, status.Error(codes.Internal, "failed to load CA bundle")
+		}
+		// Build a new slice: appending in place could write into the secret data the TLS certificate comes from
+		storageClientParameters.TLSCert = slices.Concat(storageClientParameters.TLSCert, []byte{'\n'}, caBundle)
+		klog.V(constants.LvlDebug).InfoS("Loaded CA bundle from ConfigMap", "configMap", storageClientParameters.CABundleConfigMap, "namespace", namespace)
+	}
+
+	client, err := NewStorageClient(ctx, service, *storageClientParameters)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, storageClientParameters, nil
+}
+
+// newStorageClient builds the client of an object storage provider service from its parameters.
+func newStorageClient(ctx context.Context, service string, params util.StorageClientParameters) (interface{}, error) {
 	switch service {
 	case "S3":
-		client, err = s3client.InitS3Client(ctx, *storageClientParameters)
+		client, err := s3client.InitS3Client(ctx, params)
 		if err != nil {
-			klog.ErrorS(err, "Failed to initialize S3 client", "endpoint", storageClientParameters.Endpoint)
-			return nil, nil, status.Error(codes.Internal, "failed to initialize S3 client")
+			klog.ErrorS(err, "Failed to initialize S3 client", "endpoint", params.Endpoint)
+			return nil, status.Error(codes.Internal, "failed to initialize S3 client")
 		}
-		klog.V(constants.LvlDebug).InfoS("Successfully initialized S3 client", "endpoint", storageClientParameters.Endpoint)
+		klog.V(constants.LvlDebug).InfoS("Successfully initialized S3 client", "endpoint", params.Endpoint)
+		return client, nil
 	case "IAM":
-		client, err = iamclient.InitIAMClient(ctx, *storageClientParameters)
+		client, err := iamclient.InitIAMClient(ctx, params)
+		if err != nil {
+			klog.ErrorS(err, "Failed to initialize IAM client", "endpoint", params.IAMEndpoint)
+			return nil, status.Error(codes.Internal, "failed to initialize IAM client")
+		}
+		klog.V(constants.LvlDebug).InfoS("Successfully initialized IAM client", "endpoint", params.IAMEndpoint)
+		return client, nil
+	case "STS":
+		client, err := stsclient.InitSTSClient(ctx, params)
 		if err != nil {
-			klog.ErrorS(err, "Failed to initialize IAM client", "endpoint", storageClientParameters.IAMEndpoint)
-			return nil, nil, status.Error(codes.Internal, "failed to initialize IAM client")
+			klog.ErrorS(err, "Failed to initialize STS client", "endpoint", params.STSEndpoint)
+			return nil, status.Error(codes.Internal, "failed to initialize STS client")
 		}
-		klog.V(constants.LvlDebug).InfoS("Successfully initialized IAM client", "endpoint", storageClientParameters.IAMEndpoint)
+		klog.V(constants.LvlDebug).InfoS("Successfully initialized STS client", "endpoint", params.STSEndpoint)
+		return client, nil
+	case "Vault":
+		client, err := vaultclient.InitVaultClient(ctx, params)
+		if err != nil {
+			klog.ErrorS(err, "Failed to initialize Vault client", "endpoint", params.VaultEndpoint)
+			return nil, status.Error(codes.Internal, "failed to initialize Vault client")
+		}
+		klog.V(constants.LvlDebug).InfoS("Successfully initialized Vault client", "endpoint", params.VaultEndpoint)
+		return client, nil
 	default:
 		klog.ErrorS(nil, "Unsupported object storage provider service", "service", service)
-		return nil, nil, status.Error(codes.Internal, "unsupported object storage provider service")
+		return nil, status.Error(codes.Internal, "unsupported object storage provider service")
 	}
-	return client, storageClientParameters, nil
 }
 
 func fetchObjectStorageProviderSecretInfo(parameters map[string]string) (string, string, error) {
@@ -359,22 +586,87 @@ func fetchS3Parameters(secretData map[string][]byte) (*util.StorageClientParamet
 	params.Endpoint = string(secretData["endpoint"])
 	params.Region = string(secretData["region"])
 
+	// roleArn replaces the static keys: the driver assumes the role with its service account token
+	params.RoleARN = string(secretData["roleArn"])
+	if params.RoleARN != "" {
+		params.WebIdentityTokenFile = util.DefaultWebIdentityTokenFile
+		if value, exists := secretData["webIdentityTokenFile"]; exists && len(value) > 0 {
+			params.WebIdentityTokenFile = string(value)
+		}
+		klog.V(constants.LvlTrace).InfoS("Role to assume with web identity specified", "roleArn", params.RoleARN, "tokenFile", params.WebIdentityTokenFile)
+	}
+
+	// endpoint may hold a comma-separated list of endpoints of the same backend for failover
+	if endpoints := splitEndpoints(params.Endpoint); len(endpoints) > 1 {
+		params.Endpoint = endpoints[0]
+		params.Endpoints = endpoints
+	}
+
 	if cert, exists := secretData["tlsCert"]; exists {
 		params.TLSCert = cert
 	} else {
 		klog.V(constants.LvlTrace).InfoS("TLS certificate not provided, proceeding without it")
 	}
 
-	if err := params.Validate(); err != nil {
-		klog.ErrorS(err, "Invalid object storage parameters")
+	if value, exists := secretData["caBundleConfigMap"]; exists && len(value) > 0 {
+		params.CABundleConfigMap = string(value)
+		params.CABundleConfigMapKey = string(secretData["caBundleConfigMapKey"])
+		klog.V(constants.LvlTrace).InfoS("CA bundle ConfigMap specified", "configMap", params.CABundleConfigMap, "key", params.CABundleConfigMapKey)
+	}
+
+	if value, exists := secretData["addressingStyle"]; exists && len(value) > 0 {
+		params.AddressingStyle = string(value)
+	}
+	params.HTTPProxy = string(secretData["httpProxy"])
+	params.NoProxy = string(secretData["noProxy"])
+
+	retrySettings := map[string]string{}
+	for _, key := range []string{"requestTimeout", "maxAttempts", "maxBackoff", "retryMode"} {
+		retrySettings[key] = string(secretData[key])
+	}
+	if err := params.SetRetryOptions(retrySettings); err != nil {
+		klog.ErrorS(err, "Invalid retry settings in object storage provider secret")
 		return nil, err
 	}
 
 	params.IAMEndpoint = params.Endpoint
+	params.IAMEndpoints = params.Endpoints
 	if value, exists := secretData["iamEndpoint"]; exists && len(value) > 0 {
 		params.IAMEndpoint = string(value)
-		klog.V(constants.LvlTrace).InfoS("IAM endpoint specified", "iamEndpoint", params.IAMEndpoint)
+		params.IAMEndpoints = nil
+		if endpoints := splitEndpoints(params.IAMEndpoint); len(endpoints) > 1 {
+			params.IAMEndpoint = endpoints[0]
+			params.IAMEndpoints = endpoints
+		}
+		klog.V(constants.LvlTrace).InfoS("IAM endpoint specified", "iamEndpoint", params.IAMEndpoint, "iamEndpoints", params.IAMEndpoints)
+	}
+
+	params.VaultEndpoint = string(secretData["vaultEndpoint"])
+	params.VaultAccessKeyID = string(secretData["vaultAccessKeyId"])
+	params.VaultSecretAccessKey = string(secretData["vaultSecretAccessKey"])
+
+	params.STSEndpoint = params.IAMEndpoint
+	if value, exists := secretData["stsEndpoint"]; exists && len(value) > 0 {
+		params.STSEndpoint = string(value)
+		klog.V(constants.LvlTrace).InfoS("STS endpoint specified", "stsEndpoint", params.STSEndpoint)
+	}
+
+	if err := params.Validate(); err != nil {
+		klog.ErrorS(err, "Invalid object storage parameters")
+		return nil, err
 	}
+
 	klog.V(constants.LvlTrace).InfoS("Successfully validated object storage parameters", "endpoint", params.Endpoint, "region", params.Region)
 	return params, nil
 }
+
+// splitEndpoints splits a comma-separated list of endpoints, ignoring blanks.
+func splitEndpoints(value string) []string {
+	var endpoints []string
+	for _, endpoint := range strings.Split(value, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	return endpoints
+}
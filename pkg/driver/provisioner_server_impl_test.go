@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/aws/smithy-go"
@@ -54,6 +56,7 @@ var (
 	originalNewKubernetesClient = driver.NewKubernetesClient
 	originalNewBucketClient     = driver.NewBucketClient
 	originalInitializeClient    = driver.InitializeClient
+	originalNewStorageClient    = driver.NewStorageClient
 )
 
 // Helper functions
@@ -544,6 +547,61 @@ var _ = Describe("initializeObjectStorageClient", Ordered, func() {
 		Expect(status.Code(err)).To(Equal(codes.Internal))
 	})
 
+	It("should let parameters override the retry settings of the secret", func(ctx SpecContext) {
+		secret.Data["requestTimeout"] = []byte("10s")
+		secret.Data["maxAttempts"] = []byte("2")
+		_, err := clientset.CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		parameters["requestTimeout"] = "5m"
+
+		_, iamParams, err := driver.InitializeClient(ctx, clientset, parameters, "IAM")
+		Expect(err).To(BeNil())
+		Expect(iamParams.RequestTimeout).To(Equal(5 * time.Minute))
+		Expect(iamParams.MaxAttempts).To(Equal(2))
+	})
+
+	It("should fail if parameters contain invalid retry settings", func(ctx SpecContext) {
+		_, err := clientset.CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		parameters["maxAttempts"] = "-1"
+
+		_, _, err = driver.InitializeClient(ctx, clientset, parameters, "S3")
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should append the CA bundle from the referenced ConfigMap", func(ctx SpecContext) {
+		secret.Data["tlsCert"] = []byte("secret-cert")
+		secret.Data["caBundleConfigMap"] = []byte("ca-bundle")
+		_, err := clientset.CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		_, err = clientset.CoreV1().ConfigMaps(testNamespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: testNamespace},
+			Data:       map[string]string{"ca.crt": "configmap-bundle"},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		defer driver.CABundles.Stop()
+
+		_, iamParams, err := driver.InitializeClient(ctx, clientset, parameters, "IAM")
+		Expect(err).To(BeNil())
+		Expect(string(iamParams.TLSCert)).To(Equal("secret-cert\nconfigmap-bundle"))
+	})
+
+	It("should fail if the CA bundle ConfigMap cannot be loaded", func(ctx SpecContext) {
+		secret.Data["caBundleConfigMap"] = []byte("ca-bundle")
+		secret.Data["caBundleConfigMapKey"] = []byte("missing.pem")
+		_, err := clientset.CoreV1().Secrets(testNamespace).Create(ctx, secret, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		_, err = clientset.CoreV1().ConfigMaps(testNamespace).Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ca-bundle", Namespace: testNamespace},
+			Data:       map[string]string{"ca.crt": "configmap-bundle"},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		defer driver.CABundles.Stop()
+
+		_, _, err = driver.InitializeClient(ctx, clientset, parameters, "S3")
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+	})
+
 	It("should return error when FetchSecretInformation fails", func(ctx SpecContext) {
 		delete(parameters, "objectStorageSecretName")
 
@@ -576,6 +634,58 @@ var _ = Describe("FetchParameters", Ordered, func() {
 		Expect(s3Params.TLSCert).To(Equal([]byte("test-tls-cert")))
 	})
 
+	It("should read the CA bundle ConfigMap reference if present", func() {
+		secretData["caBundleConfigMap"] = []byte("ca-bundle")
+		secretData["caBundleConfigMapKey"] = []byte("trust-bundle.pem")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.CABundleConfigMap).To(Equal("ca-bundle"))
+		Expect(s3Params.CABundleConfigMapKey).To(Equal("trust-bundle.pem"))
+	})
+
+	It("should read proxy settings if present", func() {
+		secretData["httpProxy"] = []byte("http://proxy.internal:3128")
+		secretData["noProxy"] = []byte("localhost,.svc")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.HTTPProxy).To(Equal("http://proxy.internal:3128"))
+		Expect(s3Params.NoProxy).To(Equal("localhost,.svc"))
+	})
+
+	It("should fail if the proxy URL is invalid", func() {
+		secretData["httpProxy"] = []byte("http://proxy internal:3128")
+		_, err := driver.FetchParameters(secretData)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should read retry settings if present", func() {
+		secretData["requestTimeout"] = []byte("45s")
+		secretData["maxAttempts"] = []byte("5")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.RequestTimeout).To(Equal(45 * time.Second))
+		Expect(s3Params.MaxAttempts).To(Equal(5))
+	})
+
+	It("should fail if retry settings are invalid", func() {
+		secretData["retryMode"] = []byte("aggressive")
+		_, err := driver.FetchParameters(secretData)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should read the addressing style if present", func() {
+		secretData["addressingStyle"] = []byte("virtual")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.AddressingStyle).To(Equal(util.AddressingStyleVirtual))
+	})
+
+	It("should fail if the addressing style is invalid", func() {
+		secretData["addressingStyle"] = []byte("dns")
+		_, err := driver.FetchParameters(secretData)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
 	It("should fail if AccessKey missing", func() {
 		delete(secretData, "accessKeyId")
 		_, err := driver.FetchParameters(secretData)
@@ -606,6 +716,71 @@ var _ = Describe("FetchParameters", Ordered, func() {
 		Expect(err).To(BeNil())
 		Expect(s3Params.IAMEndpoint).To(Equal(testEndpoint))
 	})
+
+	It("should assume a role with the default web identity token when roleArn is set", func() {
+		delete(secretData, "accessKeyId")
+		delete(secretData, "secretAccessKey")
+		secretData["roleArn"] = []byte("arn:aws:iam::123456789012:role/cosi-driver")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.RoleARN).To(Equal("arn:aws:iam::123456789012:role/cosi-driver"))
+		Expect(s3Params.WebIdentityTokenFile).To(Equal(util.DefaultWebIdentityTokenFile))
+		Expect(s3Params.STSEndpoint).To(Equal(testIAMEndpoint))
+	})
+
+	It("should use the configured web identity token file and STS endpoint", func() {
+		delete(secretData, "accessKeyId")
+		delete(secretData, "secretAccessKey")
+		secretData["roleArn"] = []byte("arn:aws:iam::123456789012:role/cosi-driver")
+		secretData["webIdentityTokenFile"] = []byte("/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+		secretData["stsEndpoint"] = []byte("https://sts.ring.internal")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.WebIdentityTokenFile).To(Equal("/var/run/secrets/eks.amazonaws.com/serviceaccount/token"))
+		Expect(s3Params.STSEndpoint).To(Equal("https://sts.ring.internal"))
+	})
+
+	It("should read the Vault administration settings", func() {
+		secretData["vaultEndpoint"] = []byte("http://vault.ring.internal:8600")
+		secretData["vaultAccessKeyId"] = []byte("vault-admin-key")
+		secretData["vaultSecretAccessKey"] = []byte("vault-admin-secret")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.VaultEndpoint).To(Equal("http://vault.ring.internal:8600"))
+		Expect(s3Params.VaultAccessKeyID).To(Equal("vault-admin-key"))
+		Expect(s3Params.VaultSecretAccessKey).To(Equal("vault-admin-secret"))
+	})
+
+	It("should fail if roleArn is combined with static keys", func() {
+		secretData["roleArn"] = []byte("arn:aws:iam::123456789012:role/cosi-driver")
+		_, err := driver.FetchParameters(secretData)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should parse comma-separated endpoint lists for failover", func() {
+		secretData["endpoint"] = []byte("https://s3-a.ring.internal, https://s3-b.ring.internal")
+		secretData["iamEndpoint"] = []byte("https://iam-a.ring.internal,https://iam-b.ring.internal,")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.Endpoint).To(Equal("https://s3-a.ring.internal"))
+		Expect(s3Params.Endpoints).To(Equal([]string{"https://s3-a.ring.internal", "https://s3-b.ring.internal"}))
+		Expect(s3Params.IAMEndpoint).To(Equal("https://iam-a.ring.internal"))
+		Expect(s3Params.IAMEndpoints).To(Equal([]string{"https://iam-a.ring.internal", "https://iam-b.ring.internal"}))
+	})
+
+	It("should default IAM endpoints to the S3 endpoint list if none specified", func() {
+		delete(secretData, "iamEndpoint")
+		secretData["endpoint"] = []byte("https://s3-a.ring.internal,https://s3-b.ring.internal")
+		s3Params, err := driver.FetchParameters(secretData)
+		Expect(err).To(BeNil())
+		Expect(s3Params.IAMEndpoints).To(Equal(s3Params.Endpoints))
+	})
+
+	It("should fail if endpoints of a list mix schemes", func() {
+		secretData["endpoint"] = []byte("https://s3-a.ring.internal,http://s3-b.ring.internal")
+		_, err := driver.FetchParameters(secretData)
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
 })
 
 var _ = Describe("ProvisionerServer DriverGrantBucketAccess", Ordered, func() {
@@ -732,8 +907,7 @@ var _ = Describe("ProvisionerServer DriverRevokeBucketAccess", Ordered, func() {
 	})
 
 	It("should fail on user deletion error", func(ctx SpecContext) {
-		// Mock the IAM client to fail on GetUser
-		mockIAMClient.GetUserFunc = func(ctx context.Context, input *iam.GetUserInput, _ ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+		mockIAMClient.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, _ ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
 			return nil, &smithy.GenericAPIError{
 				Code:    "AccessDenied",
 				Message: "Access denied for the operation",
@@ -745,6 +919,21 @@ var _ = Describe("ProvisionerServer DriverRevokeBucketAccess", Ordered, func() {
 		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
 	})
 
+	It("should succeed when the user is already gone", func(ctx SpecContext) {
+		noSuchEntity := &iamtypes.NoSuchEntityException{}
+		mockIAMClient.ListUserPoliciesFunc = func(ctx context.Context, input *iam.ListUserPoliciesInput, _ ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+			return nil, noSuchEntity
+		}
+		mockIAMClient.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, _ ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+			Fail("a missing user should not be deleted")
+			return nil, nil
+		}
+
+		resp, err := provisioner.DriverRevokeBucketAccess(ctx, request)
+		Expect(err).To(BeNil())
+		Expect(resp).NotTo(BeNil())
+	})
+
 	It("should fail if wrong client type returned", func(ctx SpecContext) {
 		mockInitializeClient("IAM", &s3client.S3Client{S3Service: &mock.MockS3Client{}}, nil, nil)
 		resp, err := provisioner.DriverRevokeBucketAccess(ctx, request)
@@ -0,0 +1,81 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"k8s.io/klog/v2"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+// DefaultReadinessCheckInterval is how often the driver checks it can reach the API server.
+const DefaultReadinessCheckInterval = 10 * time.Second
+
+// CheckAPIServer reports whether the Kubernetes clients of the driver are loaded and can reach the API server.
+func (s *ProvisionerServer) CheckAPIServer(ctx context.Context) error {
+	if s.Clientset == nil || s.BucketClientset == nil {
+		return errors.New("kubernetes clients are not initialized")
+	}
+	// ServerVersion does not take a context, so a hung API server would block the check past ctx
+	restClient := s.Clientset.Discovery().RESTClient()
+	if restClient == nil {
+		return errors.New("kubernetes clients do not support requests to the API server")
+	}
+	if err := restClient.Get().AbsPath("/version").Do(ctx).Error(); err != nil {
+		return fmt.Errorf("failed to reach the API server: %w", err)
+	}
+	return nil
+}
+
+// WatchReadiness checks the API server every interval until ctx is done, and calls setReady
+// with the result. A check that does not complete within the interval fails. The driver is reported ready only once the first check succeeds.
+func WatchReadiness(ctx context.Context, provisioner cosiapi.ProvisionerServer, interval time.Duration, setReady func(bool)) {
+	server, ok := provisioner.(*ProvisionerServer)
+	if !ok {
+		klog.ErrorS(nil, "Unsupported provisioner type for readiness checks")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ready := false
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := server.CheckAPIServer(checkCtx)
+		cancel()
+		switch {
+		case err == nil && !ready:
+			klog.V(constants.LvlInfo).InfoS("Driver is ready to serve requests")
+		case err != nil && ready:
+			klog.ErrorS(err, "Driver is no longer ready to serve requests")
+		case err != nil:
+			klog.V(constants.LvlDebug).InfoS("Driver is not ready to serve requests yet", "error", err)
+		}
+		ready = err == nil
+		setReady(ready)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
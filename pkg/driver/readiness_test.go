@@ -0,0 +1,85 @@
+package driver_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+
+	"github.com/scality/cosi-driver/pkg/driver"
+)
+
+var _ = Describe("Readiness", func() {
+	var (
+		provisioner *driver.ProvisionerServer
+		reachable   atomic.Bool
+		hung        atomic.Bool
+	)
+
+	BeforeEach(func() {
+		reachable.Store(true)
+		hung.Store(false)
+		apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if hung.Load() {
+				<-r.Context().Done()
+				return
+			}
+			if !reachable.Load() || r.URL.Path != "/version" {
+				http.Error(w, "connection refused", http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"major":"1","minor":"30","gitVersion":"v1.30.0"}`))
+		}))
+		DeferCleanup(apiServer.Close)
+
+		clientset, err := kubernetes.NewForConfig(&rest.Config{Host: apiServer.URL})
+		Expect(err).NotTo(HaveOccurred())
+		provisioner = createTestProvisionerServer(clientset, bucketclientfake.NewSimpleClientset())
+	})
+
+	It("should fail when the Kubernetes clients are not loaded", func(ctx SpecContext) {
+		Expect((&driver.ProvisionerServer{}).CheckAPIServer(ctx)).To(MatchError(ContainSubstring("not initialized")))
+	})
+
+	It("should fail when the Kubernetes clients cannot send requests", func(ctx SpecContext) {
+		provisioner = createTestProvisionerServer(fake.NewSimpleClientset(), bucketclientfake.NewSimpleClientset())
+		Expect(provisioner.CheckAPIServer(ctx)).To(MatchError(ContainSubstring("do not support requests")))
+	})
+
+	It("should succeed when the API server can be reached", func(ctx SpecContext) {
+		Expect(provisioner.CheckAPIServer(ctx)).To(Succeed())
+	})
+
+	It("should fail when the API server cannot be reached", func(ctx SpecContext) {
+		reachable.Store(false)
+		Expect(provisioner.CheckAPIServer(ctx)).To(MatchError(ContainSubstring("failed to reach the API server")))
+	})
+
+	It("should stop waiting for a hung API server when the context is done", func(ctx SpecContext) {
+		hung.Store(true)
+		checkCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		Expect(provisioner.CheckAPIServer(checkCtx)).To(MatchError(ContainSubstring("failed to reach the API server")))
+	}, SpecTimeout(2*time.Second))
+
+	It("should follow the reachability of the API server", func(ctx SpecContext) {
+		reachable.Store(false)
+		states := make(chan bool, 10)
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go driver.WatchReadiness(watchCtx, provisioner, 10*time.Millisecond, func(ready bool) { states <- ready })
+
+		Eventually(states).Should(Receive(BeFalse()))
+		reachable.Store(true)
+		Eventually(states).Should(Receive(BeTrue()))
+	}, SpecTimeout(2*time.Second))
+})
@@ -0,0 +1,299 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+const (
+	CredentialTypeKey     = "key"
+	CredentialTypeSession = "session"
+
+	DefaultSessionDuration             = time.Hour
+	MinSessionDuration                 = 15 * time.Minute
+	MaxSessionDuration                 = 12 * time.Hour
+	DefaultSessionRefreshCheckInterval = time.Minute
+
+	// sessionAccountPrefix marks the account IDs of session credential grants, so that revokes only delete roles for them
+	sessionAccountPrefix = "session-"
+)
+
+// SessionRefreshCheckInterval is how often session credentials are checked for renewal. Zero disables renewal.
+var SessionRefreshCheckInterval = DefaultSessionRefreshCheckInterval
+
+// SessionSecretWaitTimeout is how long a grant waits for the COSI sidecar to create the credentials secret,
+// to add the session token to it. The next refresh check renews the credentials when it is not created in time.
+var SessionSecretWaitTimeout = 2 * time.Minute
+
+// sessionSecretPollInterval is how often a grant checks whether the credentials secret was created.
+const sessionSecretPollInterval = 500 * time.Millisecond
+
+// SessionPolicy holds the session credential settings of a BucketAccessClass.
+type SessionPolicy struct {
+	Enabled  bool          // Whether the BucketAccessClass issues session credentials instead of access keys
+	Duration time.Duration // Lifetime of the session credentials
+}
+
+// ParseSessionPolicy reads the credentialType and sessionDuration parameters.
+func ParseSessionPolicy(parameters map[string]string) (SessionPolicy, error) {
+	policy := SessionPolicy{Duration: DefaultSessionDuration}
+
+	switch credentialType := parameters["credentialType"]; credentialType {
+	case "", CredentialTypeKey:
+		return policy, nil
+	case CredentialTypeSession:
+		policy.Enabled = true
+	default:
+		return policy, status.Errorf(codes.InvalidArgument, "credentialType must be %q or %q, got %q", CredentialTypeKey, CredentialTypeSession, credentialType)
+	}
+
+	if parameters["keyRotationInterval"] != "" {
+		return policy, status.Error(codes.InvalidArgument, "keyRotationInterval cannot be combined with session credentials")
+	}
+	if value := parameters["sessionDuration"]; value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < MinSessionDuration || duration > MaxSessionDuration {
+			return policy, status.Errorf(codes.InvalidArgument, "sessionDuration must be a duration between %s and %s, got %q", MinSessionDuration, MaxSessionDuration, value)
+		}
+		policy.Duration = duration
+	}
+	return policy, nil
+}
+
+// sessionRoleName returns the name of the role of an account ID returned by a session credential grant,
+// and false for the account IDs of IAM users.
+func sessionRoleName(accountID string) (string, bool) {
+	return strings.CutPrefix(accountID, sessionAccountPrefix)
+}
+
+// accountUserName returns the IAM user or role an account ID stands for.
+func accountUserName(accountID string) string {
+	roleName, _ := sessionRoleName(accountID)
+	return roleName
+}
+
+// initializeSessionClients returns the IAM and STS clients used to manage session credentials.
+func initializeSessionClients(ctx context.Context, s *ProvisionerServer, parameters map[string]string) (*iamclient.IAMClient, *stsclient.STSClient, error) {
+	client, _, err := InitializeClient(ctx, s.Clientset, parameters, "IAM")
+	if err != nil {
+		return nil, nil, err
+	}
+	iamClient, ok := client.(*iamclient.IAMClient)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported client type for IAM operations")
+	}
+
+	client, _, err = InitializeClient(ctx, s.Clientset, parameters, "STS")
+	if err != nil {
+		return nil, nil, err
+	}
+	stsClient, ok := client.(*stsclient.STSClient)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported client type for STS operations")
+	}
+	return iamClient, stsClient, nil
+}
+
+// grantSessionAccess creates the role scoped to the bucket and assumes it for the session duration.
+func grantSessionAccess(ctx context.Context, iamClient *iamclient.IAMClient, stsClient *stsclient.STSClient,
+	roleName, bucketName string, bucketPolicy iamclient.BucketPolicy, policy SessionPolicy) (*types.Credentials, error) {
+	account, err := stsClient.GetCallerAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roleArn, err := iamClient.CreateBucketAccessRole(ctx, roleName, bucketName, bucketPolicy, account, policy.Duration)
+	if err != nil {
+		return nil, err
+	}
+	return stsClient.AssumeRole(ctx, roleArn, roleName, policy.Duration)
+}
+
+// sessionSecrets returns the entries of the s3 credentials written to the credentials secret for session credentials.
+func sessionSecrets(credentials *types.Credentials) map[string]string {
+	return map[string]string{
+		"accessKeyID":     *credentials.AccessKeyId,
+		"accessSecretKey": *credentials.SecretAccessKey,
+		"sessionToken":    *credentials.SessionToken,
+		"expiration":      credentials.Expiration.UTC().Format(time.RFC3339),
+	}
+}
+
+// completeSessionSecret adds the session token and expiration of the credentials returned by a grant to
+// the credentials secret, as soon as the COSI sidecar creates it with the access keys.
+func (s *ProvisionerServer) completeSessionSecret(ctx context.Context, access *bucketv1alpha1.BucketAccess, roleName string, session *types.Credentials) {
+	ctx, cancel := context.WithTimeout(ctx, SessionSecretWaitTimeout)
+	defer cancel()
+	ticker := time.NewTicker(sessionSecretPollInterval)
+	defer ticker.Stop()
+
+	req := wrapperspb.String(access.Namespace + "/" + access.Name)
+	for {
+		_, err := s.operations.run(ctx, constants.ActionRefreshSession, []string{accountResource(roleName)}, req, func(ctx context.Context) (interface{}, error) {
+			return nil, s.writeSessionSecret(ctx, access, session)
+		})
+		switch {
+		case err == nil:
+			klog.V(constants.LvlInfo).InfoS("Added session token to credentials secret", "namespace", access.Namespace, "bucketAccess", access.Name,
+				"roleName", roleName, "expiration", session.Expiration)
+			return
+		case errors.Is(err, errSessionSecretReplaced):
+			klog.V(constants.LvlDebug).InfoS("Credentials secret holds other session credentials", "namespace", access.Namespace, "bucketAccess", access.Name)
+			return
+		case status.Code(err) == codes.Aborted, apierrors.IsNotFound(err), errors.Is(err, errNoBucketInfo):
+			// The grant is still in progress, or the sidecar did not create the secret yet
+		default:
+			klog.ErrorS(err, "Failed to add session token to credentials secret", "namespace", access.Namespace, "bucketAccess", access.Name, "roleName", roleName)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			klog.V(constants.LvlInfo).InfoS("Credentials secret not created in time, leaving the session token to the refresh check",
+				"namespace", access.Namespace, "bucketAccess", access.Name, "timeout", SessionSecretWaitTimeout)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// errSessionSecretReplaced is returned when the credentials secret no longer holds the keys of the session.
+var errSessionSecretReplaced = errors.New("credentials secret holds other credentials")
+
+func (s *ProvisionerServer) writeSessionSecret(ctx context.Context, access *bucketv1alpha1.BucketAccess, session *types.Credentials) error {
+	credentials, err := getCredentialsSecret(ctx, s.Clientset, access)
+	if err != nil {
+		return err
+	}
+	// A refresh check or another grant already wrote newer credentials
+	if credentials.get("accessKeyID") != *session.AccessKeyId {
+		return errSessionSecretReplaced
+	}
+	for field, value := range sessionSecrets(session) {
+		credentials.set(field, value)
+	}
+	return credentials.update(ctx, s.Clientset)
+}
+
+// SessionRefresher renews the session credentials of BucketAccesses whose BucketAccessClass sets
+// credentialType to session. Credentials are renewed once less than a third of the session
+// duration remains, or when the credentials secret does not record their expiration.
+type SessionRefresher struct {
+	server *ProvisionerServer
+}
+
+// NewSessionRefresher creates a SessionRefresher for the BucketAccesses provisioned by the server.
+func NewSessionRefresher(server *ProvisionerServer) *SessionRefresher {
+	return &SessionRefresher{server: server}
+}
+
+// Run checks the BucketAccesses every interval until ctx is done.
+func (r *SessionRefresher) Run(ctx context.Context, interval time.Duration) {
+	klog.V(constants.LvlInfo).InfoS("Starting session credentials refresh", "checkInterval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.RefreshAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RefreshAll renews the session credentials that are about to expire.
+// Failures are logged and retried on the next check.
+func (r *SessionRefresher) RefreshAll(ctx context.Context) {
+	policies := map[string]SessionPolicy{}
+	selectClass := func(class *bucketv1alpha1.BucketAccessClass) bool {
+		policy, err := ParseSessionPolicy(class.Parameters)
+		if err != nil {
+			klog.ErrorS(err, "Invalid session credential settings", "bucketAccessClass", class.Name)
+			return false
+		}
+		policies[class.Name] = policy
+		return policy.Enabled
+	}
+	err := r.server.forEachGrantedBucketAccess(ctx, selectClass, func(access *bucketv1alpha1.BucketAccess, class *bucketv1alpha1.BucketAccessClass) {
+		// Refreshes run as operations on the role, so that they do not interleave with a grant or revoke of the same role
+		roleName := accountUserName(access.Status.AccountID)
+		req := wrapperspb.String(access.Namespace + "/" + access.Name)
+		_, err := r.server.operations.run(ctx, constants.ActionRefreshSession, []string{accountResource(roleName)}, req, func(ctx context.Context) (interface{}, error) {
+			return nil, r.refresh(ctx, access, class.Parameters, policies[class.Name])
+		})
+		if status.Code(err) == codes.Aborted {
+			klog.V(constants.LvlInfo).InfoS("Skipped session refresh of a busy role", "namespace", access.Namespace, "bucketAccess", access.Name, "roleName", roleName)
+		} else if err != nil {
+			klog.ErrorS(err, "Failed to refresh session credentials", "namespace", access.Namespace, "bucketAccess", access.Name, "roleName", roleName)
+		}
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to list BucketAccesses for session refresh")
+	}
+}
+
+func (r *SessionRefresher) refresh(ctx context.Context, access *bucketv1alpha1.BucketAccess, parameters map[string]string, policy SessionPolicy) error {
+	roleName := accountUserName(access.Status.AccountID)
+
+	credentials, err := getCredentialsSecret(ctx, r.server.Clientset, access)
+	if err != nil {
+		return err
+	}
+	if expiration, err := time.Parse(time.RFC3339, credentials.get("expiration")); err == nil && time.Until(expiration) > policy.Duration/3 {
+		return nil
+	}
+
+	iamClient, stsClient, err := initializeSessionClients(ctx, r.server, parameters)
+	if err != nil {
+		return err
+	}
+	roleArn, err := iamClient.GetRoleArn(ctx, roleName)
+	if err != nil {
+		return err
+	}
+	session, err := stsClient.AssumeRole(ctx, roleArn, roleName, policy.Duration)
+	if err != nil {
+		return err
+	}
+
+	for field, value := range sessionSecrets(session) {
+		credentials.set(field, value)
+	}
+	if err := credentials.update(ctx, r.server.Clientset); err != nil {
+		return fmt.Errorf("failed to update credentials secret: %w", err)
+	}
+
+	klog.V(constants.LvlInfo).InfoS("Refreshed session credentials", "namespace", access.Namespace, "bucketAccess", access.Name,
+		"roleName", roleName, "expiration", session.Expiration)
+	return nil
+}
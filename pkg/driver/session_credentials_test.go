@@ -0,0 +1,319 @@
+package driver_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	stsclient "github.com/scality/cosi-driver/pkg/clients/sts"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/mock"
+	"github.com/scality/cosi-driver/pkg/util"
+)
+
+// mockSessionClients makes InitializeClient return the mock IAM and STS clients
+func mockSessionClients(mockIAM *mock.MockIAMClient, mockSTS *mock.MockSTSClient) {
+	params := createTestIAMParams()
+	driver.InitializeClient = func(ctx context.Context, clientset kubernetes.Interface, parameters map[string]string, service string) (interface{}, *util.StorageClientParameters, error) {
+		switch service {
+		case "IAM":
+			return &iamclient.IAMClient{IAMService: mockIAM}, &params, nil
+		case "STS":
+			return &stsclient.STSClient{STSService: mockSTS}, &params, nil
+		}
+		return nil, nil, fmt.Errorf("unsupported service: %s", service)
+	}
+}
+
+var _ = Describe("ParseSessionPolicy", func() {
+	It("should use access keys by default", func() {
+		policy, err := driver.ParseSessionPolicy(map[string]string{})
+		Expect(err).To(BeNil())
+		Expect(policy.Enabled).To(BeFalse())
+	})
+
+	It("should parse the session duration", func() {
+		policy, err := driver.ParseSessionPolicy(map[string]string{"credentialType": "session", "sessionDuration": "30m"})
+		Expect(err).To(BeNil())
+		Expect(policy.Enabled).To(BeTrue())
+		Expect(policy.Duration).To(Equal(30 * time.Minute))
+	})
+
+	It("should default the session duration", func() {
+		policy, err := driver.ParseSessionPolicy(map[string]string{"credentialType": "session"})
+		Expect(err).To(BeNil())
+		Expect(policy.Duration).To(Equal(driver.DefaultSessionDuration))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(parameters map[string]string) {
+			_, err := driver.ParseSessionPolicy(parameters)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("unknown credential type", map[string]string{"credentialType": "token"}),
+		Entry("non-duration session duration", map[string]string{"credentialType": "session", "sessionDuration": "1 hour"}),
+		Entry("session duration too short", map[string]string{"credentialType": "session", "sessionDuration": "5m"}),
+		Entry("session duration too long", map[string]string{"credentialType": "session", "sessionDuration": "24h"}),
+		Entry("combined with key rotation", map[string]string{"credentialType": "session", "keyRotationInterval": "720h"}),
+	)
+})
+
+var _ = Describe("Session credentials", func() {
+	const (
+		accessNamespace = "team-b"
+		accessName      = "ba-session"
+		roleName        = "ba-5c1e9a40"
+		secretName      = "session-credentials"
+		className       = "session-class"
+	)
+
+	var (
+		mockIAM         *mock.MockIAMClient
+		mockSTS         *mock.MockSTSClient
+		clientset       *fake.Clientset
+		bucketClientset *bucketclientfake.Clientset
+		assumed         []string
+	)
+
+	secretS3 := func(ctx context.Context) map[string]interface{} {
+		secret, err := clientset.CoreV1().Secrets(accessNamespace).Get(ctx, secretName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		var bucketInfo map[string]interface{}
+		Expect(json.Unmarshal(secret.Data["BucketInfo"], &bucketInfo)).To(Succeed())
+		return bucketInfo["spec"].(map[string]interface{})["secretS3"].(map[string]interface{})
+	}
+
+	createSecret := func(expiration string) {
+		s3 := map[string]interface{}{"endpoint": testEndpoint, "region": testRegion, "accessKeyID": "old-key", "accessSecretKey": "old-secret"}
+		if expiration != "" {
+			s3["expiration"] = expiration
+		}
+		bucketInfo, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"bucketName": testBucketName, "secretS3": s3}})
+		Expect(err).To(BeNil())
+		clientset = fake.NewSimpleClientset(&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: accessNamespace},
+			Data:       map[string][]byte{"BucketInfo": bucketInfo},
+		})
+	}
+
+	BeforeEach(func() {
+		createSecret("")
+		bucketClientset = bucketclientfake.NewSimpleClientset(
+			&bucketv1alpha1.BucketAccessClass{
+				ObjectMeta: metav1.ObjectMeta{Name: className},
+				DriverName: testProvisionerName,
+				Parameters: map[string]string{"credentialType": "session", "sessionDuration": "1h"},
+			},
+			&bucketv1alpha1.BucketAccess{
+				ObjectMeta: metav1.ObjectMeta{Name: accessName, Namespace: accessNamespace, UID: "5c1e9a40"},
+				Spec:       bucketv1alpha1.BucketAccessSpec{BucketAccessClassName: className, CredentialsSecretName: secretName},
+				Status:     bucketv1alpha1.BucketAccessStatus{AccountID: "session-" + roleName, AccessGranted: true},
+			},
+			&bucketv1alpha1.Bucket{
+				ObjectMeta: metav1.ObjectMeta{Name: testBucketName},
+				Spec:       bucketv1alpha1.BucketSpec{Parameters: map[string]string{}},
+			},
+		)
+
+		assumed = nil
+		mockIAM = &mock.MockIAMClient{}
+		mockSTS = &mock.MockSTSClient{}
+		mockSTS.AssumeRoleFunc = func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+			assumed = append(assumed, *input.RoleArn)
+			return (&mock.MockSTSClient{}).AssumeRole(ctx, input, opts...)
+		}
+		mockSessionClients(mockIAM, mockSTS)
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+	})
+
+	It("should return session credentials for a role scoped to the bucket", func(ctx SpecContext) {
+		var createdRole string
+		mockIAM.CreateRoleFunc = func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+			createdRole = *input.RoleName
+			return (&mock.MockIAMClient{}).CreateRole(ctx, input, opts...)
+		}
+		mockIAM.CreateUserFunc = func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+			Fail("no IAM user should be created for session credentials")
+			return nil, nil
+		}
+
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		resp, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       roleName,
+			Parameters: map[string]string{"credentialType": "session", "sessionDuration": "30m"},
+		})
+		Expect(err).To(BeNil())
+		Expect(createdRole).To(Equal(roleName))
+		Expect(resp.AccountId).To(Equal("session-" + roleName))
+		Expect(assumed).To(Equal([]string{"arn:aws:iam::123456789012:role/" + roleName}))
+
+		secrets := resp.Credentials["s3"].Secrets
+		Expect(secrets).To(HaveKeyWithValue("accessKeyID", "mock-session-access-key-id"))
+		Expect(secrets).To(HaveKeyWithValue("endpoint", testEndpoint))
+		// The COSI sidecar would drop them, the SessionRefresher writes them to the credentials secret
+		Expect(secrets).NotTo(HaveKey("sessionToken"))
+		Expect(secrets).NotTo(HaveKey("expiration"))
+	})
+
+	It("should add the session token to the credentials secret once the sidecar creates it", func(ctx SpecContext) {
+		Expect(clientset.CoreV1().Secrets(accessNamespace).Delete(ctx, secretName, metav1.DeleteOptions{})).To(Succeed())
+
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		resp, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       roleName,
+			Parameters: map[string]string{"credentialType": "session"},
+		})
+		Expect(err).To(BeNil())
+
+		// The sidecar writes the returned access keys only
+		secrets := resp.Credentials["s3"].Secrets
+		bucketInfo, err := json.Marshal(map[string]interface{}{"spec": map[string]interface{}{"bucketName": testBucketName, "secretS3": map[string]interface{}{
+			"endpoint": secrets["endpoint"], "region": secrets["region"], "accessKeyID": secrets["accessKeyID"], "accessSecretKey": secrets["accessSecretKey"],
+		}}})
+		Expect(err).To(BeNil())
+		_, err = clientset.CoreV1().Secrets(accessNamespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: accessNamespace},
+			Data:       map[string][]byte{"BucketInfo": bucketInfo},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+
+		Eventually(func() map[string]interface{} { return secretS3(ctx) }).WithTimeout(5 * time.Second).Should(And(
+			HaveKeyWithValue("sessionToken", "mock-session-token"),
+			HaveKey("expiration"),
+			HaveKeyWithValue("accessKeyID", "mock-session-access-key-id"),
+		))
+		// The credentials of the grant are completed, not replaced
+		Expect(assumed).To(HaveLen(1))
+	}, SpecTimeout(10*time.Second))
+
+	It("should skip refreshing credentials of a role with an operation in progress", func(ctx SpecContext) {
+		started, release := make(chan struct{}), make(chan struct{})
+		mockIAM.DeleteRolePolicyFunc = func(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+			close(started)
+			<-release
+			return &iam.DeleteRolePolicyOutput{}, nil
+		}
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		revoked := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: testBucketName, AccountId: "session-" + roleName})
+			revoked <- err
+		}()
+		Eventually(started).Should(BeClosed())
+
+		driver.NewSessionRefresher(provisioner).RefreshAll(ctx)
+
+		Expect(assumed).To(BeEmpty())
+		close(release)
+		Eventually(revoked).Should(Receive(BeNil()))
+	}, SpecTimeout(5*time.Second))
+
+	It("should reject invalid session settings when granting access", func(ctx SpecContext) {
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       roleName,
+			Parameters: map[string]string{"credentialType": "session", "sessionDuration": "48h"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should delete the role when revoking access", func(ctx SpecContext) {
+		var deletedRole string
+		mockIAM.DeleteRoleFunc = func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+			deletedRole = *input.RoleName
+			return &iam.DeleteRoleOutput{}, nil
+		}
+
+		mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+			Fail("no IAM user should be deleted for session credentials")
+			return nil, nil
+		}
+
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		_, err := provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{
+			BucketId:  testBucketName,
+			AccountId: "session-" + roleName,
+		})
+		Expect(err).To(BeNil())
+		Expect(deletedRole).To(Equal(roleName))
+	})
+
+	It("should not touch roles when revoking access keys", func(ctx SpecContext) {
+		failOnRoleCall := func(call string) {
+			Fail(call + " should not be called for access keys")
+		}
+		mockIAM.DeleteRolePolicyFunc = func(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+			failOnRoleCall("DeleteRolePolicy")
+			return nil, nil
+		}
+		mockIAM.DeleteRoleFunc = func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+			failOnRoleCall("DeleteRole")
+			return nil, nil
+		}
+		var deletedUser string
+		mockIAM.DeleteUserFunc = func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+			deletedUser = *input.UserName
+			return &iam.DeleteUserOutput{}, nil
+		}
+
+		provisioner := createTestProvisionerServer(clientset, bucketClientset)
+		_, err := provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{
+			BucketId:  testBucketName,
+			AccountId: roleName,
+		})
+		Expect(err).To(BeNil())
+		Expect(deletedUser).To(Equal(roleName))
+	})
+
+	It("should refresh credentials whose expiration is unknown", func(ctx SpecContext) {
+		driver.NewSessionRefresher(createTestProvisionerServer(clientset, bucketClientset)).RefreshAll(ctx)
+
+		Expect(assumed).To(Equal([]string{"arn:aws:iam::123456789012:role/" + roleName}))
+		s3 := secretS3(ctx)
+		Expect(s3).To(HaveKeyWithValue("accessKeyID", "mock-session-access-key-id"))
+		Expect(s3).To(HaveKeyWithValue("sessionToken", "mock-session-token"))
+		Expect(s3).To(HaveKeyWithValue("endpoint", testEndpoint))
+		Expect(s3).To(HaveKey("expiration"))
+	})
+
+	It("should refresh credentials close to expiration", func(ctx SpecContext) {
+		createSecret(time.Now().Add(10 * time.Minute).UTC().Format(time.RFC3339))
+
+		driver.NewSessionRefresher(createTestProvisionerServer(clientset, bucketClientset)).RefreshAll(ctx)
+
+		Expect(assumed).To(HaveLen(1))
+		Expect(secretS3(ctx)).To(HaveKeyWithValue("accessKeyID", "mock-session-access-key-id"))
+	})
+
+	It("should keep credentials that are far from expiration", func(ctx SpecContext) {
+		createSecret(time.Now().Add(50 * time.Minute).UTC().Format(time.RFC3339))
+
+		driver.NewSessionRefresher(createTestProvisionerServer(clientset, bucketClientset)).RefreshAll(ctx)
+
+		Expect(assumed).To(BeEmpty())
+		Expect(secretS3(ctx)).To(HaveKeyWithValue("accessKeyID", "old-key"))
+	})
+})
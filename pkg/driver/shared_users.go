@@ -0,0 +1,296 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/osperrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+const (
+	UserScopeBucketAccess   = "bucketAccess"
+	UserScopeNamespace      = "namespace"
+	UserScopeServiceAccount = "serviceAccount"
+
+	// bucketAccessAccountPrefix is the prefix of the account names the COSI sidecar derives from BucketAccess UIDs
+	bucketAccessAccountPrefix = "ba-"
+	// sharedUserSecretPrefix is the prefix of the secrets holding the access key of shared IAM users
+	sharedUserSecretPrefix = "iam-user-"
+	// maxIAMUserNameLength is the maximum length of IAM user names
+	maxIAMUserNameLength = 64
+)
+
+// ParseUserScope reads the iamUserScope parameter, which selects whether each BucketAccess gets its own
+// IAM user or shares one with the BucketAccesses of its namespace or service account.
+func ParseUserScope(parameters map[string]string) (string, error) {
+	scope := parameters["iamUserScope"]
+	switch scope {
+	case "":
+		return UserScopeBucketAccess, nil
+	case UserScopeBucketAccess:
+		return scope, nil
+	case UserScopeNamespace, UserScopeServiceAccount:
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "iamUserScope must be one of %q, %q or %q, got %q",
+			UserScopeBucketAccess, UserScopeNamespace, UserScopeServiceAccount, scope)
+	}
+
+	if parameters["credentialType"] == CredentialTypeSession {
+		return "", status.Error(codes.InvalidArgument, "iamUserScope cannot be combined with session credentials")
+	}
+	if parameters["keyRotationInterval"] != "" {
+		return "", status.Error(codes.InvalidArgument, "iamUserScope cannot be combined with keyRotationInterval")
+	}
+	return scope, nil
+}
+
+// sharedUserName returns the name of the IAM user shared by the BucketAccesses of a namespace or
+// service account. It keeps the readable part within IAM limits and ends with a hash to stay unique.
+func sharedUserName(scope string, access *bucketv1alpha1.BucketAccess) string {
+	name := "cosi-" + access.Namespace
+	if scope == UserScopeServiceAccount {
+		name += "-" + access.Spec.ServiceAccountName
+	}
+	hash := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(hash[:])[:8]
+	if len(name) > maxIAMUserNameLength-len(suffix) {
+		name = name[:maxIAMUserNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// grantUserName returns the IAM user a grant acts on: the shared user of the BucketAccess, or the
+// account named after it.
+func grantUserName(req *cosiapi.DriverGrantBucketAccessRequest, access *bucketv1alpha1.BucketAccess) string {
+	scope, err := ParseUserScope(req.GetParameters())
+	if err != nil || scope == UserScopeBucketAccess || access == nil {
+		return req.GetName()
+	}
+	return sharedUserName(scope, access)
+}
+
+// bucketAccessRequired reports whether a grant with these parameters cannot proceed without its
+// BucketAccess: shared users are named after it, and iamUserPath may contain its namespace. Otherwise
+// it only adds tags to the user.
+func bucketAccessRequired(parameters map[string]string) bool {
+	scope, err := ParseUserScope(parameters)
+	if err == nil && scope != UserScopeBucketAccess {
+		return true
+	}
+	return strings.Contains(parameters["iamUserPath"], IAMUserPathNamespace)
+}
+
+// findBucketAccess returns the BucketAccess the COSI sidecar named accountName after. It is looked up
+// in the cache, and only listed from the API server when the cache missed it and it is required.
+func (s *ProvisionerServer) findBucketAccess(ctx context.Context, accountName string, required bool) (*bucketv1alpha1.BucketAccess, error) {
+	if err := s.bucketAccesses.start(ctx, s.BucketClientset); err != nil {
+		return nil, err
+	}
+	access, err := s.bucketAccesses.bucketAccessByAccount(accountName)
+	if err != nil || access != nil || !required {
+		if access == nil && err == nil {
+			err = fmt.Errorf("no BucketAccess found in cache for account %s", accountName)
+		}
+		return access, err
+	}
+
+	// The cache may lag behind a BucketAccess created just before its grant
+	accesses, err := s.BucketClientset.ObjectstorageV1alpha1().BucketAccesses(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range accesses.Items {
+		if bucketAccessAccountPrefix+string(accesses.Items[i].UID) == accountName {
+			return &accesses.Items[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no BucketAccess found for account %s", accountName)
+}
+
+// grantSharedAccess grants the shared IAM user of the BucketAccess access to the bucket, and returns
+// the user name and its access key. The access key is created on the first grant and kept in a secret
+// of the driver namespace, since IAM only returns secret keys when they are created.
+func (s *ProvisionerServer) grantSharedAccess(ctx context.Context, iamClient *iamclient.IAMClient,
+	scope string, access *bucketv1alpha1.BucketAccess, bucketName string, policy iamclient.BucketPolicy, options iamclient.UserOptions) (string, *corev1.Secret, error) {
+	if access == nil {
+		return "", nil, status.Error(codes.Internal, "failed to find BucketAccess")
+	}
+	if scope == UserScopeServiceAccount && access.Spec.ServiceAccountName == "" {
+		return "", nil, status.Error(codes.InvalidArgument, "serviceAccountName must be set on the BucketAccess with iamUserScope serviceAccount")
+	}
+	userName := sharedUserName(scope, access)
+	klog.V(constants.LvlInfo).InfoS("Granting bucket access to shared IAM user", "bucketName", bucketName, "userName", userName,
+		"namespace", access.Namespace, "bucketAccess", access.Name, "scope", scope)
+
+	accountName := bucketAccessAccountPrefix + string(access.UID)
+	if err := iamClient.CreateSharedBucketAccess(ctx, userName, bucketName, accountName, policy, options); err != nil {
+		return "", nil, osperrors.TranslateIAMError(constants.ActionGrantBucketAccess, userName, err)
+	}
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		return "", nil, status.Error(codes.Internal, "POD_NAMESPACE must be set to store the access keys of shared IAM users")
+	}
+	secrets := s.Clientset.CoreV1().Secrets(namespace)
+	secretName := sharedUserSecretPrefix + userName
+
+	secret, err := secrets.Get(ctx, secretName, metav1.GetOptions{})
+	if err == nil {
+		return userName, secret, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		klog.ErrorS(err, "Failed to get shared IAM user secret", "secretName", secretName, "namespace", namespace)
+		return "", nil, status.Error(codes.Internal, "failed to get shared IAM user secret")
+	}
+
+	accessKey, err := iamClient.CreateAccessKey(ctx, userName)
+	if err != nil {
+		return "", nil, osperrors.TranslateIAMError(constants.ActionGrantBucketAccess, userName, err)
+	}
+	secret, err = secrets.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+		Data: map[string][]byte{
+			"accessKeyID":     []byte(*accessKey.AccessKey.AccessKeyId),
+			"accessSecretKey": []byte(*accessKey.AccessKey.SecretAccessKey),
+		},
+	}, metav1.CreateOptions{})
+	if err == nil {
+		klog.V(constants.LvlInfo).InfoS("Stored access key of shared IAM user", "userName", userName, "secretName", secretName, "namespace", namespace)
+		return userName, secret, nil
+	}
+
+	// The key is unknown to workloads: delete it, and use the key stored by a concurrent grant if there is one
+	if deleteErr := iamClient.DeleteAccessKey(ctx, userName, *accessKey.AccessKey.AccessKeyId); deleteErr != nil {
+		klog.ErrorS(deleteErr, "Failed to delete unused access key", "userName", userName, "accessKeyId", *accessKey.AccessKey.AccessKeyId)
+	}
+	if apierrors.IsAlreadyExists(err) {
+		if secret, err = secrets.Get(ctx, secretName, metav1.GetOptions{}); err == nil {
+			return userName, secret, nil
+		}
+	}
+	klog.ErrorS(err, "Failed to store access key of shared IAM user", "secretName", secretName, "namespace", namespace)
+	return "", nil, status.Error(codes.Internal, "failed to store shared IAM user access key")
+}
+
+// revokeSharedAccess removes the access of a shared IAM user to the bucket, keeping what the other
+// BucketAccesses of the user on the bucket still need. The revoked BucketAccess is being deleted, so it
+// is not among them.
+func (s *ProvisionerServer) revokeSharedAccess(ctx context.Context, iamClient *iamclient.IAMClient, userName, bucketName string) (*iamclient.RevokeResult, error) {
+	kept, err := s.sharedGrants(ctx, userName, bucketName)
+	if err != nil {
+		// Revoking without knowing the remaining grants could remove their access
+		return &iamclient.RevokeResult{}, err
+	}
+
+	klog.V(constants.LvlInfo).InfoS("Revoking bucket access of shared IAM user", "bucketName", bucketName, "userName", userName, "keptGrants", len(kept))
+	return iamClient.RevokeSharedBucketAccess(ctx, userName, bucketName, kept)
+}
+
+// sharedGrants returns the grants of the other BucketAccesses of the shared IAM user on the bucket.
+// Candidates come from the cache, and are checked against the API server, since the cache may not
+// have seen the deletion of the revoked BucketAccess yet.
+func (s *ProvisionerServer) sharedGrants(ctx context.Context, userName, bucketName string) ([]iamclient.SharedGrant, error) {
+	if err := s.bucketAccesses.start(ctx, s.BucketClientset); err != nil {
+		return nil, err
+	}
+	classes, err := s.bucketAccesses.bucketAccessClasses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list BucketAccessClasses: %w", err)
+	}
+	scopes := map[string]string{}
+	byName := map[string]*bucketv1alpha1.BucketAccessClass{}
+	for _, class := range classes {
+		if class.DriverName != s.Provisioner {
+			continue
+		}
+		if scope, err := ParseUserScope(class.Parameters); err == nil && scope != UserScopeBucketAccess {
+			scopes[class.Name] = scope
+			byName[class.Name] = class
+		}
+	}
+
+	var kept []iamclient.SharedGrant
+	var errs []error
+	for _, access := range s.bucketAccesses.bucketAccesses() {
+		scope, ok := scopes[access.Spec.BucketAccessClassName]
+		// The cache may not have seen the status written after the grant yet
+		if !ok || access.DeletionTimestamp != nil || (access.Status.AccountID != userName && sharedUserName(scope, access) != userName) {
+			continue
+		}
+		claim, err := s.BucketClientset.ObjectstorageV1alpha1().BucketClaims(access.Namespace).Get(ctx, access.Spec.BucketClaimName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get BucketClaim of BucketAccess %s/%s: %w", access.Namespace, access.Name, err))
+			continue
+		}
+		if claim.Status.BucketName != bucketName {
+			continue
+		}
+		current, err := s.BucketClientset.ObjectstorageV1alpha1().BucketAccesses(access.Namespace).Get(ctx, access.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) || (err == nil && current.DeletionTimestamp != nil) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to get BucketAccess %s/%s: %w", access.Namespace, access.Name, err))
+			continue
+		}
+		class := byName[access.Spec.BucketAccessClassName]
+		policy, err := ParseBucketPolicy(class.Parameters)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid bucket policy of BucketAccessClass %s: %w", class.Name, err))
+			continue
+		}
+		kept = append(kept, iamclient.SharedGrant{AccountName: bucketAccessAccountPrefix + string(access.UID), Policy: policy})
+	}
+	return kept, errors.Join(errs...)
+}
+
+// deleteSharedUserSecret deletes the stored access key of a shared IAM user once the user is gone.
+func (s *ProvisionerServer) deleteSharedUserSecret(ctx context.Context, userName string) error {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		return nil
+	}
+	secretName := sharedUserSecretPrefix + userName
+	err := s.Clientset.CoreV1().Secrets(namespace).Delete(ctx, secretName, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	klog.V(constants.LvlInfo).InfoS("Deleted access key secret of shared IAM user", "userName", userName, "secretName", secretName, "namespace", namespace)
+	return nil
+}
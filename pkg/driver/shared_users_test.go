@@ -0,0 +1,351 @@
+package driver_test
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/iam/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/mock"
+)
+
+var _ = Describe("ParseUserScope", func() {
+	It("should give each BucketAccess its own user by default", func() {
+		scope, err := driver.ParseUserScope(map[string]string{})
+		Expect(err).To(BeNil())
+		Expect(scope).To(Equal(driver.UserScopeBucketAccess))
+	})
+
+	It("should accept shared scopes", func() {
+		scope, err := driver.ParseUserScope(map[string]string{"iamUserScope": "serviceAccount"})
+		Expect(err).To(BeNil())
+		Expect(scope).To(Equal(driver.UserScopeServiceAccount))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(parameters map[string]string) {
+			_, err := driver.ParseUserScope(parameters)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("unknown scope", map[string]string{"iamUserScope": "cluster"}),
+		Entry("combined with session credentials", map[string]string{"iamUserScope": "namespace", "credentialType": "session"}),
+		Entry("combined with key rotation", map[string]string{"iamUserScope": "namespace", "keyRotationInterval": "720h"}),
+	)
+})
+
+var _ = Describe("Shared IAM users", func() {
+	const (
+		driverNamespace = "cosi-driver"
+		appNamespace    = "team-c"
+	)
+
+	var (
+		mockIAM         *mock.MockIAMClient
+		clientset       *fake.Clientset
+		bucketClientset *bucketclientfake.Clientset
+		provisioner     *driver.ProvisionerServer
+		createdKeys     int
+		deletedKeys     []string
+		policies        map[string][]string
+	)
+
+	bucketAccess := func(name, uid, serviceAccount string) *bucketv1alpha1.BucketAccess {
+		return &bucketv1alpha1.BucketAccess{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: appNamespace, UID: k8stypes.UID("00000000-0000-0000-0000-" + uid)},
+			Spec:       bucketv1alpha1.BucketAccessSpec{ServiceAccountName: serviceAccount},
+		}
+	}
+
+	account := func(uid string) string {
+		return "ba-00000000-0000-0000-0000-" + uid
+	}
+
+	grant := func(ctx context.Context, uid, bucketName, scope string) (*cosiapi.DriverGrantBucketAccessResponse, error) {
+		return provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   bucketName,
+			Name:       account(uid),
+			Parameters: map[string]string{"iamUserScope": scope},
+		})
+	}
+
+	BeforeEach(func() {
+		os.Setenv("POD_NAMESPACE", driverNamespace)
+
+		clientset = fake.NewSimpleClientset()
+		bucketClientset = bucketclientfake.NewSimpleClientset(
+			bucketAccess("ba-one", "000000000001", "app"),
+			bucketAccess("ba-two", "000000000002", "app"),
+			bucketAccess("ba-other", "000000000003", "other"),
+			bucketAccess("ba-none", "000000000004", ""),
+			&bucketv1alpha1.Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket-a"}},
+			&bucketv1alpha1.Bucket{ObjectMeta: metav1.ObjectMeta{Name: "bucket-b"}},
+		)
+		provisioner = createTestProvisionerServer(clientset, bucketClientset)
+
+		createdKeys, deletedKeys = 0, nil
+		policies = map[string][]string{}
+		mockIAM = &mock.MockIAMClient{
+			CreateUserFunc: func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				if _, ok := policies[*input.UserName]; ok {
+					return nil, &types.EntityAlreadyExistsException{}
+				}
+				policies[*input.UserName] = nil
+				return &iam.CreateUserOutput{}, nil
+			},
+			PutUserPolicyFunc: func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+				policies[*input.UserName] = append(policies[*input.UserName], *input.PolicyName)
+				return &iam.PutUserPolicyOutput{}, nil
+			},
+			DeleteUserPolicyFunc: func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error) {
+				remaining := []string{}
+				for _, name := range policies[*input.UserName] {
+					if name != *input.PolicyName {
+						remaining = append(remaining, name)
+					}
+				}
+				policies[*input.UserName] = remaining
+				return &iam.DeleteUserPolicyOutput{}, nil
+			},
+			ListUserPoliciesFunc: func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+				return &iam.ListUserPoliciesOutput{PolicyNames: policies[*input.UserName]}, nil
+			},
+			GetUserFunc: func(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error) {
+				if _, ok := policies[*input.UserName]; !ok {
+					return nil, &types.NoSuchEntityException{}
+				}
+				return &iam.GetUserOutput{User: &types.User{UserName: input.UserName}}, nil
+			},
+			DeleteUserFunc: func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error) {
+				delete(policies, *input.UserName)
+				return &iam.DeleteUserOutput{}, nil
+			},
+			CreateAccessKeyFunc: func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
+				createdKeys++
+				return &iam.CreateAccessKeyOutput{AccessKey: &types.AccessKey{AccessKeyId: aws.String("shared-key"), SecretAccessKey: aws.String("shared-secret")}}, nil
+			},
+			DeleteAccessKeyFunc: func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error) {
+				deletedKeys = append(deletedKeys, *input.AccessKeyId)
+				return &iam.DeleteAccessKeyOutput{}, nil
+			},
+		}
+		iamParams := createTestIAMParams()
+		mockInitializeClient("IAM", &iamclient.IAMClient{IAMService: mockIAM}, &iamParams, nil)
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+		os.Unsetenv("POD_NAMESPACE")
+	})
+
+	It("should grant the BucketAccesses of a namespace through one user and key", func(ctx SpecContext) {
+		first, err := grant(ctx, "000000000001", "bucket-a", "namespace")
+		Expect(err).To(BeNil())
+		second, err := grant(ctx, "000000000003", "bucket-b", "namespace")
+		Expect(err).To(BeNil())
+
+		Expect(first.AccountId).To(HavePrefix("cosi-" + appNamespace + "-"))
+		Expect(second.AccountId).To(Equal(first.AccountId))
+		Expect(policies[first.AccountId]).To(Equal([]string{"bucket-a@" + account("000000000001"), "bucket-b@" + account("000000000003")}))
+		Expect(createdKeys).To(Equal(1))
+		Expect(second.Credentials["s3"].Secrets).To(HaveKeyWithValue("accessKeyID", "shared-key"))
+		Expect(second.Credentials["s3"].Secrets).To(HaveKeyWithValue("accessSecretKey", "shared-secret"))
+
+		secret, err := clientset.CoreV1().Secrets(driverNamespace).Get(ctx, "iam-user-"+first.AccountId, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		Expect(string(secret.Data["accessKeyID"])).To(Equal("shared-key"))
+	})
+
+	It("should use one user per service account", func(ctx SpecContext) {
+		app, err := grant(ctx, "000000000001", "bucket-a", "serviceAccount")
+		Expect(err).To(BeNil())
+		sameApp, err := grant(ctx, "000000000002", "bucket-b", "serviceAccount")
+		Expect(err).To(BeNil())
+		other, err := grant(ctx, "000000000003", "bucket-a", "serviceAccount")
+		Expect(err).To(BeNil())
+
+		Expect(sameApp.AccountId).To(Equal(app.AccountId))
+		Expect(other.AccountId).NotTo(Equal(app.AccountId))
+		Expect(createdKeys).To(Equal(2))
+	})
+
+	It("should require a service account with the serviceAccount scope", func(ctx SpecContext) {
+		_, err := grant(ctx, "000000000004", "bucket-a", "serviceAccount")
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should only list BucketAccesses when a shared user misses one in the cache", func(ctx SpecContext) {
+		_, err := grant(ctx, "000000000001", "bucket-a", "namespace")
+		Expect(err).To(BeNil())
+		lists := 0
+		bucketClientset.PrependReactor("list", "bucketaccesses", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			lists++
+			return false, nil, nil
+		})
+
+		_, err = grant(ctx, "000000000009", "bucket-a", "bucketAccess")
+		Expect(err).To(BeNil())
+		Expect(lists).To(BeZero())
+
+		_, err = grant(ctx, "000000000009", "bucket-a", "namespace")
+		Expect(err).NotTo(BeNil())
+		Expect(lists).To(Equal(1))
+	})
+
+	It("should keep user names within IAM limits", func(ctx SpecContext) {
+		access := bucketAccess("ba-long", "000000000005", strings.Repeat("a", 200))
+		_, err := bucketClientset.ObjectstorageV1alpha1().BucketAccesses(appNamespace).Create(ctx, access, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+
+		resp, err := grant(ctx, "000000000005", "bucket-a", "serviceAccount")
+		Expect(err).To(BeNil())
+		Expect(len(resp.AccountId)).To(BeNumerically("<=", 64))
+	})
+
+	It("should delete the new key when a concurrent grant stored one first", func(ctx SpecContext) {
+		resp, err := grant(ctx, "000000000001", "bucket-a", "namespace")
+		Expect(err).To(BeNil())
+		Expect(clientset.CoreV1().Secrets(driverNamespace).Delete(ctx, "iam-user-"+resp.AccountId, metav1.DeleteOptions{})).To(Succeed())
+		_, err = clientset.CoreV1().Secrets(driverNamespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "iam-user-" + resp.AccountId, Namespace: driverNamespace},
+			Data:       map[string][]byte{"accessKeyID": []byte("concurrent-key"), "accessSecretKey": []byte("concurrent-secret")},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		// Make the next lookup miss, as if the concurrent grant had not stored its key yet
+		gets := 0
+		clientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			gets++
+			if gets == 1 {
+				return true, nil, apierrors.NewNotFound(corev1.Resource("secrets"), "iam-user-"+resp.AccountId)
+			}
+			return false, nil, nil
+		})
+
+		resp, err = grant(ctx, "000000000002", "bucket-b", "namespace")
+		Expect(err).To(BeNil())
+		Expect(deletedKeys).To(Equal([]string{"shared-key"}))
+		Expect(resp.Credentials["s3"].Secrets).To(HaveKeyWithValue("accessKeyID", "concurrent-key"))
+	})
+
+	It("should delete the user and its stored key only with its last bucket", func(ctx SpecContext) {
+		resp, err := grant(ctx, "000000000001", "bucket-a", "namespace")
+		Expect(err).To(BeNil())
+		_, err = grant(ctx, "000000000002", "bucket-b", "namespace")
+		Expect(err).To(BeNil())
+		userName := resp.AccountId
+
+		_, err = provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: "bucket-a", AccountId: userName})
+		Expect(err).To(BeNil())
+		Expect(policies).To(HaveKeyWithValue(userName, []string{"bucket-b@" + account("000000000002")}))
+		_, err = clientset.CoreV1().Secrets(driverNamespace).Get(ctx, "iam-user-"+userName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		_, err = provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: "bucket-b", AccountId: userName})
+		Expect(err).To(BeNil())
+		Expect(policies).NotTo(HaveKey(userName))
+		_, err = clientset.CoreV1().Secrets(driverNamespace).Get(ctx, "iam-user-"+userName, metav1.GetOptions{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should serialize the grants and revokes of a shared user", func(ctx SpecContext) {
+		resp, err := grant(ctx, "000000000001", "bucket-a", "namespace")
+		Expect(err).To(BeNil())
+
+		started, release := make(chan struct{}), make(chan struct{})
+		putUserPolicy := mockIAM.PutUserPolicyFunc
+		mockIAM.PutUserPolicyFunc = func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
+			close(started)
+			<-release
+			return putUserPolicy(ctx, input, opts...)
+		}
+		granted := make(chan error, 1)
+		go func() {
+			defer GinkgoRecover()
+			_, err := grant(ctx, "000000000002", "bucket-b", "namespace")
+			granted <- err
+		}()
+		Eventually(started).Should(BeClosed())
+
+		_, err = provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: "bucket-a", AccountId: resp.AccountId})
+		Expect(status.Code(err)).To(Equal(codes.Aborted))
+
+		close(release)
+		Expect(<-granted).To(Succeed())
+	}, SpecTimeout(5*time.Second))
+
+	It("should keep the access of the other BucketAccesses of the bucket", func(ctx SpecContext) {
+		accesses := bucketClientset.ObjectstorageV1alpha1().BucketAccesses(appNamespace)
+		_, err := bucketClientset.ObjectstorageV1alpha1().BucketAccessClasses().Create(ctx, &bucketv1alpha1.BucketAccessClass{
+			ObjectMeta: metav1.ObjectMeta{Name: "shared"},
+			DriverName: testProvisionerName,
+			Parameters: map[string]string{"iamUserScope": "namespace"},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		_, err = bucketClientset.ObjectstorageV1alpha1().BucketClaims(appNamespace).Create(ctx, &bucketv1alpha1.BucketClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "claim-a", Namespace: appNamespace},
+			Status:     bucketv1alpha1.BucketClaimStatus{BucketName: "bucket-a"},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+
+		for _, name := range []string{"ba-one", "ba-two"} {
+			access, err := accesses.Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			access.Spec.BucketAccessClassName = "shared"
+			access.Spec.BucketClaimName = "claim-a"
+			_, err = accesses.Update(ctx, access, metav1.UpdateOptions{})
+			Expect(err).To(BeNil())
+		}
+		var userName string
+		for _, name := range []string{"ba-one", "ba-two"} {
+			access, err := accesses.Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			resp, err := grant(ctx, strings.TrimPrefix(string(access.UID), "00000000-0000-0000-0000-"), "bucket-a", "namespace")
+			Expect(err).To(BeNil())
+			userName = resp.AccountId
+			access.Status = bucketv1alpha1.BucketAccessStatus{AccountID: userName, AccessGranted: true}
+			_, err = accesses.Update(ctx, access, metav1.UpdateOptions{})
+			Expect(err).To(BeNil())
+		}
+		Expect(policies[userName]).To(ConsistOf("bucket-a@"+account("000000000001"), "bucket-a@"+account("000000000002")))
+
+		// The COSI sidecar revokes the access of a BucketAccess once it is being deleted
+		revoke := func(name string) {
+			access, err := accesses.Get(ctx, name, metav1.GetOptions{})
+			Expect(err).To(BeNil())
+			access.DeletionTimestamp = &metav1.Time{}
+			_, err = accesses.Update(ctx, access, metav1.UpdateOptions{})
+			Expect(err).To(BeNil())
+			_, err = provisioner.DriverRevokeBucketAccess(ctx, &cosiapi.DriverRevokeBucketAccessRequest{BucketId: "bucket-a", AccountId: userName})
+			Expect(err).To(BeNil())
+		}
+
+		revoke("ba-one")
+		Expect(policies).To(HaveKeyWithValue(userName, []string{"bucket-a@" + account("000000000002")}))
+		Expect(deletedKeys).To(BeEmpty())
+		_, err = clientset.CoreV1().Secrets(driverNamespace).Get(ctx, "iam-user-"+userName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+
+		revoke("ba-two")
+		Expect(policies).NotTo(HaveKey(userName))
+		Expect(deletedKeys).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+const (
+	// IAMUserPathNamespace is replaced by the namespace of the BucketAccess in iamUserPath
+	IAMUserPathNamespace = "${namespace}"
+
+	TagDriver            = "cosi.scality.com/driver"
+	TagNamespace         = "cosi.scality.com/namespace"
+	TagBucketAccess      = "cosi.scality.com/bucket-access"
+	TagBucketAccessClass = "cosi.scality.com/bucket-access-class"
+	TagServiceAccount    = "cosi.scality.com/service-account"
+
+	maxIAMPathLength = 512
+)
+
+// iamPathPattern matches the IAM paths accepted by IAM: "/" or printable ASCII characters between slashes
+var iamPathPattern = regexp.MustCompile(`^/([\x21-\x7E]*/)?$`)
+
+// ParseUserOptions reads the iamUserPath and permissionsBoundary parameters. The namespace placeholder
+// of the path is left as is, it is resolved for each BucketAccess by resolveUserOptions.
+func ParseUserOptions(parameters map[string]string) (iamclient.UserOptions, error) {
+	options := iamclient.UserOptions{
+		Path:                parameters["iamUserPath"],
+		PermissionsBoundary: parameters["permissionsBoundary"],
+	}
+	if options.Path != "" {
+		if err := validateIAMPath(strings.ReplaceAll(options.Path, IAMUserPathNamespace, "namespace")); err != nil {
+			return options, status.Errorf(codes.InvalidArgument, "invalid iamUserPath: %v", err)
+		}
+	}
+	if options.PermissionsBoundary != "" && !strings.HasPrefix(options.PermissionsBoundary, "arn:") {
+		return options, status.Errorf(codes.InvalidArgument, "permissionsBoundary must be a policy ARN, got %q", options.PermissionsBoundary)
+	}
+	return options, nil
+}
+
+func validateIAMPath(path string) error {
+	if len(path) > maxIAMPathLength {
+		return fmt.Errorf("path is longer than %d characters", maxIAMPathLength)
+	}
+	if !iamPathPattern.MatchString(path) {
+		return fmt.Errorf("path %q must start and end with a slash and contain only printable ASCII characters", path)
+	}
+	return nil
+}
+
+// resolveUserOptions sets the namespace of the BucketAccess in the path and the tags recording the
+// origin of the user. Users shared by several BucketAccesses are tagged with their scope only.
+func (s *ProvisionerServer) resolveUserOptions(options iamclient.UserOptions, scope string, access *bucketv1alpha1.BucketAccess) (iamclient.UserOptions, error) {
+	options.Tags = map[string]string{TagDriver: s.Provisioner}
+	if access == nil {
+		if strings.Contains(options.Path, IAMUserPathNamespace) {
+			return options, status.Error(codes.Internal, "failed to find BucketAccess to resolve iamUserPath")
+		}
+		return options, nil
+	}
+
+	options.Path = strings.ReplaceAll(options.Path, IAMUserPathNamespace, access.Namespace)
+	if options.Path != "" {
+		if err := validateIAMPath(options.Path); err != nil {
+			return options, status.Errorf(codes.InvalidArgument, "invalid iamUserPath: %v", err)
+		}
+	}
+
+	options.Tags[TagNamespace] = access.Namespace
+	switch scope {
+	case UserScopeBucketAccess:
+		options.Tags[TagBucketAccess] = access.Name
+		options.Tags[TagBucketAccessClass] = access.Spec.BucketAccessClassName
+	case UserScopeServiceAccount:
+		options.Tags[TagServiceAccount] = access.Spec.ServiceAccountName
+	}
+	return options, nil
+}
@@ -0,0 +1,145 @@
+package driver_test
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	iamclient "github.com/scality/cosi-driver/pkg/clients/iam"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/mock"
+)
+
+var _ = Describe("ParseUserOptions", func() {
+	It("should keep the namespace placeholder of the path", func() {
+		options, err := driver.ParseUserOptions(map[string]string{
+			"iamUserPath":         "/cosi/prod/${namespace}/",
+			"permissionsBoundary": "arn:aws:iam::123456789012:policy/cosi-boundary",
+		})
+		Expect(err).To(BeNil())
+		Expect(options.Path).To(Equal("/cosi/prod/${namespace}/"))
+		Expect(options.PermissionsBoundary).To(Equal("arn:aws:iam::123456789012:policy/cosi-boundary"))
+	})
+
+	DescribeTable("should reject invalid settings",
+		func(parameters map[string]string) {
+			_, err := driver.ParseUserOptions(parameters)
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		},
+		Entry("path without leading slash", map[string]string{"iamUserPath": "cosi/"}),
+		Entry("path without trailing slash", map[string]string{"iamUserPath": "/cosi"}),
+		Entry("path with spaces", map[string]string{"iamUserPath": "/cosi prod/"}),
+		Entry("boundary that is not an ARN", map[string]string{"permissionsBoundary": "cosi-boundary"}),
+	)
+})
+
+var _ = Describe("IAM user options", func() {
+	const (
+		accountName = "ba-00000000-0000-0000-0000-00000000000a"
+		accessUID   = "00000000-0000-0000-0000-00000000000a"
+	)
+
+	var (
+		mockIAM     *mock.MockIAMClient
+		provisioner *driver.ProvisionerServer
+		created     *iam.CreateUserInput
+	)
+
+	BeforeEach(func() {
+		bucketClientset := bucketclientfake.NewSimpleClientset(&bucketv1alpha1.BucketAccess{
+			ObjectMeta: metav1.ObjectMeta{Name: "ba-data", Namespace: "team-d", UID: accessUID},
+			Spec:       bucketv1alpha1.BucketAccessSpec{BucketAccessClassName: "tagged-class", ServiceAccountName: "app"},
+		})
+		provisioner = createTestProvisionerServer(fake.NewSimpleClientset(), bucketClientset)
+
+		created = nil
+		mockIAM = &mock.MockIAMClient{
+			CreateUserFunc: func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error) {
+				created = input
+				return &iam.CreateUserOutput{}, nil
+			},
+		}
+		iamParams := createTestIAMParams()
+		mockInitializeClient("IAM", &iamclient.IAMClient{IAMService: mockIAM}, &iamParams, nil)
+	})
+
+	AfterEach(func() {
+		restoreInitializeClient()
+	})
+
+	tags := func(input *iam.CreateUserInput) map[string]string {
+		result := map[string]string{}
+		for _, tag := range input.Tags {
+			result[*tag.Key] = *tag.Value
+		}
+		return result
+	}
+
+	It("should create users under the path of their namespace, tagged with their BucketAccess", func(ctx SpecContext) {
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId: testBucketName,
+			Name:     accountName,
+			Parameters: map[string]string{
+				"iamUserPath":         "/cosi/prod/${namespace}/",
+				"permissionsBoundary": "arn:aws:iam::123456789012:policy/cosi-boundary",
+			},
+		})
+		Expect(err).To(BeNil())
+		Expect(*created.Path).To(Equal("/cosi/prod/team-d/"))
+		Expect(*created.PermissionsBoundary).To(Equal("arn:aws:iam::123456789012:policy/cosi-boundary"))
+		Expect(tags(created)).To(Equal(map[string]string{
+			driver.TagDriver:            testProvisionerName,
+			driver.TagNamespace:         "team-d",
+			driver.TagBucketAccess:      "ba-data",
+			driver.TagBucketAccessClass: "tagged-class",
+		}))
+	})
+
+	It("should tag shared users with their scope only", func(ctx SpecContext) {
+		os.Setenv("POD_NAMESPACE", "cosi-driver")
+		defer os.Unsetenv("POD_NAMESPACE")
+
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       accountName,
+			Parameters: map[string]string{"iamUserScope": "serviceAccount"},
+		})
+		Expect(err).To(BeNil())
+		Expect(created.Path).To(BeNil())
+		Expect(tags(created)).To(Equal(map[string]string{
+			driver.TagDriver:         testProvisionerName,
+			driver.TagNamespace:      "team-d",
+			driver.TagServiceAccount: "app",
+		}))
+	})
+
+	It("should fail when the namespace of the path cannot be resolved", func(ctx SpecContext) {
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       "ba-unknown",
+			Parameters: map[string]string{"iamUserPath": "/cosi/${namespace}/"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(created).To(BeNil())
+	})
+
+	It("should create users without a path when the BucketAccess is unknown", func(ctx SpecContext) {
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId: testBucketName,
+			Name:     "ba-unknown",
+		})
+		Expect(err).To(BeNil())
+		Expect(created.Path).To(BeNil())
+		Expect(tags(created)).To(Equal(map[string]string{driver.TagDriver: testProvisionerName}))
+	})
+})
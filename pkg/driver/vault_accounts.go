@@ -0,0 +1,186 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+You may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package driver
+
+import (
+	"context"
+	"os"
+
+	vaultclient "github.com/scality/cosi-driver/pkg/clients/vault"
+	constants "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/osperrors"
+	"github.com/scality/cosi-driver/pkg/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+)
+
+const (
+	VaultAccountScopeShared    = "shared"
+	VaultAccountScopeNamespace = "namespace"
+
+	// vaultAccountPrefix is the prefix of the Vault accounts created for namespaces
+	vaultAccountPrefix = "cosi-"
+	// vaultAccountSecretPrefix is the prefix of the secrets holding the access key of Vault accounts
+	vaultAccountSecretPrefix = "vault-account-"
+	// vaultAccountEmailDomain is the domain of the email addresses Vault requires for accounts
+	vaultAccountEmailDomain = "cosi.scality.local"
+)
+
+// ParseVaultAccountScope reads the vaultAccountScope parameter of a BucketClass, which selects whether its
+// buckets belong to the account of the object storage secret or to a Vault account per namespace.
+func ParseVaultAccountScope(parameters map[string]string) (string, error) {
+	switch scope := parameters["vaultAccountScope"]; scope {
+	case "", VaultAccountScopeShared:
+		return VaultAccountScopeShared, nil
+	case VaultAccountScopeNamespace:
+		return scope, nil
+	default:
+		return "", status.Errorf(codes.InvalidArgument, "vaultAccountScope must be %q or %q, got %q",
+			VaultAccountScopeShared, VaultAccountScopeNamespace, scope)
+	}
+}
+
+// vaultAccountName returns the name of the Vault account of a namespace.
+func vaultAccountName(namespace string) string {
+	return vaultAccountPrefix + namespace
+}
+
+// checkVaultAccountSupport rejects the BucketAccessClass settings that are not supported for buckets of
+// Vault accounts: access keys and session credentials are renewed with the object storage secret.
+func checkVaultAccountSupport(bucket *bucketv1alpha1.Bucket, parameters map[string]string) error {
+	if bucket == nil || bucket.Spec.Parameters["vaultAccountScope"] != VaultAccountScopeNamespace {
+		return nil
+	}
+	if parameters["keyRotationInterval"] != "" {
+		return status.Error(codes.InvalidArgument, "keyRotationInterval is not supported for buckets with vaultAccountScope namespace")
+	}
+	if parameters["credentialType"] == CredentialTypeSession {
+		return status.Error(codes.InvalidArgument, "session credentials are not supported for buckets with vaultAccountScope namespace")
+	}
+	return nil
+}
+
+// initializeBucketClient returns the client of the service managing the bucket. Buckets of a BucketClass
+// with vaultAccountScope namespace are managed with the credentials of the Vault account of their
+// BucketClaim namespace, which is created on first use. Other buckets use the object storage secret of
+// the class parameters, like InitializeClient.
+func (s *ProvisionerServer) initializeBucketClient(ctx context.Context, action string, bucket *bucketv1alpha1.Bucket,
+	parameters map[string]string, service string) (interface{}, *util.StorageClientParameters, error) {
+	scope := VaultAccountScopeShared
+	if bucket != nil {
+		var err error
+		if scope, err = ParseVaultAccountScope(bucket.Spec.Parameters); err != nil {
+			return nil, nil, err
+		}
+	}
+	if scope == VaultAccountScopeShared {
+		return InitializeClient(ctx, s.Clientset, parameters, service)
+	}
+
+	if bucket.Spec.BucketClaim == nil || bucket.Spec.BucketClaim.Namespace == "" {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "bucket %s has no BucketClaim to find its Vault account", bucket.Name)
+	}
+	accountName := vaultAccountName(bucket.Spec.BucketClaim.Namespace)
+
+	// The Vault administration API is configured in the object storage secret of the BucketClass
+	client, params, err := InitializeClient(ctx, s.Clientset, bucket.Spec.Parameters, "Vault")
+	if err != nil {
+		return nil, nil, err
+	}
+	vaultClient, ok := client.(*vaultclient.VaultClient)
+	if !ok {
+		return nil, nil, status.Error(codes.Internal, "unsupported client type for Vault operations")
+	}
+
+	accountParams := *params
+	accountParams.AccessKeyID, accountParams.SecretAccessKey, err = s.vaultAccountKey(ctx, vaultClient, accountName)
+	if err != nil {
+		if _, isStatus := status.FromError(err); isStatus {
+			return nil, nil, err
+		}
+		if translatedErr := osperrors.TranslateIAMError(action, accountName, err); translatedErr != nil {
+			return nil, nil, translatedErr
+		}
+		return nil, nil, status.Error(codes.Internal, "failed to get Vault account access key")
+	}
+	accountParams.RoleARN = ""
+	accountParams.WebIdentityTokenFile = ""
+	if err := accountParams.SetRetryOptions(parameters); err != nil {
+		return nil, nil, err
+	}
+
+	klog.V(constants.LvlDebug).InfoS("Using Vault account of the bucket", "bucketName", bucket.Name, "accountName", accountName, "service", service)
+	client, err = NewStorageClient(ctx, service, accountParams)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, &accountParams, nil
+}
+
+// vaultAccountKey returns the access key of the Vault account, creating the account and the key on first use.
+// The key is kept in a secret of the driver namespace, since Vault only returns secret keys when they are created.
+func (s *ProvisionerServer) vaultAccountKey(ctx context.Context, vaultClient *vaultclient.VaultClient, accountName string) (string, string, error) {
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		return "", "", status.Error(codes.Internal, "POD_NAMESPACE must be set to store the access keys of Vault accounts")
+	}
+	secrets := s.Clientset.CoreV1().Secrets(namespace)
+	secretName := vaultAccountSecretPrefix + accountName
+
+	secret, err := secrets.Get(ctx, secretName, metav1.GetOptions{})
+	if err == nil {
+		return string(secret.Data["accessKeyId"]), string(secret.Data["secretAccessKey"]), nil
+	}
+	if !apierrors.IsNotFound(err) {
+		klog.ErrorS(err, "Failed to get Vault account secret", "secretName", secretName, "namespace", namespace)
+		return "", "", status.Error(codes.Internal, "failed to get Vault account secret")
+	}
+
+	if _, err := vaultClient.EnsureAccount(ctx, accountName, accountName+"@"+vaultAccountEmailDomain); err != nil {
+		return "", "", err
+	}
+	accessKey, err := vaultClient.GenerateAccountAccessKey(ctx, accountName)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err = secrets.Create(ctx, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: namespace},
+		Data: map[string][]byte{
+			"accessKeyId":     []byte(accessKey.AccessKeyID),
+			"secretAccessKey": []byte(accessKey.SecretAccessKey),
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		// The key is unknown to later requests: delete it, and use the key stored by a concurrent request if there is one
+		if deleteErr := vaultClient.DeleteAccessKey(ctx, accessKey.AccessKeyID); deleteErr != nil {
+			klog.ErrorS(deleteErr, "Failed to delete unused Vault account access key", "accountName", accountName, "accessKeyId", accessKey.AccessKeyID)
+		}
+		if apierrors.IsAlreadyExists(err) {
+			secret, err = secrets.Get(ctx, secretName, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to store access key of Vault account", "secretName", secretName, "namespace", namespace)
+		return "", "", status.Error(codes.Internal, "failed to store Vault account access key")
+	}
+	klog.V(constants.LvlInfo).InfoS("Stored access key of Vault account", "accountName", accountName, "secretName", secretName, "namespace", namespace)
+	return string(secret.Data["accessKeyId"]), string(secret.Data["secretAccessKey"]), nil
+}
@@ -0,0 +1,194 @@
+package driver_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	bucketv1alpha1 "sigs.k8s.io/container-object-storage-interface-api/apis/objectstorage/v1alpha1"
+	bucketclientfake "sigs.k8s.io/container-object-storage-interface-api/client/clientset/versioned/fake"
+	cosiapi "sigs.k8s.io/container-object-storage-interface-spec"
+
+	s3client "github.com/scality/cosi-driver/pkg/clients/s3"
+	vaultclient "github.com/scality/cosi-driver/pkg/clients/vault"
+	"github.com/scality/cosi-driver/pkg/driver"
+	"github.com/scality/cosi-driver/pkg/mock"
+	"github.com/scality/cosi-driver/pkg/util"
+)
+
+var _ = Describe("ParseVaultAccountScope", func() {
+	It("should default to the account of the object storage secret", func() {
+		scope, err := driver.ParseVaultAccountScope(map[string]string{})
+		Expect(err).To(BeNil())
+		Expect(scope).To(Equal(driver.VaultAccountScopeShared))
+	})
+
+	It("should reject unknown scopes", func() {
+		_, err := driver.ParseVaultAccountScope(map[string]string{"vaultAccountScope": "bucket"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+})
+
+var _ = Describe("Vault accounts per namespace", func() {
+	const driverNamespace = "cosi-driver"
+
+	var (
+		vaultServer  *httptest.Server
+		vaultActions []string
+		clientset    *fake.Clientset
+		provisioner  *driver.ProvisionerServer
+		clientParams []util.StorageClientParameters
+		mockS3       *mock.MockS3Client
+		parameters   map[string]string
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		os.Setenv("POD_NAMESPACE", driverNamespace)
+		parameters = map[string]string{"objectStorageSecretName": "admin", "vaultAccountScope": "namespace"}
+
+		vaultActions = nil
+		vaultServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			action := r.FormValue("Action")
+			vaultActions = append(vaultActions, action)
+			switch action {
+			case "CreateAccount":
+				fmt.Fprint(w, `{"account":{"data":{"id":"123456789012","name":"cosi-team-a"}}}`)
+			case "GenerateAccountAccessKey":
+				fmt.Fprint(w, `{"id":"ACCOUNTKEY","value":"account-secret"}`)
+			case "DeleteAccessKey":
+				Expect(r.FormValue("AccessKeyId")).To(Equal("ACCOUNTKEY"))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		vaultParams := createTestS3Params()
+		vaultParams.VaultEndpoint = vaultServer.URL
+		vaultParams.VaultAccessKeyID = "vault-admin-key"
+		vaultParams.VaultSecretAccessKey = "vault-admin-secret"
+		vaultClient, err := vaultclient.InitVaultClient(ctx, vaultParams)
+		Expect(err).To(BeNil())
+		mockInitializeClient("Vault", vaultClient, &vaultParams, nil)
+
+		mockS3 = &mock.MockS3Client{}
+		clientParams = nil
+		driver.NewStorageClient = func(ctx context.Context, service string, params util.StorageClientParameters) (interface{}, error) {
+			Expect(service).To(Equal("S3"))
+			clientParams = append(clientParams, params)
+			return &s3client.S3Client{S3Service: mockS3}, nil
+		}
+
+		clientset = fake.NewSimpleClientset()
+		provisioner = createTestProvisionerServer(clientset, bucketclientfake.NewSimpleClientset(&bucketv1alpha1.Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: testBucketName},
+			Spec: bucketv1alpha1.BucketSpec{
+				Parameters:  parameters,
+				BucketClaim: &corev1.ObjectReference{Namespace: "team-a", Name: "data"},
+			},
+		}))
+	})
+
+	AfterEach(func() {
+		os.Unsetenv("POD_NAMESPACE")
+		vaultServer.Close()
+		restoreInitializeClient()
+		driver.NewStorageClient = originalNewStorageClient
+	})
+
+	accountSecret := func(ctx context.Context, clientset kubernetes.Interface) (*corev1.Secret, error) {
+		return clientset.CoreV1().Secrets(driverNamespace).Get(ctx, "vault-account-cosi-team-a", metav1.GetOptions{})
+	}
+
+	It("should create the bucket with the credentials of a new account of the namespace", func(ctx SpecContext) {
+		var created string
+		mockS3.CreateBucketFunc = func(ctx context.Context, input *s3.CreateBucketInput, opts ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+			created = *input.Bucket
+			return &s3.CreateBucketOutput{}, nil
+		}
+
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName, Parameters: parameters})
+		Expect(err).To(BeNil())
+		Expect(created).To(Equal(testBucketName))
+		Expect(vaultActions).To(Equal([]string{"CreateAccount", "GenerateAccountAccessKey"}))
+		Expect(clientParams[0].AccessKeyID).To(Equal("ACCOUNTKEY"))
+		Expect(clientParams[0].SecretAccessKey).To(Equal("account-secret"))
+
+		secret, err := accountSecret(ctx, clientset)
+		Expect(err).To(BeNil())
+		Expect(string(secret.Data["accessKeyId"])).To(Equal("ACCOUNTKEY"))
+	})
+
+	It("should reuse the stored key of the account", func(ctx SpecContext) {
+		_, err := clientset.CoreV1().Secrets(driverNamespace).Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-account-cosi-team-a", Namespace: driverNamespace},
+			Data:       map[string][]byte{"accessKeyId": []byte("STOREDKEY"), "secretAccessKey": []byte("stored-secret")},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+
+		_, err = provisioner.DriverDeleteBucket(ctx, &cosiapi.DriverDeleteBucketRequest{BucketId: testBucketName})
+		Expect(err).To(BeNil())
+		Expect(vaultActions).To(BeEmpty())
+		Expect(clientParams[0].AccessKeyID).To(Equal("STOREDKEY"))
+	})
+
+	It("should delete the new key when it cannot be stored", func(ctx SpecContext) {
+		clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, errors.New("connection refused")
+		})
+
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName, Parameters: parameters})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(vaultActions).To(Equal([]string{"CreateAccount", "GenerateAccountAccessKey", "DeleteAccessKey"}))
+	})
+
+	It("should delete the new key when a concurrent request stored one first", func(ctx SpecContext) {
+		clientset.PrependReactor("create", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			stored := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "vault-account-cosi-team-a", Namespace: driverNamespace},
+				Data:       map[string][]byte{"accessKeyId": []byte("CONCURRENTKEY"), "secretAccessKey": []byte("concurrent-secret")},
+			}
+			Expect(clientset.Tracker().Add(stored)).To(Succeed())
+			return true, nil, apierrors.NewAlreadyExists(corev1.Resource("secrets"), stored.Name)
+		})
+
+		_, err := provisioner.DriverDeleteBucket(ctx, &cosiapi.DriverDeleteBucketRequest{BucketId: testBucketName})
+		Expect(err).To(BeNil())
+		Expect(vaultActions).To(Equal([]string{"CreateAccount", "GenerateAccountAccessKey", "DeleteAccessKey"}))
+		Expect(clientParams[0].AccessKeyID).To(Equal("CONCURRENTKEY"))
+	})
+
+	It("should reject key rotation for buckets of namespace accounts", func(ctx SpecContext) {
+		_, err := provisioner.DriverGrantBucketAccess(ctx, &cosiapi.DriverGrantBucketAccessRequest{
+			BucketId:   testBucketName,
+			Name:       "ba-rotated",
+			Parameters: map[string]string{"keyRotationInterval": "720h"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(vaultActions).To(BeEmpty())
+	})
+
+	It("should fail for buckets without a BucketClaim", func(ctx SpecContext) {
+		provisioner = createTestProvisionerServer(clientset, bucketclientfake.NewSimpleClientset(&bucketv1alpha1.Bucket{
+			ObjectMeta: metav1.ObjectMeta{Name: testBucketName},
+			Spec:       bucketv1alpha1.BucketSpec{Parameters: parameters},
+		}))
+
+		_, err := provisioner.DriverCreateBucket(ctx, &cosiapi.DriverCreateBucketRequest{Name: testBucketName, Parameters: parameters})
+		Expect(status.Code(err)).To(Equal(codes.Internal))
+		Expect(vaultActions).To(BeEmpty())
+	})
+})
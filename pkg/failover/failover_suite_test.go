@@ -0,0 +1,13 @@
+package failover_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestFailoverSuite(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Failover Test Suite")
+}
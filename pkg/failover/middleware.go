@@ -0,0 +1,51 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// AttachFailoverMiddleware routes every attempt to the endpoint picked by the pool and reports
+// its outcome. The SDK resolves the endpoint once per operation, before the retry loop, so the
+// middleware runs between the retry and signing middlewares to move retries to another endpoint.
+func AttachFailoverMiddleware(stack *middleware.Stack, pool *Pool) error {
+	middlewareFunc := middleware.FinalizeMiddlewareFunc("EndpointFailover", func(
+		ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (out middleware.FinalizeOutput, metadata middleware.Metadata, err error) {
+		req, ok := in.Request.(*smithyhttp.Request)
+		if !ok {
+			return next.HandleFinalize(ctx, in)
+		}
+		pool.Route(req.URL, pool.Pick())
+
+		out, metadata, err = next.HandleFinalize(ctx, in)
+		if ctx.Err() != nil {
+			return out, metadata, err
+		}
+		if attemptFailed(err) {
+			pool.ReportFailure(req.URL)
+		} else {
+			pool.ReportSuccess(req.URL)
+		}
+		return out, metadata, err
+	})
+
+	return stack.Finalize.Insert(middlewareFunc, "Signing", middleware.Before)
+}
+
+// attemptFailed reports whether the endpoint failed: no HTTP response at all, or a 5xx response.
+// Successful attempts never carry a 5xx response, since the SDK turns those into errors.
+func attemptFailed(err error) bool {
+	if err == nil {
+		return false
+	}
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode() >= http.StatusInternalServerError
+	}
+	return true
+}
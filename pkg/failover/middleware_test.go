@@ -0,0 +1,97 @@
+package failover_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/scality/cosi-driver/pkg/failover"
+)
+
+// terminalHandler returns the configured error as the outcome of the attempt
+type terminalHandler struct {
+	err error
+}
+
+func (t terminalHandler) HandleFinalize(ctx context.Context, in middleware.FinalizeInput) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	return middleware.FinalizeOutput{}, middleware.Metadata{}, t.err
+}
+
+var _ = Describe("AttachFailoverMiddleware", func() {
+	const endpoint = "https://s3-a.ring.internal"
+
+	var (
+		pool  *failover.Pool
+		stack *middleware.Stack
+	)
+
+	BeforeEach(func() {
+		pool = failover.NewPool("S3", []string{endpoint, "https://s3-b.ring.internal"}, http.DefaultClient)
+		stack = middleware.NewStack("testStack", smithyhttp.NewStackRequest)
+		Expect(stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("Signing", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			return next.HandleFinalize(ctx, in)
+		}), middleware.After)).To(Succeed())
+		Expect(failover.AttachFailoverMiddleware(stack, pool)).To(Succeed())
+	})
+
+	attempt := func(ctx context.Context, err error) *smithyhttp.Request {
+		req := smithyhttp.NewStackRequest().(*smithyhttp.Request)
+		req.URL = mustParse(endpoint + "/bucket")
+		finalize, ok := stack.Finalize.Get("EndpointFailover")
+		Expect(ok).To(BeTrue())
+		_, _, _ = finalize.HandleFinalize(ctx, middleware.FinalizeInput{Request: req}, terminalHandler{err: err})
+		return req
+	}
+
+	It("should be added before signing", func() {
+		Expect(stack.Finalize.List()).To(Equal([]string{"EndpointFailover", "Signing"}))
+	})
+
+	It("should route the attempt to the endpoint picked by the pool", func(ctx SpecContext) {
+		pool.ReportFailure(mustParse(endpoint))
+		req := attempt(ctx, nil)
+		Expect(req.URL.String()).To(Equal("https://s3-b.ring.internal/bucket"))
+		Expect(pool.Healthy("https://s3-b.ring.internal")).To(BeTrue())
+	})
+
+	It("should mark the endpoint unhealthy on connection errors", func(ctx SpecContext) {
+		attempt(ctx, errors.New("dial tcp: connection refused"))
+		Expect(pool.Healthy(endpoint)).To(BeFalse())
+	})
+
+	It("should mark the endpoint unhealthy on 5xx responses", func(ctx SpecContext) {
+		attempt(ctx, &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+			Err:      errors.New("bad gateway"),
+		})
+		Expect(pool.Healthy(endpoint)).To(BeFalse())
+	})
+
+	It("should keep the endpoint healthy on 4xx responses", func(ctx SpecContext) {
+		attempt(ctx, &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusConflict}},
+			Err:      errors.New("bucket not empty"),
+		})
+		Expect(pool.Healthy(endpoint)).To(BeTrue())
+	})
+
+	It("should send the retry of a failed attempt to the next endpoint", func(ctx SpecContext) {
+		attempt(ctx, errors.New("connection reset"))
+		req := attempt(ctx, nil)
+		Expect(req.URL.Host).To(Equal("s3-b.ring.internal"))
+		Expect(pool.Healthy(endpoint)).To(BeFalse())
+	})
+
+	It("should ignore attempts aborted by the caller", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		attempt(ctx, context.Canceled)
+		Expect(pool.Healthy(endpoint)).To(BeTrue())
+	})
+})
@@ -0,0 +1,196 @@
+// Package failover routes S3/IAM calls across several endpoints of the same backend.
+// Endpoints are probed periodically and marked unhealthy on connection errors or 5xx responses,
+// so that SDK retries land on the next healthy endpoint.
+package failover
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+const (
+	DefaultProbeInterval = 30 * time.Second
+	probeTimeout         = 5 * time.Second
+)
+
+// Pool tracks the health of the endpoints of one service and picks the endpoint to use.
+// The preferred endpoint is kept as long as it is healthy, so requests only move on failure.
+type Pool struct {
+	service    string
+	endpoints  []string
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	healthy []bool
+	current int
+}
+
+// NewPool creates a pool where all endpoints are initially considered healthy.
+func NewPool(service string, endpoints []string, httpClient *http.Client) *Pool {
+	pool := &Pool{
+		service:    service,
+		endpoints:  endpoints,
+		httpClient: httpClient,
+		healthy:    make([]bool, len(endpoints)),
+	}
+	for i := range pool.healthy {
+		pool.setHealthyLocked(i, true)
+	}
+	return pool
+}
+
+// Endpoints returns the endpoints of the pool in preference order.
+func (p *Pool) Endpoints() []string {
+	return p.endpoints
+}
+
+// Pick returns the endpoint to use for the next attempt.
+// When no endpoint is healthy it rotates through all of them so that retries still try each one.
+func (p *Pool) Pick() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.healthy[p.current] {
+		return p.endpoints[p.current]
+	}
+	for i := 1; i <= len(p.endpoints); i++ {
+		candidate := (p.current + i) % len(p.endpoints)
+		if p.healthy[candidate] {
+			klog.V(c.LvlInfo).InfoS("Failing over to healthy endpoint", "service", p.service, "from", p.endpoints[p.current], "to", p.endpoints[candidate])
+			p.current = candidate
+			return p.endpoints[candidate]
+		}
+	}
+	p.current = (p.current + 1) % len(p.endpoints)
+	klog.V(c.LvlDebug).InfoS("No healthy endpoint available, trying next endpoint", "service", p.service, "endpoint", p.endpoints[p.current])
+	return p.endpoints[p.current]
+}
+
+// Healthy reports whether the given endpoint is currently considered healthy.
+func (p *Pool) Healthy(endpoint string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, candidate := range p.endpoints {
+		if candidate == endpoint {
+			return p.healthy[i]
+		}
+	}
+	return false
+}
+
+// ReportFailure marks the endpoint serving requestURL as unhealthy.
+func (p *Pool) ReportFailure(requestURL *url.URL) {
+	p.report(requestURL, false)
+}
+
+// ReportSuccess marks the endpoint serving requestURL as healthy.
+func (p *Pool) ReportSuccess(requestURL *url.URL) {
+	p.report(requestURL, true)
+}
+
+// Route points requestURL, resolved against one of the pool endpoints, to endpoint instead.
+// Virtual-hosted bucket subdomains are kept. URLs not served by the pool are left untouched.
+func (p *Pool) Route(requestURL *url.URL, endpoint string) {
+	target, err := url.Parse(endpoint)
+	if err != nil || requestURL == nil {
+		return
+	}
+	for _, candidate := range p.endpoints {
+		if !serves(candidate, requestURL) {
+			continue
+		}
+		current, _ := url.Parse(candidate)
+		requestURL.Scheme = target.Scheme
+		requestURL.Host = strings.TrimSuffix(requestURL.Host, current.Host) + target.Host
+		return
+	}
+}
+
+// Probe checks every endpoint once. Any HTTP response below 500 counts as healthy,
+// since unauthenticated requests are expected to be rejected by S3 and IAM.
+func (p *Pool) Probe(ctx context.Context) {
+	for i, endpoint := range p.endpoints {
+		healthy := p.probeEndpoint(ctx, endpoint)
+		p.mu.Lock()
+		p.setHealthyLocked(i, healthy)
+		p.mu.Unlock()
+	}
+}
+
+// Run probes the endpoints every interval until ctx is done.
+func (p *Pool) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.Probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Pool) probeEndpoint(ctx context.Context, endpoint string) bool {
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		klog.ErrorS(err, "Failed to build endpoint probe", "service", p.service, "endpoint", endpoint)
+		return false
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		klog.V(c.LvlDebug).InfoS("Endpoint probe failed", "service", p.service, "endpoint", endpoint, "error", err)
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+func (p *Pool) report(requestURL *url.URL, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, endpoint := range p.endpoints {
+		if serves(endpoint, requestURL) {
+			p.setHealthyLocked(i, healthy)
+			return
+		}
+	}
+}
+
+func (p *Pool) setHealthyLocked(i int, healthy bool) {
+	if p.healthy[i] != healthy {
+		klog.V(c.LvlInfo).InfoS("Endpoint health changed", "service", p.service, "endpoint", p.endpoints[i], "healthy", healthy)
+	}
+	p.healthy[i] = healthy
+
+	if metrics.EndpointHealthy != nil {
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		metrics.EndpointHealthy.WithLabelValues(p.service, p.endpoints[i]).Set(value)
+	}
+}
+
+// serves reports whether requestURL targets endpoint, including virtual-hosted bucket subdomains.
+func serves(endpoint string, requestURL *url.URL) bool {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil || requestURL == nil || endpointURL.Scheme != requestURL.Scheme {
+		return false
+	}
+	return requestURL.Host == endpointURL.Host || strings.HasSuffix(requestURL.Host, "."+endpointURL.Host)
+}
@@ -0,0 +1,182 @@
+package failover_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scality/cosi-driver/pkg/failover"
+	"github.com/scality/cosi-driver/pkg/metrics"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func mustParse(rawURL string) *url.URL {
+	parsed, err := url.Parse(rawURL)
+	Expect(err).NotTo(HaveOccurred())
+	return parsed
+}
+
+var _ = Describe("Pool", func() {
+	var (
+		pool      *failover.Pool
+		endpoints []string
+	)
+
+	BeforeEach(func() {
+		metrics.InitializeMetrics("test_failover", prometheus.NewRegistry())
+		endpoints = []string{"https://s3-a.ring.internal", "https://s3-b.ring.internal", "https://s3-c.ring.internal"}
+		pool = failover.NewPool("S3", endpoints, http.DefaultClient)
+	})
+
+	It("should prefer the first endpoint while it is healthy", func() {
+		Expect(pool.Pick()).To(Equal(endpoints[0]))
+		Expect(pool.Pick()).To(Equal(endpoints[0]))
+	})
+
+	It("should fail over to the next healthy endpoint", func() {
+		pool.ReportFailure(mustParse(endpoints[0] + "/bucket"))
+		Expect(pool.Healthy(endpoints[0])).To(BeFalse())
+		Expect(pool.Pick()).To(Equal(endpoints[1]))
+	})
+
+	It("should stay on the new endpoint once the previous one recovers", func() {
+		pool.ReportFailure(mustParse(endpoints[0]))
+		Expect(pool.Pick()).To(Equal(endpoints[1]))
+
+		pool.ReportSuccess(mustParse(endpoints[0]))
+		Expect(pool.Pick()).To(Equal(endpoints[1]))
+	})
+
+	It("should match virtual-hosted bucket subdomains", func() {
+		pool.ReportFailure(mustParse("https://bucket.s3-b.ring.internal/key"))
+		Expect(pool.Healthy(endpoints[1])).To(BeFalse())
+		Expect(pool.Healthy(endpoints[0])).To(BeTrue())
+	})
+
+	It("should route request URLs to another endpoint", func() {
+		requestURL := mustParse("https://s3-a.ring.internal/bucket/key?uploads")
+		pool.Route(requestURL, endpoints[2])
+		Expect(requestURL.String()).To(Equal("https://s3-c.ring.internal/bucket/key?uploads"))
+
+		virtualHosted := mustParse("https://bucket.s3-b.ring.internal/key")
+		pool.Route(virtualHosted, "http://s3-a.ring.internal:8000")
+		Expect(virtualHosted.String()).To(Equal("http://bucket.s3-a.ring.internal:8000/key"))
+
+		foreign := mustParse("https://sts.amazonaws.com/")
+		pool.Route(foreign, endpoints[1])
+		Expect(foreign.String()).To(Equal("https://sts.amazonaws.com/"))
+	})
+
+	It("should rotate through endpoints when none is healthy", func() {
+		for _, endpoint := range endpoints {
+			pool.ReportFailure(mustParse(endpoint))
+		}
+		Expect(pool.Pick()).To(Equal(endpoints[1]))
+		Expect(pool.Pick()).To(Equal(endpoints[2]))
+		Expect(pool.Pick()).To(Equal(endpoints[0]))
+	})
+
+	It("should export the health of each endpoint", func() {
+		pool.ReportFailure(mustParse(endpoints[2]))
+		Expect(testutil.ToFloat64(metrics.EndpointHealthy.WithLabelValues("S3", endpoints[2]))).To(Equal(0.0))
+		Expect(testutil.ToFloat64(metrics.EndpointHealthy.WithLabelValues("S3", endpoints[0]))).To(Equal(1.0))
+	})
+
+	Describe("Probe", func() {
+		It("should mark endpoints answering below 500 as healthy and others as unhealthy", func(ctx SpecContext) {
+			forbidden := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer forbidden.Close()
+			unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer unavailable.Close()
+			closed := httptest.NewServer(http.NotFoundHandler())
+			closed.Close()
+
+			pool = failover.NewPool("IAM", []string{unavailable.URL, closed.URL, forbidden.URL}, http.DefaultClient)
+			pool.Probe(ctx)
+
+			Expect(pool.Healthy(unavailable.URL)).To(BeFalse())
+			Expect(pool.Healthy(closed.URL)).To(BeFalse())
+			Expect(pool.Healthy(forbidden.URL)).To(BeTrue())
+			Expect(pool.Pick()).To(Equal(forbidden.URL))
+		})
+	})
+
+	Describe("Registry", func() {
+		It("should share pools for the same service, endpoints and HTTP client settings", func(ctx SpecContext) {
+			registry := failover.NewRegistry(ctx, time.Hour, time.Hour)
+			DeferCleanup(registry.Stop)
+			first := registry.Pool("S3", endpoints, "client", http.DefaultClient)
+			second := registry.Pool("S3", endpoints, "client", http.DefaultClient)
+			other := registry.Pool("IAM", endpoints, "client", http.DefaultClient)
+			otherClient := registry.Pool("S3", endpoints, "proxied-client", http.DefaultClient)
+
+			Expect(second).To(BeIdenticalTo(first))
+			Expect(other).NotTo(BeIdenticalTo(first))
+			Expect(otherClient).NotTo(BeIdenticalTo(first))
+			Expect(registry.List()).To(HaveLen(3))
+		})
+
+		It("should remove the pools that are no longer requested", func(ctx SpecContext) {
+			registry := failover.NewRegistry(ctx, time.Hour, 50*time.Millisecond)
+			DeferCleanup(registry.Stop)
+			registry.Pool("S3", endpoints, "client", http.DefaultClient)
+			Expect(registry.List()).To(HaveLen(1))
+
+			Eventually(registry.List).WithContext(ctx).Should(BeEmpty())
+			Eventually(func() int { return testutil.CollectAndCount(metrics.EndpointHealthy) }).WithContext(ctx).Should(BeZero())
+		})
+
+		It("should stop probing when stopped", func(ctx SpecContext) {
+			var probes atomic.Int32
+			client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				probes.Add(1)
+				return &http.Response{StatusCode: http.StatusForbidden, Body: http.NoBody}, nil
+			})}
+
+			registry := failover.NewRegistry(ctx, 10*time.Millisecond, time.Hour)
+			registry.Pool("S3", endpoints, "client", client)
+			Eventually(probes.Load).WithContext(ctx).Should(BeNumerically(">", len(endpoints)))
+
+			registry.Stop()
+			Expect(registry.List()).To(BeEmpty())
+			stopped := probes.Load()
+			Consistently(probes.Load, 50*time.Millisecond).Should(Equal(stopped))
+
+			registry.Pool("S3", endpoints, "client", client)
+			Expect(registry.List()).To(BeEmpty())
+		})
+
+		It("should report the health of every endpoint for readiness", func(ctx SpecContext) {
+			healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusForbidden)
+			}))
+			defer healthy.Close()
+			unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer unavailable.Close()
+
+			registry := failover.NewRegistry(ctx, time.Hour, time.Hour)
+			DeferCleanup(registry.Stop)
+			registry.Pool("S3", []string{healthy.URL, unavailable.URL}, "client", http.DefaultClient)
+
+			Eventually(registry.ReadinessCheck).WithContext(ctx).Should(ConsistOf(
+				metrics.CheckResult{Name: "endpoint:S3:" + healthy.URL, Status: metrics.StatusOK},
+				metrics.CheckResult{Name: "endpoint:S3:" + unavailable.URL, Status: metrics.StatusFailed, Error: "endpoint is unhealthy"},
+			))
+		})
+	})
+})
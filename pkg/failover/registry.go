@@ -0,0 +1,154 @@
+package failover
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"k8s.io/klog/v2"
+)
+
+// DefaultPoolIdleTimeout is how long a pool is kept without being requested, after which its probes stop.
+const DefaultPoolIdleTimeout = 15 * time.Minute
+
+// Registry shares one Pool per service, endpoint list and HTTP client settings, so that health is
+// tracked across requests even though S3/IAM clients are created for each request. Pools that are
+// no longer requested, for example after the endpoints of a secret changed, are removed.
+type Registry struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	interval    time.Duration
+	idleTimeout time.Duration
+	probes      sync.WaitGroup
+
+	mu    sync.Mutex
+	pools map[string]*registryEntry
+}
+
+type registryEntry struct {
+	pool     *Pool
+	cancel   context.CancelFunc // stops the probes of the pool
+	lastUsed time.Time
+}
+
+// Pools is the registry used by the S3 and IAM clients. It is replaced at startup to tie
+// probing to the lifetime of the driver and to apply the configured probe interval.
+var Pools = NewRegistry(context.Background(), DefaultProbeInterval, DefaultPoolIdleTimeout)
+
+// NewRegistry creates a registry whose pools are probed every interval until ctx is done, Stop
+// is called, or they are not requested for idleTimeout.
+func NewRegistry(ctx context.Context, interval, idleTimeout time.Duration) *Registry {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Registry{
+		ctx:         ctx,
+		cancel:      cancel,
+		interval:    interval,
+		idleTimeout: idleTimeout,
+		pools:       map[string]*registryEntry{},
+	}
+}
+
+// Pool returns the pool of the given endpoints, creating it and starting its probes if needed.
+// The HTTP client is only used for probes and must be built from the settings clientKey identifies,
+// such as the TLS and proxy settings of the service. Pools of a stopped registry are not probed.
+func (r *Registry) Pool(service string, endpoints []string, clientKey string, httpClient *http.Client) *Pool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	key := service + "|" + strings.Join(endpoints, ",") + "|" + clientKey
+	if entry, ok := r.pools[key]; ok {
+		entry.lastUsed = time.Now()
+		return entry.pool
+	}
+
+	pool := NewPool(service, endpoints, httpClient)
+	if r.ctx.Err() != nil {
+		return pool
+	}
+	ctx, cancel := context.WithCancel(r.ctx)
+	r.pools[key] = &registryEntry{pool: pool, cancel: cancel, lastUsed: time.Now()}
+	r.probes.Add(1)
+	go func() {
+		defer r.probes.Done()
+		pool.Run(ctx, r.interval)
+		r.forget(pool)
+	}()
+	klog.V(c.LvlEvent).InfoS("Started endpoint health checks", "service", service, "endpoints", endpoints, "interval", r.interval)
+	return pool
+}
+
+// Stop stops the probes of every pool and waits for them to return.
+func (r *Registry) Stop() {
+	r.mu.Lock()
+	r.cancel()
+	r.pools = map[string]*registryEntry{}
+	r.mu.Unlock()
+	r.probes.Wait()
+}
+
+// List returns all pools known to the registry.
+func (r *Registry) List() []*Pool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+
+	pools := make([]*Pool, 0, len(r.pools))
+	for _, entry := range r.pools {
+		pools = append(pools, entry.pool)
+	}
+	return pools
+}
+
+// pruneLocked stops and removes the pools not requested for idleTimeout.
+func (r *Registry) pruneLocked() {
+	for key, entry := range r.pools {
+		if time.Since(entry.lastUsed) > r.idleTimeout {
+			entry.cancel()
+			delete(r.pools, key)
+			klog.V(c.LvlEvent).InfoS("Stopped health checks of unused endpoints", "service", entry.pool.service, "endpoints", entry.pool.endpoints)
+		}
+	}
+}
+
+// forget deletes the health metrics of the endpoints of a stopped pool that no other pool of the
+// service tracks, once its probes have returned.
+func (r *Registry) forget(pool *Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if metrics.EndpointHealthy == nil {
+		return
+	}
+	for _, endpoint := range pool.endpoints {
+		tracked := false
+		for _, entry := range r.pools {
+			tracked = tracked || entry.pool.service == pool.service && slices.Contains(entry.pool.endpoints, endpoint)
+		}
+		if !tracked {
+			metrics.EndpointHealthy.DeleteLabelValues(pool.service, endpoint)
+		}
+	}
+}
+
+// ReadinessCheck reports the health of every endpoint of the pools, as last seen by probes and requests.
+func (r *Registry) ReadinessCheck(_ context.Context) []metrics.CheckResult {
+	var results []metrics.CheckResult
+	for _, pool := range r.List() {
+		for _, endpoint := range pool.Endpoints() {
+			result := metrics.CheckResult{Name: "endpoint:" + pool.service + ":" + endpoint, Status: metrics.StatusOK}
+			if !pool.Healthy(endpoint) {
+				result.Status = metrics.StatusFailed
+				result.Error = "endpoint is unhealthy"
+			}
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
+}
@@ -47,12 +47,12 @@ var _ = Describe("gRPC Factory Client", func() {
 		cosi.RegisterProvisionerServer(grpcServer, &MockProvisionerServer{})
 
 		// Start the gRPC server in a separate goroutine
-		go func() {
-			err := grpcServer.Serve(listener)
+		go func(server *grpc.Server, listener net.Listener) {
+			err := server.Serve(listener)
 			if err != nil && err != grpc.ErrServerStopped {
 				GinkgoWriter.Println("gRPC server encountered an error:", err)
 			}
-		}()
+		}(grpcServer, listener)
 	})
 
 	AfterEach(func() {
@@ -101,7 +101,7 @@ var _ = Describe("gRPC Factory Client", func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 			defer cancel()
 
-			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, true)
+			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, true, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(client).NotTo(BeNil())
 		})
@@ -110,7 +110,7 @@ var _ = Describe("gRPC Factory Client", func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 			defer cancel()
 
-			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, false)
+			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, false, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(client).NotTo(BeNil())
 		})
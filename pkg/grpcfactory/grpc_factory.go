@@ -19,12 +19,14 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
 	"k8s.io/klog/v2"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
@@ -34,11 +36,55 @@ const (
 	grpcDialTimeout = 30 * time.Second
 )
 
-func NewDefaultCOSIProvisionerClient(ctx context.Context, address string, debug bool) (*COSIProvisionerClient, error) {
+// parseAddress validates a unix://, tcp:// or dns:// address, and returns the network and address to
+// listen on, with the target to dial. dns:// addresses follow the gRPC naming, dns://[authority]/host:port.
+func parseAddress(address string) (network, listenAddress, target string, err error) {
+	addr, err := url.Parse(address)
+	if err != nil {
+		return "", "", "", err
+	}
+	switch addr.Scheme {
+	case "unix":
+		return "unix", addr.Path, address, nil
+	case "tcp":
+		if addr.Host == "" {
+			return "", "", "", fmt.Errorf("missing host:port in address %q", address)
+		}
+		return "tcp", addr.Host, "passthrough:///" + addr.Host, nil
+	case "dns":
+		host := strings.TrimPrefix(addr.Path, "/")
+		if host == "" {
+			return "", "", "", fmt.Errorf("missing host:port in address %q", address)
+		}
+		return "tcp", host, address, nil
+	default:
+		return "", "", "", fmt.Errorf("unsupported scheme: expected 'unix', 'tcp' or 'dns', found '%s'", addr.Scheme)
+	}
+}
+
+// NewDefaultCOSIProvisionerClient creates a client for the address. Connections over TCP use TLS,
+// verifying the server with the CA of tlsConfig, or the system roots when it is nil.
+func NewDefaultCOSIProvisionerClient(ctx context.Context, address string, debug bool, tlsConfig *TLSConfig) (*COSIProvisionerClient, error) {
+	network, _, _, err := parseAddress(address)
+	if err != nil {
+		klog.ErrorS(err, "Invalid address", "address", address)
+		return nil, err
+	}
+	transportCredentials := insecure.NewCredentials() // local Unix domain socket
+	if network == "tcp" {
+		if tlsConfig == nil {
+			tlsConfig = &TLSConfig{}
+		}
+		if transportCredentials, err = tlsConfig.ClientCredentials(); err != nil {
+			klog.ErrorS(err, "Invalid TLS configuration", "address", address)
+			return nil, err
+		}
+	}
+
 	backoffConfiguration := backoff.DefaultConfig
 	backoffConfiguration.MaxDelay = maxGrpcBackoff
 	dialOpts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()), // strictly restricting to local Unix domain socket
+		grpc.WithTransportCredentials(transportCredentials),
 		grpc.WithConnectParams(grpc.ConnectParams{
 			Backoff:           backoffConfiguration,
 			MinConnectTimeout: grpcDialTimeout,
@@ -52,22 +98,18 @@ func NewDefaultCOSIProvisionerClient(ctx context.Context, address string, debug
 	return NewCOSIProvisionerClient(ctx, address, dialOpts, interceptors)
 }
 
-// NewCOSIProvisionerClient creates a new GRPCClient that only supports unix domain sockets
+// NewCOSIProvisionerClient creates a new GRPCClient for unix://, tcp:// or dns:// addresses
 func NewCOSIProvisionerClient(ctx context.Context, address string, dialOpts []grpc.DialOption, interceptors []grpc.UnaryClientInterceptor) (*COSIProvisionerClient, error) {
-	addr, err := url.Parse(address)
+	_, _, target, err := parseAddress(address)
 	if err != nil {
-		return nil, err
-	}
-	if addr.Scheme != "unix" {
-		err := fmt.Errorf("unsupported scheme: expected 'unix', found '%s'", addr.Scheme)
-		klog.ErrorS(err, "Invalid address scheme")
+		klog.ErrorS(err, "Invalid address", "address", address)
 		return nil, err
 	}
 	if len(interceptors) > 0 {
 		dialOpts = append(dialOpts, grpc.WithChainUnaryInterceptor(interceptors...))
 	}
 	// Proceed without grpc.WithBlock(), allowing connection to establish asynchronously
-	conn, err := grpc.Dial(address, dialOpts...)
+	conn, err := grpc.Dial(target, dialOpts...)
 	if err != nil {
 		klog.ErrorS(err, "Connection failed", "address", address)
 		return nil, err
@@ -79,10 +121,19 @@ func NewCOSIProvisionerClient(ctx context.Context, address string, dialOpts []gr
 		ProvisionerClient: cosi.NewProvisionerClient(conn),
 	}, nil
 }
+
+// NewDefaultCOSIProvisionerServer creates a server for the address. tlsConfig is required for tcp://
+// and dns:// addresses, and ignored for Unix domain sockets.
 func NewDefaultCOSIProvisionerServer(address string,
 	identityServer cosi.IdentityServer,
-	provisionerServer cosi.ProvisionerServer) (*COSIProvisionerServer, error) {
-	return NewCOSIProvisionerServer(address, identityServer, provisionerServer, []grpc.ServerOption{})
+	provisionerServer cosi.ProvisionerServer,
+	tlsConfig *TLSConfig) (*COSIProvisionerServer, error) {
+	server, err := NewCOSIProvisionerServer(address, identityServer, provisionerServer, []grpc.ServerOption{})
+	if err != nil {
+		return nil, err
+	}
+	server.tlsConfig = tlsConfig
+	return server, nil
 }
 func NewCOSIProvisionerServer(address string,
 	identityServer cosi.IdentityServer,
@@ -98,10 +149,15 @@ func NewCOSIProvisionerServer(address string,
 		klog.ErrorS(err, "Invalid argument")
 		return nil, err
 	}
-	return &COSIProvisionerServer{
+	server := &COSIProvisionerServer{
 		address:           address,
 		identityServer:    identityServer,
 		provisionerServer: provisionerServer,
 		listenOpts:        listenOpts,
-	}, nil
+		health:            health.NewServer(),
+		drainTimeout:      DefaultDrainTimeout,
+	}
+	// The driver services are not ready until the driver reports it can reach the API server
+	server.SetReady(false)
+	return server, nil
 }
@@ -29,13 +29,13 @@ var _ = Describe("gRPC Factory Provisioner", func() {
 
 	Describe("NewDefaultCOSIProvisionerClient", func() {
 		It("should initialize a client with debug mode enabled", func(ctx SpecContext) {
-			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, true)
+			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, true, nil)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(client).NotTo(BeNil())
 		})
 
 		It("should fail if the address scheme is invalid", func(ctx SpecContext) {
-			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, "http://localhost", false)
+			client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, "http://localhost", false, nil)
 			Expect(err).To(HaveOccurred())
 			Expect(client).To(BeNil())
 			Expect(err.Error()).To(ContainSubstring("unsupported scheme"))
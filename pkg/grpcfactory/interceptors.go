@@ -19,12 +19,65 @@ package grpcfactory
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime/debug"
 	"time"
 
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"github.com/scality/cosi-driver/pkg/metrics"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/klog/v2"
 )
 
+// redactedValue replaces the values of secret-like fields in logs.
+const redactedValue = "[REDACTED]"
+
+// secretFieldPattern matches the names of fields holding credentials, such as the accessSecretKey and
+// sessionToken of the credentials returned by DriverGrantBucketAccess, or secret-like parameters.
+var secretFieldPattern = regexp.MustCompile(`(?i)secret|password|passwd|token|private`)
+
+// Redact returns the JSON representation of a request or response, with the values of secret-like
+// fields and everything below them replaced, so that it can be logged.
+func Redact(message interface{}) string {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Sprintf("<failed to marshal %T: %v>", message, err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Sprintf("<failed to marshal %T: %v>", message, err)
+	}
+	data, err = json.Marshal(redactValue(value, false))
+	if err != nil {
+		return fmt.Sprintf("<failed to marshal %T: %v>", message, err)
+	}
+	return string(data)
+}
+
+func redactValue(value interface{}, secret bool) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			value[key] = redactValue(field, secret || secretFieldPattern.MatchString(key))
+		}
+		return value
+	case []interface{}:
+		for i, item := range value {
+			value[i] = redactValue(item, secret)
+		}
+		return value
+	default:
+		if secret && value != nil {
+			return redactedValue
+		}
+		return value
+	}
+}
+
+// ApiLogger is a client interceptor logging requests and responses, with secret-like fields redacted.
 func ApiLogger(
 	ctx context.Context,
 	method string,
@@ -33,12 +86,7 @@ func ApiLogger(
 	invoker grpc.UnaryInvoker,
 	opts ...grpc.CallOption,
 ) error {
-	// Log the request
-	if jsonReq, err := json.MarshalIndent(req, "", " "); err == nil {
-		klog.InfoS("Request", "api", method, "req", string(jsonReq))
-	} else {
-		klog.ErrorS(err, "Failed to marshal request", "api", method)
-	}
+	klog.InfoS("Request", "api", method, "req", Redact(req))
 
 	start := time.Now()
 	err := invoker(ctx, method, req, reply, cc, opts...)
@@ -47,11 +95,50 @@ func ApiLogger(
 	// Log the response or error
 	if err != nil {
 		klog.ErrorS(err, "API call failed", "method", method, "elapsed", elapsed)
-	} else if jsonResp, err := json.MarshalIndent(reply, "", " "); err == nil {
-		klog.InfoS("Response", "method", method, "elapsed", elapsed, "resp", string(jsonResp))
 	} else {
-		klog.ErrorS(err, "Failed to marshal response", "method", method)
+		klog.InfoS("Response", "method", method, "elapsed", elapsed, "resp", Redact(reply))
 	}
 
 	return err
 }
+
+// LoggingInterceptor is a server interceptor logging the method, duration and code of every request.
+// Requests and responses are logged at debug level, with secret-like fields redacted.
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if klog.V(c.LvlDebug).Enabled() {
+		klog.V(c.LvlDebug).InfoS("gRPC request received", "method", info.FullMethod, "request", Redact(req))
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	duration := time.Since(start)
+	code := status.Code(err)
+
+	switch code {
+	case codes.OK:
+		klog.V(c.LvlInfo).InfoS("gRPC request handled", "method", info.FullMethod, "code", code.String(), "duration", duration)
+		if klog.V(c.LvlDebug).Enabled() {
+			klog.V(c.LvlDebug).InfoS("gRPC response sent", "method", info.FullMethod, "response", Redact(resp))
+		}
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		klog.ErrorS(err, "gRPC request failed", "method", info.FullMethod, "code", code.String(), "duration", duration)
+	default:
+		klog.V(c.LvlInfo).InfoS("gRPC request failed", "method", info.FullMethod, "code", code.String(), "duration", duration, "error", err)
+	}
+	return resp, err
+}
+
+// RecoveryInterceptor is a server interceptor turning a panic of the handler into a codes.Internal
+// error, so that only the affected request fails instead of the whole driver.
+func RecoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			klog.ErrorS(fmt.Errorf("%v", r), "Recovered from panic while handling gRPC request", "method", info.FullMethod, "stack", string(debug.Stack()))
+			if metrics.PanicsTotal != nil {
+				metrics.PanicsTotal.WithLabelValues(metrics.PanicSourceGRPC, info.FullMethod).Inc()
+			}
+			resp, err = nil, status.Errorf(codes.Internal, "internal error while handling %s", info.FullMethod)
+		}
+	}()
+	return handler(ctx, req)
+}
@@ -7,8 +7,14 @@ import (
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/scality/cosi-driver/pkg/grpcfactory"
+	"github.com/scality/cosi-driver/pkg/metrics"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
 var _ = Describe("gRPC Factory Interceptors", func() {
@@ -48,4 +54,96 @@ var _ = Describe("gRPC Factory Interceptors", func() {
 			Expect(err.Error()).To(Equal("invocation failed"))
 		})
 	})
+
+	Context("Redact", func() {
+		It("should redact the credentials of a grant response", func() {
+			resp := &cosi.DriverGrantBucketAccessResponse{
+				AccountId: "test-user",
+				Credentials: map[string]*cosi.CredentialDetails{
+					"s3": {Secrets: map[string]string{
+						"accessKeyID":     "AKIAEXAMPLE",
+						"accessSecretKey": "wJalrXUtnFEMI",
+						"sessionToken":    "FwoGZXIvYXdz",
+					}},
+				},
+			}
+
+			redacted := grpcfactory.Redact(resp)
+			Expect(redacted).To(ContainSubstring("test-user"))
+			Expect(redacted).To(ContainSubstring("[REDACTED]"))
+			Expect(redacted).NotTo(ContainSubstring("AKIAEXAMPLE"))
+			Expect(redacted).NotTo(ContainSubstring("wJalrXUtnFEMI"))
+			Expect(redacted).NotTo(ContainSubstring("FwoGZXIvYXdz"))
+		})
+
+		It("should redact secret-like parameters only", func() {
+			req := &cosi.DriverCreateBucketRequest{
+				Name: "test-bucket",
+				Parameters: map[string]string{
+					"objectStorageSecretName": "s3-secret",
+					"clientPassword":          "hunter2",
+					"region":                  "us-east-1",
+				},
+			}
+
+			redacted := grpcfactory.Redact(req)
+			Expect(redacted).To(ContainSubstring("test-bucket"))
+			Expect(redacted).To(ContainSubstring("us-east-1"))
+			Expect(redacted).NotTo(ContainSubstring("s3-secret"))
+			Expect(redacted).NotTo(ContainSubstring("hunter2"))
+		})
+	})
+
+	Context("LoggingInterceptor", func() {
+		info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverCreateBucket"}
+
+		It("should return the response of the handler", func(ctx SpecContext) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &cosi.DriverCreateBucketResponse{BucketId: "test-bucket"}, nil
+			}
+
+			resp, err := grpcfactory.LoggingInterceptor(ctx, &cosi.DriverCreateBucketRequest{Name: "test-bucket"}, info, handler)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(Equal(&cosi.DriverCreateBucketResponse{BucketId: "test-bucket"}))
+		})
+
+		It("should return the error of the handler", func(ctx SpecContext) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.Internal, "boom")
+			}
+
+			_, err := grpcfactory.LoggingInterceptor(ctx, &cosi.DriverCreateBucketRequest{Name: "test-bucket"}, info, handler)
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+		})
+	})
+
+	Context("RecoveryInterceptor", func() {
+		info := &grpc.UnaryServerInfo{FullMethod: "/cosi.v1alpha1.Provisioner/DriverGrantBucketAccess"}
+
+		BeforeEach(func() {
+			metrics.InitializeMetrics("test_grpc", prometheus.NewRegistry())
+		})
+
+		It("should return codes.Internal and count the panic", func(ctx SpecContext) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				var accessKeyID *string
+				return &cosi.DriverGrantBucketAccessResponse{AccountId: *accessKeyID}, nil
+			}
+
+			resp, err := grpcfactory.RecoveryInterceptor(ctx, &cosi.DriverGrantBucketAccessRequest{}, info, handler)
+			Expect(resp).To(BeNil())
+			Expect(status.Code(err)).To(Equal(codes.Internal))
+			Expect(testutil.ToFloat64(metrics.PanicsTotal.WithLabelValues(metrics.PanicSourceGRPC, info.FullMethod))).To(Equal(1.0))
+		})
+
+		It("should pass through responses and errors of the handler", func(ctx SpecContext) {
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.NotFound, "missing")
+			}
+
+			_, err := grpcfactory.RecoveryInterceptor(ctx, &cosi.DriverGrantBucketAccessRequest{}, info, handler)
+			Expect(status.Code(err)).To(Equal(codes.NotFound))
+			Expect(testutil.ToFloat64(metrics.PanicsTotal.WithLabelValues(metrics.PanicSourceGRPC, info.FullMethod))).To(BeZero())
+		})
+	})
 })
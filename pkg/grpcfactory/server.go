@@ -4,13 +4,16 @@ import (
 	"context"
 	"fmt"
 	"net"
-	"net/url"
+	"sync/atomic"
+	"time"
 
 	grpcprom "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"k8s.io/klog/v2"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
@@ -21,6 +24,47 @@ type COSIProvisionerServer struct {
 	identityServer    cosi.IdentityServer
 	provisionerServer cosi.ProvisionerServer
 	listenOpts        []grpc.ServerOption
+	tlsConfig         *TLSConfig
+	health            *health.Server
+	listening         atomic.Bool
+	drainTimeout      time.Duration
+}
+
+// DefaultDrainTimeout is how long a stopping server waits for the operations in progress.
+const DefaultDrainTimeout = 30 * time.Second
+
+// Drainer is implemented by provisioners tracking their operations in progress. Drain waits for
+// them to complete, and cancels them when ctx is done first, returning the interrupted ones.
+type Drainer interface {
+	Drain(ctx context.Context) []string
+}
+
+// SetDrainTimeout sets how long Run waits for the operations in progress once ctx is cancelled.
+func (s *COSIProvisionerServer) SetDrainTimeout(timeout time.Duration) {
+	s.drainTimeout = timeout
+}
+
+// servedServices are the services whose health reflects the readiness of the driver.
+var servedServices = []string{"cosi.v1alpha1.Identity", "cosi.v1alpha1.Provisioner"}
+
+// SetReady marks the Identity and Provisioner services SERVING or NOT_SERVING in the gRPC health
+// service. The overall health, checked with an empty service name, is SERVING while the server runs.
+func (s *COSIProvisionerServer) SetReady(ready bool) {
+	servingStatus := healthpb.HealthCheckResponse_NOT_SERVING
+	if ready {
+		servingStatus = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, service := range servedServices {
+		s.health.SetServingStatus(service, servingStatus)
+	}
+}
+
+// CheckListening reports whether the server is listening for gRPC requests.
+func (s *COSIProvisionerServer) CheckListening(_ context.Context) error {
+	if !s.listening.Load() {
+		return fmt.Errorf("gRPC server is not listening on %s", s.address)
+	}
+	return nil
 }
 
 // Run starts the gRPC server and handles incoming requests.
@@ -51,20 +95,31 @@ func (s *COSIProvisionerServer) Run(ctx context.Context, registry prometheus.Reg
 	}
 
 	// Parse and validate the server address.
-	addr, err := url.Parse(s.address)
+	network, listenAddress, _, err := parseAddress(s.address)
 	if err != nil {
 		klog.ErrorS(err, "Invalid server address")
 		return err
 	}
-	if addr.Scheme != "unix" {
-		err := fmt.Errorf("unsupported scheme: expected 'unix', found '%s'", addr.Scheme)
-		klog.ErrorS(err, "Invalid address scheme")
-		return err
+
+	// Connections over TCP leave the pod, they carry credentials and must be encrypted.
+	if network == "tcp" {
+		if s.tlsConfig == nil {
+			err := fmt.Errorf("TLS is required to listen on %s", s.address)
+			klog.ErrorS(err, "Invalid server configuration")
+			return err
+		}
+		creds, err := s.tlsConfig.ServerCredentials()
+		if err != nil {
+			klog.ErrorS(err, "Invalid TLS configuration")
+			return err
+		}
+		s.listenOpts = append(s.listenOpts, grpc.Creds(creds))
+		klog.InfoS("TLS enabled for the gRPC server", "certFile", s.tlsConfig.CertFile, "clientCertificates", s.tlsConfig.CAFile != "")
 	}
 
 	// Start the server listener.
 	listenConfig := net.ListenConfig{}
-	listener, err := listenConfig.Listen(ctx, "unix", addr.Path)
+	listener, err := listenConfig.Listen(ctx, network, listenAddress)
 	if err != nil {
 		klog.ErrorS(err, "Failed to start listener")
 		return fmt.Errorf("failed to start listener: %w", err)
@@ -80,10 +135,14 @@ func (s *COSIProvisionerServer) Run(ctx context.Context, registry prometheus.Reg
 	otelHandler := otelgrpc.NewServerHandler()
 
 	// Add gRPC server options including OpenTelemetry and Prometheus interceptors.
-	// Add gRPC server options including OpenTelemetry and Prometheus interceptors.
+	// Panics are recovered last, so that the metrics and logs of the request report codes.Internal.
 	s.listenOpts = append(s.listenOpts,
 		grpc.StatsHandler(otelHandler), // Register the stats handler for OpenTelemetry first.
-		grpc.ChainUnaryInterceptor(srvMetrics.UnaryServerInterceptor(grpcprom.WithExemplarFromContext(exemplarFromContext))),
+		grpc.ChainUnaryInterceptor(
+			srvMetrics.UnaryServerInterceptor(grpcprom.WithExemplarFromContext(exemplarFromContext)),
+			LoggingInterceptor,
+			RecoveryInterceptor,
+		),
 		grpc.ChainStreamInterceptor(srvMetrics.StreamServerInterceptor(grpcprom.WithExemplarFromContext(exemplarFromContext))),
 	)
 
@@ -91,22 +150,52 @@ func (s *COSIProvisionerServer) Run(ctx context.Context, registry prometheus.Reg
 	server := grpc.NewServer(s.listenOpts...)
 	cosi.RegisterIdentityServer(server, s.identityServer)
 	cosi.RegisterProvisionerServer(server, s.provisionerServer)
+	healthpb.RegisterHealthServer(server, s.health)
 
 	// Initialize metrics collection for the server.
 	srvMetrics.InitializeMetrics(server)
 
 	// Run the gRPC server and listen for incoming connections.
 	errChan := make(chan error, 1)
+	s.listening.Store(true)
+	defer s.listening.Store(false)
 	go func() {
 		errChan <- server.Serve(listener)
 	}()
 	select {
 	case <-ctx.Done():
-		klog.Info("Context canceled, stopping gRPC server...")
-		server.GracefulStop()
+		klog.InfoS("Context canceled, stopping gRPC server...", "drainTimeout", s.drainTimeout)
+		s.health.Shutdown()
+		s.stop(server)
 		return ctx.Err()
 	case err := <-errChan:
 		klog.ErrorS(err, "gRPC server exited with error")
 		return err
 	}
 }
+
+// stop stops accepting requests, and waits up to the drain timeout for the requests in progress.
+// Operations still running then are interrupted, and the remaining connections are closed.
+func (s *COSIProvisionerServer) stop(server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	drainCtx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if drainer, ok := s.provisionerServer.(Drainer); ok {
+		if interrupted := drainer.Drain(drainCtx); len(interrupted) > 0 {
+			klog.ErrorS(drainCtx.Err(), "Operations interrupted by shutdown", "operations", interrupted)
+		}
+	}
+
+	select {
+	case <-stopped:
+		klog.Info("gRPC server stopped gracefully")
+	case <-drainCtx.Done():
+		klog.InfoS("Drain timeout reached, closing remaining connections", "drainTimeout", s.drainTimeout)
+		server.Stop()
+	}
+}
@@ -13,6 +13,9 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/scality/cosi-driver/pkg/grpcfactory"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	cosi "sigs.k8s.io/container-object-storage-interface-spec"
 )
 
@@ -24,6 +27,36 @@ type mockProvisionerServer struct {
 	cosi.UnimplementedProvisionerServer
 }
 
+// drainingProvisionerServer blocks DriverCreateBucket until release is closed or the request is
+// canceled, and records drains
+type drainingProvisionerServer struct {
+	cosi.UnimplementedProvisionerServer
+	started chan struct{}
+	release chan struct{}
+	drained chan []string
+}
+
+func (p *drainingProvisionerServer) DriverCreateBucket(ctx context.Context, req *cosi.DriverCreateBucketRequest) (*cosi.DriverCreateBucketResponse, error) {
+	close(p.started)
+	select {
+	case <-p.release:
+		return &cosi.DriverCreateBucketResponse{BucketId: req.Name}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *drainingProvisionerServer) Drain(ctx context.Context) []string {
+	select {
+	case <-p.release:
+		p.drained <- nil
+		return nil
+	case <-ctx.Done():
+		p.drained <- []string{"CreateBucket bucket/test-bucket"}
+		return []string{"CreateBucket bucket/test-bucket"}
+	}
+}
+
 // generateUniqueAddress returns a unique Unix socket address for each test
 func generateUniqueAddress() string {
 	return fmt.Sprintf("unix:///tmp/test-%d.sock", time.Now().UnixNano())
@@ -140,6 +173,46 @@ var _ = Describe("gRPC Factory Server", Ordered, func() {
 			Expect(err.Error()).To(ContainSubstring("failed to register gRPC metrics"))
 		}, SpecTimeout(3*time.Second))
 
+		It("should report the driver services in the health service once ready", func(ctx SpecContext) {
+			server, err := grpcfactory.NewCOSIProvisionerServer(address, identityServer, provisionerServer, nil)
+			Expect(err).NotTo(HaveOccurred())
+			go func() {
+				_ = server.Run(ctx, prometheus.NewRegistry())
+			}()
+			Eventually(func() error { return server.CheckListening(ctx) }).Should(Succeed())
+
+			conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+			healthClient := healthpb.NewHealthClient(conn)
+			check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+				resp, err := healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+				if err != nil {
+					return healthpb.HealthCheckResponse_UNKNOWN
+				}
+				return resp.Status
+			}
+
+			Eventually(check).WithArguments("").Should(Equal(healthpb.HealthCheckResponse_SERVING))
+			Expect(server.CheckListening(ctx)).To(Succeed())
+			Expect(check("cosi.v1alpha1.Provisioner")).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+
+			server.SetReady(true)
+			Expect(check("cosi.v1alpha1.Identity")).To(Equal(healthpb.HealthCheckResponse_SERVING))
+			Expect(check("cosi.v1alpha1.Provisioner")).To(Equal(healthpb.HealthCheckResponse_SERVING))
+
+			server.SetReady(false)
+			Expect(check("cosi.v1alpha1.Provisioner")).To(Equal(healthpb.HealthCheckResponse_NOT_SERVING))
+		}, SpecTimeout(3*time.Second))
+
+		It("should not report listening before running or after failing to listen", func(ctx SpecContext) {
+			server, err := grpcfactory.NewCOSIProvisionerServer("http://invalid-scheme-address", identityServer, provisionerServer, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(server.CheckListening(ctx)).To(MatchError(ContainSubstring("not listening")))
+			Expect(server.Run(ctx, prometheus.NewRegistry())).NotTo(Succeed())
+			Expect(server.CheckListening(ctx)).NotTo(Succeed())
+		}, SpecTimeout(time.Second))
+
 		It("should return an error when the address is invalid", func(ctx SpecContext) {
 			// produce missing protocol scheme error
 			invalidAddress := "::/invalid-address"
@@ -152,5 +225,70 @@ var _ = Describe("gRPC Factory Server", Ordered, func() {
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("missing protocol scheme"))
 		}, SpecTimeout(1*time.Second))
+
+		Context("when the context is canceled", func() {
+			var (
+				provisioner *drainingProvisionerServer
+				runCtx      context.Context
+				stop        context.CancelFunc
+				runErr      chan error
+			)
+
+			startServer := func(ctx context.Context, drainTimeout time.Duration) cosi.ProvisionerClient {
+				provisioner = &drainingProvisionerServer{
+					started: make(chan struct{}),
+					release: make(chan struct{}),
+					drained: make(chan []string, 1),
+				}
+				server, err := grpcfactory.NewCOSIProvisionerServer(address, identityServer, provisioner, nil)
+				Expect(err).NotTo(HaveOccurred())
+				server.SetDrainTimeout(drainTimeout)
+
+				runCtx, stop = context.WithCancel(ctx)
+				runErr = make(chan error, 1)
+				go func() {
+					runErr <- server.Run(runCtx, prometheus.NewRegistry())
+				}()
+				Eventually(func() error { return server.CheckListening(ctx) }).Should(Succeed())
+
+				conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+				Expect(err).NotTo(HaveOccurred())
+				DeferCleanup(conn.Close)
+				return cosi.NewProvisionerClient(conn)
+			}
+
+			It("should wait for the operations in progress", func(ctx SpecContext) {
+				client := startServer(ctx, 5*time.Second)
+				resp := make(chan *cosi.DriverCreateBucketResponse, 1)
+				go func() {
+					defer GinkgoRecover()
+					r, err := client.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "test-bucket"})
+					Expect(err).NotTo(HaveOccurred())
+					resp <- r
+				}()
+				Eventually(provisioner.started).Should(BeClosed())
+
+				stop()
+				Consistently(runErr, 200*time.Millisecond).ShouldNot(Receive())
+				close(provisioner.release)
+
+				Eventually(resp).Should(Receive(HaveField("BucketId", "test-bucket")))
+				Eventually(runErr).Should(Receive(MatchError(context.Canceled)))
+				Expect(<-provisioner.drained).To(BeEmpty())
+			}, SpecTimeout(5*time.Second))
+
+			It("should stop after the drain timeout and report interrupted operations", func(ctx SpecContext) {
+				client := startServer(ctx, 200*time.Millisecond)
+				go func() {
+					_, _ = client.DriverCreateBucket(ctx, &cosi.DriverCreateBucketRequest{Name: "test-bucket"})
+				}()
+				Eventually(provisioner.started).Should(BeClosed())
+				defer close(provisioner.release)
+
+				stop()
+				Eventually(runErr, 2*time.Second).Should(Receive(MatchError(context.Canceled)))
+				Expect(<-provisioner.drained).To(ConsistOf("CreateBucket bucket/test-bucket"))
+			}, SpecTimeout(5*time.Second))
+		})
 	})
 })
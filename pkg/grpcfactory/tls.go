@@ -0,0 +1,200 @@
+/*
+Copyright 2024 Scality, Inc.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package grpcfactory
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"k8s.io/klog/v2"
+)
+
+// TLSConfig holds the files securing gRPC connections over TCP. Files are read again when they
+// change, so certificates renewed on disk are used by new connections without a restart.
+type TLSConfig struct {
+	// CertFile and KeyFile hold the certificate presented to the peer. They are required on the
+	// server, and make the client authenticate with a certificate when set.
+	CertFile string
+	KeyFile  string
+	// CAFile holds the certificate authorities trusted to sign the peer certificate. On the server,
+	// setting it requires clients to present a certificate. Clients use the system roots without it.
+	CAFile string
+}
+
+// ServerCredentials returns the transport credentials of a gRPC server.
+func (c *TLSConfig) ServerCredentials() (credentials.TransportCredentials, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("TLS requires a certificate and a key file")
+	}
+	files := &tlsFiles{config: *c}
+	if err := files.reload(); err != nil {
+		return nil, err
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := files.current()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+			}
+			if pool != nil {
+				config.ClientCAs = pool
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return config, nil
+		},
+	}), nil
+}
+
+// ClientCredentials returns the transport credentials of a gRPC client.
+func (c *TLSConfig) ClientCredentials() (credentials.TransportCredentials, error) {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New("TLS client certificates require both a certificate and a key file")
+	}
+	files := &tlsFiles{config: *c}
+	if err := files.reload(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert, _ := files.current(); cert != nil {
+				return cert, nil
+			}
+			// An empty certificate lets the server decide whether a client certificate is required
+			return &tls.Certificate{}, nil
+		},
+	}
+	if c.CAFile != "" {
+		// The peer is verified against the current CA file, which the standard verification cannot reload
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			_, pool := files.current()
+			return verifyPeer(state, pool)
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+func verifyPeer(state tls.ConnectionState, pool *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server presented no certificate")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+	})
+	return err
+}
+
+// tlsFiles caches the certificate and CA pool read from the files of a TLSConfig, and reads
+// them again when one of the files is modified.
+type tlsFiles struct {
+	config TLSConfig
+
+	mu      sync.Mutex
+	modTime time.Time
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+}
+
+// current returns the certificate and CA pool, reloading them if the files changed. When the new
+// files cannot be loaded, for example while they are being replaced, the previous ones are kept.
+func (f *tlsFiles) current() (*tls.Certificate, *x509.CertPool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	modTime, err := f.latestModTime()
+	if err == nil && !modTime.Equal(f.modTime) {
+		err = f.load(modTime)
+		if err == nil {
+			klog.InfoS("Reloaded TLS certificates", "certFile", f.config.CertFile, "caFile", f.config.CAFile)
+		}
+	}
+	if err != nil {
+		klog.ErrorS(err, "Failed to reload TLS certificates, keeping the previous ones", "certFile", f.config.CertFile, "caFile", f.config.CAFile)
+	}
+	return f.cert, f.pool
+}
+
+// reload loads the files unconditionally, and fails if they are missing or invalid.
+func (f *tlsFiles) reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	modTime, err := f.latestModTime()
+	if err != nil {
+		return err
+	}
+	return f.load(modTime)
+}
+
+func (f *tlsFiles) load(modTime time.Time) error {
+	var cert *tls.Certificate
+	if f.config.CertFile != "" {
+		pair, err := tls.LoadX509KeyPair(f.config.CertFile, f.config.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		cert = &pair
+	}
+
+	var pool *x509.CertPool
+	if f.config.CAFile != "" {
+		pem, err := os.ReadFile(f.config.CAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read TLS CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in TLS CA file %s", f.config.CAFile)
+		}
+	}
+
+	f.cert, f.pool, f.modTime = cert, pool, modTime
+	return nil
+}
+
+func (f *tlsFiles) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{f.config.CertFile, f.config.KeyFile, f.config.CAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,200 @@
+package grpcfactory_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scality/cosi-driver/pkg/grpcfactory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	cosi "sigs.k8s.io/container-object-storage-interface-spec"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns the PEM certificate and key of a leaf certificate valid for localhost
+func (ca *testCA) issue(usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	Expect(err).NotTo(HaveOccurred())
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	Expect(err).NotTo(HaveOccurred())
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(path string, data []byte, modTime time.Time) {
+	Expect(os.WriteFile(path, data, 0o600)).To(Succeed())
+	Expect(os.Chtimes(path, modTime, modTime)).To(Succeed())
+}
+
+func freeTCPAddress() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+var _ = Describe("gRPC Factory TLS", func() {
+	var (
+		dir       string
+		address   string
+		serverCA  *testCA
+		clientCA  *testCA
+		serverTLS *grpcfactory.TLSConfig
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		address = "tcp://" + freeTCPAddress()
+		serverCA = newTestCA("server-ca")
+		clientCA = newTestCA("client-ca")
+
+		cert, key := serverCA.issue(x509.ExtKeyUsageServerAuth)
+		now := time.Now()
+		writeFile(filepath.Join(dir, "server.crt"), cert, now)
+		writeFile(filepath.Join(dir, "server.key"), key, now)
+		writeFile(filepath.Join(dir, "server-ca.crt"), serverCA.pem, now)
+		writeFile(filepath.Join(dir, "client-ca.crt"), clientCA.pem, now)
+		serverTLS = &grpcfactory.TLSConfig{
+			CertFile: filepath.Join(dir, "server.crt"),
+			KeyFile:  filepath.Join(dir, "server.key"),
+		}
+	})
+
+	startServer := func(ctx context.Context) {
+		server, err := grpcfactory.NewDefaultCOSIProvisionerServer(address, &mockIdentityServer{}, &mockProvisionerServer{}, serverTLS)
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			err := server.Run(ctx, prometheus.NewRegistry())
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		}()
+	}
+
+	// getInfo calls the server, which answers Unimplemented once the TLS handshake succeeded
+	getInfo := func(ctx context.Context, clientTLS *grpcfactory.TLSConfig) codes.Code {
+		client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, false, clientTLS)
+		Expect(err).NotTo(HaveOccurred())
+		callCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		_, err = client.DriverGetInfo(callCtx, &cosi.DriverGetInfoRequest{})
+		return status.Code(err)
+	}
+
+	It("should serve clients trusting the server CA", func(ctx SpecContext) {
+		startServer(ctx)
+		clientTLS := &grpcfactory.TLSConfig{CAFile: filepath.Join(dir, "server-ca.crt")}
+		Eventually(func() codes.Code { return getInfo(ctx, clientTLS) }).Should(Equal(codes.Unimplemented))
+	}, SpecTimeout(5*time.Second))
+
+	It("should reject clients without a certificate when client certificates are required", func(ctx SpecContext) {
+		serverTLS.CAFile = filepath.Join(dir, "client-ca.crt")
+		startServer(ctx)
+
+		clientTLS := &grpcfactory.TLSConfig{CAFile: filepath.Join(dir, "server-ca.crt")}
+		Consistently(func() codes.Code { return getInfo(ctx, clientTLS) }, time.Second).Should(Equal(codes.Unavailable))
+
+		cert, key := clientCA.issue(x509.ExtKeyUsageClientAuth)
+		writeFile(filepath.Join(dir, "client.crt"), cert, time.Now())
+		writeFile(filepath.Join(dir, "client.key"), key, time.Now())
+		clientTLS.CertFile = filepath.Join(dir, "client.crt")
+		clientTLS.KeyFile = filepath.Join(dir, "client.key")
+		Eventually(func() codes.Code { return getInfo(ctx, clientTLS) }).Should(Equal(codes.Unimplemented))
+	}, SpecTimeout(5*time.Second))
+
+	It("should use server certificates renewed on disk without a restart", func(ctx SpecContext) {
+		startServer(ctx)
+		renewedCA := newTestCA("renewed-ca")
+		writeFile(filepath.Join(dir, "renewed-ca.crt"), renewedCA.pem, time.Now())
+		clientTLS := &grpcfactory.TLSConfig{CAFile: filepath.Join(dir, "renewed-ca.crt")}
+		Expect(getInfo(ctx, clientTLS)).To(Equal(codes.Unavailable))
+
+		cert, key := renewedCA.issue(x509.ExtKeyUsageServerAuth)
+		later := time.Now().Add(time.Minute)
+		writeFile(filepath.Join(dir, "server.crt"), cert, later)
+		writeFile(filepath.Join(dir, "server.key"), key, later)
+		Eventually(func() codes.Code { return getInfo(ctx, clientTLS) }).Should(Equal(codes.Unimplemented))
+	}, SpecTimeout(5*time.Second))
+
+	It("should keep the previous certificate while the new files are invalid", func(ctx SpecContext) {
+		startServer(ctx)
+		clientTLS := &grpcfactory.TLSConfig{CAFile: filepath.Join(dir, "server-ca.crt")}
+		Eventually(func() codes.Code { return getInfo(ctx, clientTLS) }).Should(Equal(codes.Unimplemented))
+
+		writeFile(filepath.Join(dir, "server.crt"), []byte("not a certificate"), time.Now().Add(time.Minute))
+		Expect(getInfo(ctx, clientTLS)).To(Equal(codes.Unimplemented))
+	}, SpecTimeout(5*time.Second))
+
+	It("should refuse to listen on TCP without TLS", func(ctx SpecContext) {
+		server, err := grpcfactory.NewDefaultCOSIProvisionerServer(address, &mockIdentityServer{}, &mockProvisionerServer{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+		err = server.Run(ctx, prometheus.NewRegistry())
+		Expect(err).To(MatchError(ContainSubstring("TLS is required")))
+	}, SpecTimeout(time.Second))
+
+	It("should fail to start with missing certificate files", func(ctx SpecContext) {
+		serverTLS.CertFile = filepath.Join(dir, "missing.crt")
+		server, err := grpcfactory.NewDefaultCOSIProvisionerServer(address, &mockIdentityServer{}, &mockProvisionerServer{}, serverTLS)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(server.Run(ctx, prometheus.NewRegistry())).NotTo(Succeed())
+	}, SpecTimeout(time.Second))
+
+	It("should accept dns addresses", func(ctx SpecContext) {
+		client, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, "dns:///cosi-driver.cosi.svc:9000", false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client).NotTo(BeNil())
+	})
+
+	It("should reject client certificates without a key", func(ctx SpecContext) {
+		_, err := grpcfactory.NewDefaultCOSIProvisionerClient(ctx, address, false, &grpcfactory.TLSConfig{CertFile: filepath.Join(dir, "server.crt")})
+		Expect(err).To(MatchError(ContainSubstring("require both a certificate and a key file")))
+	})
+})
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"k8s.io/klog/v2"
+)
+
+const (
+	HealthzPath = "/healthz"
+	ReadyzPath  = "/readyz"
+
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+
+	readinessTimeout = 5 * time.Second
+)
+
+// CheckResult is the outcome of one readiness check.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthResponse is the JSON body of the health endpoints.
+type HealthResponse struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks,omitempty"`
+}
+
+// ReadinessCheck runs a group of checks, such as one per object storage endpoint, and returns their results.
+type ReadinessCheck func(ctx context.Context) []CheckResult
+
+// Check returns a ReadinessCheck with a single result named name.
+func Check(name string, check func(ctx context.Context) error) ReadinessCheck {
+	return func(ctx context.Context) []CheckResult {
+		if err := check(ctx); err != nil {
+			return []CheckResult{{Name: name, Status: StatusFailed, Error: err.Error()}}
+		}
+		return []CheckResult{{Name: name, Status: StatusOK}}
+	}
+}
+
+// DeferredChecks is a ReadinessCheck for checks only known once the driver is built, so that the
+// health endpoints can be served during startup. It fails until the checks are set.
+type DeferredChecks struct {
+	mu     sync.RWMutex
+	checks []ReadinessCheck
+	set    bool
+}
+
+// Set sets the checks to run.
+func (d *DeferredChecks) Set(checks ...ReadinessCheck) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.checks = checks
+	d.set = true
+}
+
+// Check runs the checks, or reports the driver as starting when they are not set yet.
+func (d *DeferredChecks) Check(ctx context.Context) []CheckResult {
+	d.mu.RLock()
+	checks, set := d.checks, d.set
+	d.mu.RUnlock()
+
+	if !set {
+		return []CheckResult{{Name: "startup", Status: StatusFailed, Error: "driver is starting"}}
+	}
+	var results []CheckResult
+	for _, check := range checks {
+		results = append(results, check(ctx)...)
+	}
+	return results
+}
+
+// healthzHandler reports the driver alive as long as it serves HTTP requests.
+func healthzHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, HealthResponse{Status: StatusOK})
+}
+
+// readyzHandler runs the readiness checks and reports the driver ready when all of them pass.
+func readyzHandler(checks []ReadinessCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		response := HealthResponse{Status: StatusOK, Checks: []CheckResult{}}
+		for _, check := range checks {
+			for _, result := range check(ctx) {
+				if result.Status != StatusOK {
+					response.Status = StatusFailed
+				}
+				response.Checks = append(response.Checks, result)
+			}
+		}
+		if response.Status != StatusOK {
+			klog.V(c.LvlDebug).InfoS("Readiness checks failed", "checks", response.Checks)
+		}
+		writeHealth(w, response)
+	}
+}
+
+func writeHealth(w http.ResponseWriter, response HealthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != StatusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		klog.ErrorS(err, "Failed to write health response")
+	}
+}
@@ -0,0 +1,95 @@
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scality/cosi-driver/pkg/metrics"
+)
+
+var _ = Describe("Health endpoints", func() {
+	var (
+		server    *http.Server
+		apiServer error
+	)
+
+	BeforeEach(func() {
+		apiServer = nil
+		endpoints := func(ctx context.Context) []metrics.CheckResult {
+			return []metrics.CheckResult{{Name: "endpoint:S3:https://s3.ring.internal", Status: metrics.StatusOK}}
+		}
+		var err error
+		server, err = metrics.StartMetricsServerWithRegistry("127.0.0.1:0", prometheus.NewRegistry(), "/metrics",
+			metrics.Check("apiserver", func(ctx context.Context) error { return apiServer }),
+			endpoints,
+		)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(server.Close()).To(Succeed())
+	})
+
+	get := func(path string) (int, metrics.HealthResponse) {
+		resp, err := http.Get("http://" + server.Addr + path)
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+		var body metrics.HealthResponse
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		return resp.StatusCode, body
+	}
+
+	It("should report the driver alive", func() {
+		code, body := get(metrics.HealthzPath)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body.Status).To(Equal(metrics.StatusOK))
+	})
+
+	It("should report the driver ready with the result of every check", func() {
+		code, body := get(metrics.ReadyzPath)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(Equal(metrics.HealthResponse{Status: metrics.StatusOK, Checks: []metrics.CheckResult{
+			{Name: "apiserver", Status: metrics.StatusOK},
+			{Name: "endpoint:S3:https://s3.ring.internal", Status: metrics.StatusOK},
+		}}))
+	})
+
+	It("should report the driver not ready when a check fails", func() {
+		apiServer = errors.New("connection refused")
+		code, body := get(metrics.ReadyzPath)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body.Status).To(Equal(metrics.StatusFailed))
+		Expect(body.Checks).To(ContainElement(metrics.CheckResult{Name: "apiserver", Status: metrics.StatusFailed, Error: "connection refused"}))
+	})
+
+	It("should keep serving liveness when a readiness check fails", func() {
+		apiServer = errors.New("connection refused")
+		code, _ := get(metrics.HealthzPath)
+		Expect(code).To(Equal(http.StatusOK))
+	})
+
+	It("should report the driver not ready until its deferred checks are set", func() {
+		Expect(server.Close()).To(Succeed())
+		var checks metrics.DeferredChecks
+		var err error
+		server, err = metrics.StartMetricsServerWithRegistry("127.0.0.1:0", prometheus.NewRegistry(), "/metrics", checks.Check)
+		Expect(err).NotTo(HaveOccurred())
+
+		code, body := get(metrics.ReadyzPath)
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body.Checks).To(Equal([]metrics.CheckResult{{Name: "startup", Status: metrics.StatusFailed, Error: "driver is starting"}}))
+		code, _ = get(metrics.HealthzPath)
+		Expect(code).To(Equal(http.StatusOK))
+
+		checks.Set(metrics.Check("apiserver", func(ctx context.Context) error { return nil }))
+		code, body = get(metrics.ReadyzPath)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body.Checks).To(Equal([]metrics.CheckResult{{Name: "apiserver", Status: metrics.StatusOK}}))
+	})
+})
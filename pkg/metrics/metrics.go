@@ -10,10 +10,34 @@ import (
 )
 
 var (
-	S3RequestsTotal    *prometheus.CounterVec
-	S3RequestDuration  *prometheus.HistogramVec
-	IAMRequestsTotal   *prometheus.CounterVec
-	IAMRequestDuration *prometheus.HistogramVec
+	S3RequestsTotal      *prometheus.CounterVec
+	S3RequestDuration    *prometheus.HistogramVec
+	IAMRequestsTotal     *prometheus.CounterVec
+	IAMRequestDuration   *prometheus.HistogramVec
+	STSRequestsTotal     *prometheus.CounterVec
+	STSRequestDuration   *prometheus.HistogramVec
+	VaultRequestsTotal   *prometheus.CounterVec
+	VaultRequestDuration *prometheus.HistogramVec
+	EndpointHealthy      *prometheus.GaugeVec
+	AccessKeyAge         *prometheus.GaugeVec
+	IAMRollbacksTotal    *prometheus.CounterVec
+	PanicsTotal          *prometheus.CounterVec
+
+	LimiterQueueDepth   *prometheus.GaugeVec
+	LimiterWaitDuration *prometheus.HistogramVec
+
+	OperationsTotal       *prometheus.CounterVec
+	OperationDuration     *prometheus.HistogramVec
+	ManagedBuckets        *prometheus.GaugeVec
+	ManagedBucketAccesses *prometheus.GaugeVec
+)
+
+// Sources of the panics counted by PanicsTotal.
+const (
+	// PanicSourceGRPC counts panics of gRPC handlers by full gRPC method name
+	PanicSourceGRPC = "grpc"
+	// PanicSourceOperation counts panics of driver operations by action, such as GrantBucketAccess
+	PanicSourceOperation = "operation"
 )
 
 // InitializeMetrics initializes the metrics with a given prefix and registers them to a registry.
@@ -22,47 +46,178 @@ func InitializeMetrics(prefix string, registry prometheus.Registerer) {
 		prometheus.CounterOpts{
 			Namespace: prefix,
 			Name:      "s3_requests_total",
-			Help:      "Total number of S3 requests, categorized by action and status.",
+			Help:      "Total number of S3 requests, categorized by action, status, error code and HTTP status.",
 		},
-		[]string{"action", "status"},
+		[]string{"action", "status", "error_code", "http_status"},
 	)
 
 	S3RequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: prefix,
 			Name:      "s3_request_duration_seconds",
-			Help:      "Duration of S3 requests in seconds, categorized by action and status.",
+			Help:      "Duration of S3 requests in seconds, categorized by action, status, error code and HTTP status.",
 			Buckets:   prometheus.DefBuckets,
 		},
-		[]string{"action", "status"},
+		[]string{"action", "status", "error_code", "http_status"},
 	)
 
 	IAMRequestsTotal = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Namespace: prefix,
 			Name:      "iam_requests_total",
-			Help:      "Total number of IAM requests, categorized by action and status.",
+			Help:      "Total number of IAM requests, categorized by action, status, error code and HTTP status.",
 		},
-		[]string{"action", "status"},
+		[]string{"action", "status", "error_code", "http_status"},
 	)
 
 	IAMRequestDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: prefix,
 			Name:      "iam_request_duration_seconds",
-			Help:      "Duration of IAM requests in seconds, categorized by action and status.",
+			Help:      "Duration of IAM requests in seconds, categorized by action, status, error code and HTTP status.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"action", "status", "error_code", "http_status"},
+	)
+
+	STSRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "sts_requests_total",
+			Help:      "Total number of STS requests, categorized by action, status, error code and HTTP status.",
+		},
+		[]string{"action", "status", "error_code", "http_status"},
+	)
+
+	STSRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "sts_request_duration_seconds",
+			Help:      "Duration of STS requests in seconds, categorized by action, status, error code and HTTP status.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"action", "status", "error_code", "http_status"},
+	)
+
+	VaultRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "vault_requests_total",
+			Help:      "Total number of Vault administration requests, categorized by action, status, error code and HTTP status.",
+		},
+		[]string{"action", "status", "error_code", "http_status"},
+	)
+
+	VaultRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "vault_request_duration_seconds",
+			Help:      "Duration of Vault administration requests in seconds, categorized by action, status, error code and HTTP status.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"action", "status", "error_code", "http_status"},
+	)
+
+	EndpointHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "endpoint_healthy",
+			Help:      "Health of object storage endpoints configured for failover (1 healthy, 0 unhealthy), categorized by service and endpoint.",
+		},
+		[]string{"service", "endpoint"},
+	)
+
+	AccessKeyAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "access_key_age_seconds",
+			Help:      "Age in seconds of the access key of BucketAccesses with key rotation enabled, categorized by namespace and bucket access.",
+		},
+		[]string{"namespace", "bucket_access"},
+	)
+
+	IAMRollbacksTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "iam_rollbacks_total",
+			Help:      "Total number of IAM steps undone after a partial failure, categorized by step and status.",
+		},
+		[]string{"step", "status"},
+	)
+
+	PanicsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "panics_total",
+			Help:      "Total number of panics recovered, categorized by source (gRPC handler or driver operation) and gRPC method or operation name.",
+		},
+		[]string{"source", "method"},
+	)
+
+	LimiterQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "limiter_queue_depth",
+			Help:      "Number of requests waiting for a concurrency slot or a rate token, categorized by limiter.",
+		},
+		[]string{"limiter"},
+	)
+
+	LimiterWaitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "limiter_wait_duration_seconds",
+			Help:      "Time spent by requests waiting for a concurrency slot or a rate token, categorized by limiter.",
 			Buckets:   prometheus.DefBuckets,
 		},
-		[]string{"action", "status"},
+		[]string{"limiter"},
 	)
 
-	registry.MustRegister(S3RequestsTotal, S3RequestDuration, IAMRequestsTotal, IAMRequestDuration)
+	OperationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: prefix,
+			Name:      "operations_total",
+			Help:      "Total number of driver operations, categorized by operation, object storage secret and gRPC code.",
+		},
+		[]string{"operation", "secret", "code"},
+	)
+
+	OperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: prefix,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of driver operations in seconds, categorized by operation, object storage secret and gRPC code.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"operation", "secret", "code"},
+	)
+
+	ManagedBuckets = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "managed_buckets",
+			Help:      "Number of buckets provisioned by the driver, categorized by bucket class.",
+		},
+		[]string{"bucket_class"},
+	)
+
+	ManagedBucketAccesses = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: prefix,
+			Name:      "managed_bucket_accesses",
+			Help:      "Number of bucket accesses granted by the driver, categorized by bucket access class.",
+		},
+		[]string{"bucket_access_class"},
+	)
+	registry.MustRegister(S3RequestsTotal, S3RequestDuration, IAMRequestsTotal, IAMRequestDuration, STSRequestsTotal, STSRequestDuration, VaultRequestsTotal, VaultRequestDuration, EndpointHealthy, AccessKeyAge, IAMRollbacksTotal, PanicsTotal,
+		LimiterQueueDepth, LimiterWaitDuration, OperationsTotal, OperationDuration, ManagedBuckets, ManagedBucketAccesses)
 
 	klog.InfoS("Custom metrics initialized", "prefix", prefix)
 }
 
 // StartMetricsServerWithRegistry starts an HTTP server for exposing metrics using a custom registry.
-func StartMetricsServerWithRegistry(addr string, registry prometheus.Gatherer, metricsPath string) (*http.Server, error) {
+// It also serves /healthz, and /readyz which runs the given readiness checks.
+func StartMetricsServerWithRegistry(addr string, registry prometheus.Gatherer, metricsPath string, checks ...ReadinessCheck) (*http.Server, error) {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, err
@@ -72,6 +227,8 @@ func StartMetricsServerWithRegistry(addr string, registry prometheus.Gatherer, m
 	mux.Handle(metricsPath, promhttp.HandlerFor(registry, promhttp.HandlerOpts{
 		EnableOpenMetrics: true,
 	}))
+	mux.HandleFunc(HealthzPath, healthzHandler)
+	mux.HandleFunc(ReadyzPath, readyzHandler(checks))
 
 	srv := &http.Server{
 		Handler: mux,
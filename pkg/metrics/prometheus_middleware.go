@@ -2,12 +2,23 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"strconv"
+	"time"
 
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	smithy "github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/scality/cosi-driver/pkg/osperrors"
 	"k8s.io/klog/v2"
 )
 
+// otherLabel replaces the error codes and HTTP statuses unknown to the driver, so that a backend
+// returning unexpected values cannot grow the number of series without bound.
+const otherLabel = "other"
+
 var AttachPrometheusMiddleware = attachPrometheusMiddlewareMetrics
 
 // AttachPrometheusMiddleware attaches a Prometheus middleware for metrics tracking.
@@ -22,9 +33,10 @@ func attachPrometheusMiddlewareMetrics(stack *middleware.Stack, requestDuration
 			if err != nil {
 				status = "error"
 			}
+			errorCode, httpStatus := errorCodeLabel(err), httpStatusLabel(metadata, err)
 
-			requestDuration.WithLabelValues(operationName, status).Observe(duration)
-			requestsTotal.WithLabelValues(operationName, status).Inc()
+			requestDuration.WithLabelValues(operationName, status, errorCode, httpStatus).Observe(duration)
+			requestsTotal.WithLabelValues(operationName, status, errorCode, httpStatus).Inc()
 		}))
 		defer timer.ObserveDuration()
 
@@ -38,3 +50,56 @@ func attachPrometheusMiddlewareMetrics(stack *middleware.Stack, requestDuration
 	// Add the middleware to the Finalize step
 	return stack.Finalize.Add(middlewareFunc, middleware.After)
 }
+
+// ObserveRequest reports a request sent without the AWS SDK, such as to the Vault administration
+// API, with the labels of the AWS SDK middleware. statusCode is 0 when no response was received.
+func ObserveRequest(requestDuration *prometheus.HistogramVec, requestsTotal *prometheus.CounterVec, action string, statusCode int, duration time.Duration, err error) {
+	if requestDuration == nil || requestsTotal == nil {
+		return
+	}
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	errorCode, httpStatus := errorCodeLabel(err), statusCodeLabel(statusCode)
+
+	requestDuration.WithLabelValues(action, status, errorCode, httpStatus).Observe(duration.Seconds())
+	requestsTotal.WithLabelValues(action, status, errorCode, httpStatus).Inc()
+}
+
+// errorCodeLabel returns the API error code of err when osperrors translates it, "other" for other
+// errors, and an empty string on success.
+func errorCodeLabel(err error) string {
+	if err == nil {
+		return ""
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && osperrors.KnownErrorCode(apiErr.ErrorCode()) {
+		return apiErr.ErrorCode()
+	}
+	return otherLabel
+}
+
+// httpStatusLabel returns the HTTP status code of the response, or an empty string when no response
+// was received, for example on a connection error.
+func httpStatusLabel(metadata middleware.Metadata, err error) string {
+	var statusCode int
+	var respErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &respErr) {
+		statusCode = respErr.HTTPStatusCode()
+	} else if resp, ok := awsmiddleware.GetRawResponse(metadata).(*smithyhttp.Response); ok && resp != nil {
+		statusCode = resp.StatusCode
+	}
+	return statusCodeLabel(statusCode)
+}
+
+func statusCodeLabel(statusCode int) string {
+	switch {
+	case statusCode == 0:
+		return ""
+	case statusCode < 100 || statusCode > 599:
+		return otherLabel
+	default:
+		return strconv.Itoa(statusCode)
+	}
+}
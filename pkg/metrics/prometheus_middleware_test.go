@@ -3,8 +3,12 @@ package metrics_test
 import (
 	"context"
 	"errors"
+	"net/http"
 
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	smithy "github.com/aws/smithy-go"
 	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/prometheus/client_golang/prometheus"
@@ -53,12 +57,12 @@ var _ = Describe("AttachPrometheusMiddleware", func() {
 		requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 			Name: "request_duration_seconds",
 			Help: "Duration of requests",
-		}, []string{"operation", "status"})
+		}, []string{"operation", "status", "error_code", "http_status"})
 
 		requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
 			Name: "requests_total",
 			Help: "Total number of requests",
-		}, []string{"operation", "status"})
+		}, []string{"operation", "status", "error_code", "http_status"})
 
 		stack = middleware.NewStack("testStack", nil)
 
@@ -146,7 +150,40 @@ var _ = Describe("AttachPrometheusMiddleware", func() {
 
 		metrics := testutil.CollectAndCount(requestDuration)
 		Expect(metrics).To(BeNumerically(">", 0)) // Ensure metrics are collected
-		Expect(requestDuration.WithLabelValues("TestOperation", "error")).NotTo(BeNil())
-		Expect(requestsTotal.WithLabelValues("TestOperation", "error")).NotTo(BeNil())
+		Expect(requestsTotal.WithLabelValues("", "error", "other", "")).NotTo(BeNil())
+		Expect(testutil.ToFloat64(requestsTotal.WithLabelValues("", "error", "other", ""))).To(Equal(1.0))
 	})
+
+	DescribeTable("should label requests with the error code and HTTP status",
+		func(ctx SpecContext, statusCode int, err error, status, errorCode, httpStatus string) {
+			stack = middleware.NewStack("testStack", smithyhttp.NewStackRequest)
+			Expect(awsmiddleware.AddRawResponseToMetadata(stack)).To(Succeed())
+			Expect(metrics.AttachPrometheusMiddleware(stack, requestDuration, requestsTotal)).To(Succeed())
+
+			handler := middleware.DecorateHandler(middleware.HandlerFunc(func(ctx context.Context, input interface{}) (interface{}, middleware.Metadata, error) {
+				if err != nil {
+					return nil, middleware.Metadata{}, err
+				}
+				return &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}}, middleware.Metadata{}, nil
+			}), stack)
+			_, _, _ = handler.Handle(middleware.WithOperationName(ctx, "DeleteBucket"), nil)
+
+			Expect(testutil.ToFloat64(requestsTotal.WithLabelValues("DeleteBucket", status, errorCode, httpStatus))).To(Equal(1.0))
+			Expect(testutil.CollectAndCount(requestDuration)).To(Equal(1))
+		},
+		Entry("successful request", http.StatusNoContent, nil, "success", "", "204"),
+		Entry("known error code", 0, responseError(http.StatusConflict, "BucketNotEmpty"), "error", "BucketNotEmpty", "409"),
+		Entry("throttled request", 0, responseError(http.StatusServiceUnavailable, "Throttled"), "error", "Throttled", "503"),
+		Entry("unknown error code", 0, responseError(http.StatusBadRequest, "SomethingUnexpected"), "error", "other", "400"),
+		Entry("non-standard HTTP status", 0, responseError(999, "AccessDenied"), "error", "AccessDenied", "other"),
+		Entry("connection error without response", 0, errors.New("connection refused"), "error", "other", ""),
+	)
 })
+
+// responseError builds the error of a request answered with statusCode and the API error code.
+func responseError(statusCode int, code string) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+		Err:      &smithy.GenericAPIError{Code: code},
+	}
+}
@@ -11,14 +11,36 @@ import (
 // MockIAMClient simulates the behavior of an IAM client for testing purposes.
 // It embeds iamclient.IAMClient to ensure compatibility with the interface or struct.
 type MockIAMClient struct {
-	CreateUserFunc       func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error)
-	PutUserPolicyFunc    func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error)
-	CreateAccessKeyFunc  func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error)
-	GetUserFunc          func(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error)
-	DeleteUserPolicyFunc func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error)
-	ListAccessKeysFunc   func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error)
-	DeleteAccessKeyFunc  func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error)
-	DeleteUserFunc       func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error)
+	CreateUserFunc                 func(ctx context.Context, input *iam.CreateUserInput, opts ...func(*iam.Options)) (*iam.CreateUserOutput, error)
+	PutUserPermissionsBoundaryFunc func(ctx context.Context, input *iam.PutUserPermissionsBoundaryInput, opts ...func(*iam.Options)) (*iam.PutUserPermissionsBoundaryOutput, error)
+	PutUserPolicyFunc              func(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error)
+	CreateAccessKeyFunc            func(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error)
+	GetUserFunc                    func(ctx context.Context, input *iam.GetUserInput, opts ...func(*iam.Options)) (*iam.GetUserOutput, error)
+	DeleteUserPolicyFunc           func(ctx context.Context, input *iam.DeleteUserPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteUserPolicyOutput, error)
+	ListUserPoliciesFunc           func(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error)
+	ListAccessKeysFunc             func(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error)
+	DeleteAccessKeyFunc            func(ctx context.Context, input *iam.DeleteAccessKeyInput, opts ...func(*iam.Options)) (*iam.DeleteAccessKeyOutput, error)
+	DeleteUserFunc                 func(ctx context.Context, input *iam.DeleteUserInput, opts ...func(*iam.Options)) (*iam.DeleteUserOutput, error)
+	CreateRoleFunc                 func(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error)
+	GetRoleFunc                    func(ctx context.Context, input *iam.GetRoleInput, opts ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	PutRolePolicyFunc              func(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error)
+	DeleteRolePolicyFunc           func(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error)
+	DeleteRoleFunc                 func(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error)
+	CreatePolicyFunc               func(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error)
+	GetPolicyFunc                  func(ctx context.Context, input *iam.GetPolicyInput, opts ...func(*iam.Options)) (*iam.GetPolicyOutput, error)
+	ListPoliciesFunc               func(ctx context.Context, input *iam.ListPoliciesInput, opts ...func(*iam.Options)) (*iam.ListPoliciesOutput, error)
+	DeletePolicyFunc               func(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error)
+	AttachUserPolicyFunc           func(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error)
+	DetachUserPolicyFunc           func(ctx context.Context, input *iam.DetachUserPolicyInput, opts ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error)
+	ListAttachedUserPoliciesFunc   func(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error)
+	CreateGroupFunc                func(ctx context.Context, input *iam.CreateGroupInput, opts ...func(*iam.Options)) (*iam.CreateGroupOutput, error)
+	GetGroupFunc                   func(ctx context.Context, input *iam.GetGroupInput, opts ...func(*iam.Options)) (*iam.GetGroupOutput, error)
+	DeleteGroupFunc                func(ctx context.Context, input *iam.DeleteGroupInput, opts ...func(*iam.Options)) (*iam.DeleteGroupOutput, error)
+	PutGroupPolicyFunc             func(ctx context.Context, input *iam.PutGroupPolicyInput, opts ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error)
+	DeleteGroupPolicyFunc          func(ctx context.Context, input *iam.DeleteGroupPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteGroupPolicyOutput, error)
+	AddUserToGroupFunc             func(ctx context.Context, input *iam.AddUserToGroupInput, opts ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error)
+	RemoveUserFromGroupFunc        func(ctx context.Context, input *iam.RemoveUserFromGroupInput, opts ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error)
+	ListGroupsForUserFunc          func(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error)
 }
 
 // CreateUser creates a mock IAM user with default behavior or custom logic.
@@ -34,6 +56,14 @@ func (m *MockIAMClient) CreateUser(ctx context.Context, input *iam.CreateUserInp
 	}, nil
 }
 
+// PutUserPermissionsBoundary simulates setting the permissions boundary of an IAM user.
+func (m *MockIAMClient) PutUserPermissionsBoundary(ctx context.Context, input *iam.PutUserPermissionsBoundaryInput, opts ...func(*iam.Options)) (*iam.PutUserPermissionsBoundaryOutput, error) {
+	if m.PutUserPermissionsBoundaryFunc != nil {
+		return m.PutUserPermissionsBoundaryFunc(ctx, input, opts...)
+	}
+	return &iam.PutUserPermissionsBoundaryOutput{}, nil
+}
+
 // PutUserPolicy attaches a mock inline policy to the user.
 func (m *MockIAMClient) PutUserPolicy(ctx context.Context, input *iam.PutUserPolicyInput, opts ...func(*iam.Options)) (*iam.PutUserPolicyOutput, error) {
 	if m.PutUserPolicyFunc != nil {
@@ -76,6 +106,14 @@ func (m *MockIAMClient) DeleteUserPolicy(ctx context.Context, input *iam.DeleteU
 	return &iam.DeleteUserPolicyOutput{}, nil
 }
 
+// ListUserPolicies returns no inline policies by default.
+func (m *MockIAMClient) ListUserPolicies(ctx context.Context, input *iam.ListUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListUserPoliciesOutput, error) {
+	if m.ListUserPoliciesFunc != nil {
+		return m.ListUserPoliciesFunc(ctx, input, opts...)
+	}
+	return &iam.ListUserPoliciesOutput{}, nil
+}
+
 // ListAccessKeys retrieves mock access keys for the user.
 func (m *MockIAMClient) ListAccessKeys(ctx context.Context, input *iam.ListAccessKeysInput, opts ...func(*iam.Options)) (*iam.ListAccessKeysOutput, error) {
 	if m.ListAccessKeysFunc != nil {
@@ -103,3 +141,176 @@ func (m *MockIAMClient) DeleteUser(ctx context.Context, input *iam.DeleteUserInp
 	}
 	return &iam.DeleteUserOutput{}, nil
 }
+
+// CreateRole creates a mock IAM role.
+func (m *MockIAMClient) CreateRole(ctx context.Context, input *iam.CreateRoleInput, opts ...func(*iam.Options)) (*iam.CreateRoleOutput, error) {
+	if m.CreateRoleFunc != nil {
+		return m.CreateRoleFunc(ctx, input, opts...)
+	}
+	return &iam.CreateRoleOutput{
+		Role: &types.Role{
+			RoleName: input.RoleName,
+			Arn:      aws.String("arn:aws:iam::123456789012:role/" + aws.ToString(input.RoleName)),
+		},
+	}, nil
+}
+
+// GetRole retrieves a mock IAM role.
+func (m *MockIAMClient) GetRole(ctx context.Context, input *iam.GetRoleInput, opts ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	if m.GetRoleFunc != nil {
+		return m.GetRoleFunc(ctx, input, opts...)
+	}
+	return &iam.GetRoleOutput{
+		Role: &types.Role{
+			RoleName: input.RoleName,
+			Arn:      aws.String("arn:aws:iam::123456789012:role/" + aws.ToString(input.RoleName)),
+		},
+	}, nil
+}
+
+// PutRolePolicy attaches a mock inline policy to the role.
+func (m *MockIAMClient) PutRolePolicy(ctx context.Context, input *iam.PutRolePolicyInput, opts ...func(*iam.Options)) (*iam.PutRolePolicyOutput, error) {
+	if m.PutRolePolicyFunc != nil {
+		return m.PutRolePolicyFunc(ctx, input, opts...)
+	}
+	return &iam.PutRolePolicyOutput{}, nil
+}
+
+// DeleteRolePolicy deletes a mock inline policy of the role.
+func (m *MockIAMClient) DeleteRolePolicy(ctx context.Context, input *iam.DeleteRolePolicyInput, opts ...func(*iam.Options)) (*iam.DeleteRolePolicyOutput, error) {
+	if m.DeleteRolePolicyFunc != nil {
+		return m.DeleteRolePolicyFunc(ctx, input, opts...)
+	}
+	return &iam.DeleteRolePolicyOutput{}, nil
+}
+
+// DeleteRole deletes a mock IAM role.
+func (m *MockIAMClient) DeleteRole(ctx context.Context, input *iam.DeleteRoleInput, opts ...func(*iam.Options)) (*iam.DeleteRoleOutput, error) {
+	if m.DeleteRoleFunc != nil {
+		return m.DeleteRoleFunc(ctx, input, opts...)
+	}
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+// CreatePolicy creates a mock managed policy.
+func (m *MockIAMClient) CreatePolicy(ctx context.Context, input *iam.CreatePolicyInput, opts ...func(*iam.Options)) (*iam.CreatePolicyOutput, error) {
+	if m.CreatePolicyFunc != nil {
+		return m.CreatePolicyFunc(ctx, input, opts...)
+	}
+	return &iam.CreatePolicyOutput{Policy: &types.Policy{
+		PolicyName: input.PolicyName,
+		Arn:        aws.String("arn:aws:iam::123456789012:policy" + aws.ToString(input.Path) + aws.ToString(input.PolicyName)),
+	}}, nil
+}
+
+// GetPolicy returns a mock managed policy that is not attached to any user.
+func (m *MockIAMClient) GetPolicy(ctx context.Context, input *iam.GetPolicyInput, opts ...func(*iam.Options)) (*iam.GetPolicyOutput, error) {
+	if m.GetPolicyFunc != nil {
+		return m.GetPolicyFunc(ctx, input, opts...)
+	}
+	return &iam.GetPolicyOutput{Policy: &types.Policy{Arn: input.PolicyArn, AttachmentCount: aws.Int32(0)}}, nil
+}
+
+// ListPolicies returns no managed policies by default.
+func (m *MockIAMClient) ListPolicies(ctx context.Context, input *iam.ListPoliciesInput, opts ...func(*iam.Options)) (*iam.ListPoliciesOutput, error) {
+	if m.ListPoliciesFunc != nil {
+		return m.ListPoliciesFunc(ctx, input, opts...)
+	}
+	return &iam.ListPoliciesOutput{}, nil
+}
+
+// DeletePolicy deletes a mock managed policy.
+func (m *MockIAMClient) DeletePolicy(ctx context.Context, input *iam.DeletePolicyInput, opts ...func(*iam.Options)) (*iam.DeletePolicyOutput, error) {
+	if m.DeletePolicyFunc != nil {
+		return m.DeletePolicyFunc(ctx, input, opts...)
+	}
+	return &iam.DeletePolicyOutput{}, nil
+}
+
+// AttachUserPolicy attaches a mock managed policy to the user.
+func (m *MockIAMClient) AttachUserPolicy(ctx context.Context, input *iam.AttachUserPolicyInput, opts ...func(*iam.Options)) (*iam.AttachUserPolicyOutput, error) {
+	if m.AttachUserPolicyFunc != nil {
+		return m.AttachUserPolicyFunc(ctx, input, opts...)
+	}
+	return &iam.AttachUserPolicyOutput{}, nil
+}
+
+// DetachUserPolicy detaches a mock managed policy from the user.
+func (m *MockIAMClient) DetachUserPolicy(ctx context.Context, input *iam.DetachUserPolicyInput, opts ...func(*iam.Options)) (*iam.DetachUserPolicyOutput, error) {
+	if m.DetachUserPolicyFunc != nil {
+		return m.DetachUserPolicyFunc(ctx, input, opts...)
+	}
+	return &iam.DetachUserPolicyOutput{}, nil
+}
+
+// ListAttachedUserPolicies returns no attached policies by default.
+func (m *MockIAMClient) ListAttachedUserPolicies(ctx context.Context, input *iam.ListAttachedUserPoliciesInput, opts ...func(*iam.Options)) (*iam.ListAttachedUserPoliciesOutput, error) {
+	if m.ListAttachedUserPoliciesFunc != nil {
+		return m.ListAttachedUserPoliciesFunc(ctx, input, opts...)
+	}
+	return &iam.ListAttachedUserPoliciesOutput{}, nil
+}
+
+// CreateGroup creates a mock IAM group.
+func (m *MockIAMClient) CreateGroup(ctx context.Context, input *iam.CreateGroupInput, opts ...func(*iam.Options)) (*iam.CreateGroupOutput, error) {
+	if m.CreateGroupFunc != nil {
+		return m.CreateGroupFunc(ctx, input, opts...)
+	}
+	return &iam.CreateGroupOutput{Group: &types.Group{GroupName: input.GroupName}}, nil
+}
+
+// GetGroup returns a mock IAM group without users.
+func (m *MockIAMClient) GetGroup(ctx context.Context, input *iam.GetGroupInput, opts ...func(*iam.Options)) (*iam.GetGroupOutput, error) {
+	if m.GetGroupFunc != nil {
+		return m.GetGroupFunc(ctx, input, opts...)
+	}
+	return &iam.GetGroupOutput{Group: &types.Group{GroupName: input.GroupName}}, nil
+}
+
+// DeleteGroup deletes a mock IAM group.
+func (m *MockIAMClient) DeleteGroup(ctx context.Context, input *iam.DeleteGroupInput, opts ...func(*iam.Options)) (*iam.DeleteGroupOutput, error) {
+	if m.DeleteGroupFunc != nil {
+		return m.DeleteGroupFunc(ctx, input, opts...)
+	}
+	return &iam.DeleteGroupOutput{}, nil
+}
+
+// PutGroupPolicy attaches a mock inline policy to the group.
+func (m *MockIAMClient) PutGroupPolicy(ctx context.Context, input *iam.PutGroupPolicyInput, opts ...func(*iam.Options)) (*iam.PutGroupPolicyOutput, error) {
+	if m.PutGroupPolicyFunc != nil {
+		return m.PutGroupPolicyFunc(ctx, input, opts...)
+	}
+	return &iam.PutGroupPolicyOutput{}, nil
+}
+
+// DeleteGroupPolicy deletes a mock inline policy of the group.
+func (m *MockIAMClient) DeleteGroupPolicy(ctx context.Context, input *iam.DeleteGroupPolicyInput, opts ...func(*iam.Options)) (*iam.DeleteGroupPolicyOutput, error) {
+	if m.DeleteGroupPolicyFunc != nil {
+		return m.DeleteGroupPolicyFunc(ctx, input, opts...)
+	}
+	return &iam.DeleteGroupPolicyOutput{}, nil
+}
+
+// AddUserToGroup adds the user to a mock group.
+func (m *MockIAMClient) AddUserToGroup(ctx context.Context, input *iam.AddUserToGroupInput, opts ...func(*iam.Options)) (*iam.AddUserToGroupOutput, error) {
+	if m.AddUserToGroupFunc != nil {
+		return m.AddUserToGroupFunc(ctx, input, opts...)
+	}
+	return &iam.AddUserToGroupOutput{}, nil
+}
+
+// RemoveUserFromGroup removes the user from a mock group.
+func (m *MockIAMClient) RemoveUserFromGroup(ctx context.Context, input *iam.RemoveUserFromGroupInput, opts ...func(*iam.Options)) (*iam.RemoveUserFromGroupOutput, error) {
+	if m.RemoveUserFromGroupFunc != nil {
+		return m.RemoveUserFromGroupFunc(ctx, input, opts...)
+	}
+	return &iam.RemoveUserFromGroupOutput{}, nil
+}
+
+// ListGroupsForUser returns no groups by default.
+func (m *MockIAMClient) ListGroupsForUser(ctx context.Context, input *iam.ListGroupsForUserInput, opts ...func(*iam.Options)) (*iam.ListGroupsForUserOutput, error) {
+	if m.ListGroupsForUserFunc != nil {
+		return m.ListGroupsForUserFunc(ctx, input, opts...)
+	}
+	return &iam.ListGroupsForUserOutput{}, nil
+}
@@ -0,0 +1,42 @@
+package mock
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// MockSTSClient simulates the behavior of an STS client for testing purposes.
+type MockSTSClient struct {
+	AssumeRoleFunc        func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	GetCallerIdentityFunc func(ctx context.Context, input *sts.GetCallerIdentityInput, opts ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// AssumeRole returns mock temporary credentials valid for the requested duration.
+func (m *MockSTSClient) AssumeRole(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	if m.AssumeRoleFunc != nil {
+		return m.AssumeRoleFunc(ctx, input, opts...)
+	}
+	return &sts.AssumeRoleOutput{
+		Credentials: &types.Credentials{
+			AccessKeyId:     aws.String("mock-session-access-key-id"),
+			SecretAccessKey: aws.String("mock-session-secret-access-key"),
+			SessionToken:    aws.String("mock-session-token"),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(aws.ToInt32(input.DurationSeconds)) * time.Second)),
+		},
+	}, nil
+}
+
+// GetCallerIdentity returns a mock identity.
+func (m *MockSTSClient) GetCallerIdentity(ctx context.Context, input *sts.GetCallerIdentityInput, opts ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	if m.GetCallerIdentityFunc != nil {
+		return m.GetCallerIdentityFunc(ctx, input, opts...)
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+		Arn:     aws.String("arn:aws:iam::123456789012:user/cosi-admin"),
+	}, nil
+}
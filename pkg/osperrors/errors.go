@@ -22,6 +22,19 @@ type ObjectStorageProviderError struct {
 	ClientMessageTpl string // Template for client-facing error messages with %s placeholder for resource name
 }
 
+// DriverLimitExceeded is the error code of S3/IAM requests rejected by the driver itself,
+// because too many requests are already waiting for the backend.
+const DriverLimitExceeded = "DriverLimitExceeded"
+
+// KnownErrorCode reports whether code is translated by the S3 or IAM error table.
+func KnownErrorCode(code string) bool {
+	if _, ok := S3ErrorTable[code]; ok {
+		return true
+	}
+	_, ok := IAMErrorTable[code]
+	return ok
+}
+
 // Common error messages to reduce allocations
 const (
 	unexpectedErrorMsg = "unexpected error"
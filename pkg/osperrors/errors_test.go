@@ -167,3 +167,16 @@ var _ = Describe("TranslateObjectStorageProviderError", func() {
 		})
 	})
 })
+
+var _ = Describe("KnownErrorCode", func() {
+	DescribeTable("should report the codes of the S3 and IAM error tables",
+		func(code string, known bool) {
+			Expect(osperrors.KnownErrorCode(code)).To(Equal(known))
+		},
+		Entry("S3 error code", "BucketNotEmpty", true),
+		Entry("IAM error code", "NoSuchEntity", true),
+		Entry("driver error code", osperrors.DriverLimitExceeded, true),
+		Entry("unknown error code", "SomethingUnexpected", false),
+		Entry("empty error code", "", false),
+	)
+})
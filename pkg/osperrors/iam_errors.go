@@ -48,6 +48,11 @@ var IAMErrorTable = map[string]ObjectStorageProviderError{
 	},
 
 	// ResourceExhausted: resource quota exceeded
+	DriverLimitExceeded: {
+		GRPCCode:         codes.ResourceExhausted,
+		LogMessage:       "Request rejected by the driver limits - too many requests in progress",
+		ClientMessageTpl: "too many requests in progress for user %s",
+	},
 	"LimitExceeded": {
 		GRPCCode:         codes.ResourceExhausted,
 		LogMessage:       "IAM service limit exceeded",
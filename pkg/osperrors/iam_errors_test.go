@@ -184,6 +184,7 @@ var _ = Describe("IAM Error Translation", func() {
 				"EntityTemporarilyUnmodifiable",
 				"ServiceUnavailable",
 				"Throttled",
+				osperrors.DriverLimitExceeded,
 			}
 
 			for _, code := range expectedErrorCodes {
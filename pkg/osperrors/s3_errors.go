@@ -83,6 +83,11 @@ var S3ErrorTable = map[string]ObjectStorageProviderError{
 	},
 
 	// ResourceExhausted: resource quota exceeded
+	DriverLimitExceeded: {
+		GRPCCode:         codes.ResourceExhausted,
+		LogMessage:       "Request rejected by the driver limits - too many requests in progress",
+		ClientMessageTpl: "too many requests in progress for bucket %s",
+	},
 	"Throttled": {
 		GRPCCode:         codes.ResourceExhausted,
 		LogMessage:       "Request throttled - rate limit exceeded",
@@ -145,6 +145,7 @@ var _ = Describe("S3 Error Translation", func() {
 				"RequestTimeout",
 				"ServiceUnavailable",
 				"Throttled",
+				osperrors.DriverLimitExceeded,
 				"TooManyBuckets",
 				"InvalidAccessKeyId",
 				"SignatureDoesNotMatch",
@@ -0,0 +1,108 @@
+// Package ratelimit bounds the load the driver puts on the object storage backends.
+// Driver operations and S3/IAM requests wait for a free slot and a rate token, and are
+// rejected once too many of them are already waiting.
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	smithy "github.com/aws/smithy-go"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/osperrors"
+	"golang.org/x/time/rate"
+)
+
+// ErrLimitExceeded is returned when the queue of a limiter is full, or when no rate token can be
+// obtained before the deadline of the request. It is translated to codes.ResourceExhausted.
+var ErrLimitExceeded error = &smithy.GenericAPIError{
+	Code:    osperrors.DriverLimitExceeded,
+	Message: "too many requests in progress, retry later",
+	Fault:   smithy.FaultClient,
+}
+
+// Config holds the limits of a Limiter. Zero values disable the corresponding limit.
+type Config struct {
+	// MaxConcurrent is the number of requests in progress at the same time.
+	MaxConcurrent int
+	// MaxQueued is the number of requests waiting for a slot or a rate token, others are rejected.
+	MaxQueued int
+	// RequestsPerSecond and Burst configure the token bucket refilled at RequestsPerSecond.
+	RequestsPerSecond float64
+	Burst             int
+}
+
+// Limiter bounds the concurrency and rate of the requests of one backend or of the driver operations.
+type Limiter struct {
+	name    string
+	config  Config
+	slots   chan struct{}
+	tokens  *rate.Limiter
+	waiting atomic.Int64
+}
+
+// NewLimiter creates a limiter named after what it limits, used as the label of its metrics.
+func NewLimiter(name string, config Config) *Limiter {
+	limiter := &Limiter{name: name, config: config}
+	if config.MaxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, config.MaxConcurrent)
+	}
+	if config.RequestsPerSecond > 0 {
+		burst := config.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter.tokens = rate.NewLimiter(rate.Limit(config.RequestsPerSecond), burst)
+	}
+	return limiter
+}
+
+// Acquire waits for a slot and a rate token, and returns the function releasing the slot.
+// It fails with ErrLimitExceeded when the queue is full, or with the error of ctx when it is done.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil || (l.slots == nil && l.tokens == nil) {
+		return func() {}, nil
+	}
+
+	waiting := l.waiting.Add(1)
+	if l.config.MaxQueued > 0 && waiting > int64(l.config.MaxQueued) {
+		l.waiting.Add(-1)
+		return nil, ErrLimitExceeded
+	}
+	l.reportQueueDepth(waiting)
+	start := time.Now()
+	defer func() {
+		l.reportQueueDepth(l.waiting.Add(-1))
+		if metrics.LimiterWaitDuration != nil {
+			metrics.LimiterWaitDuration.WithLabelValues(l.name).Observe(time.Since(start).Seconds())
+		}
+	}()
+
+	release := func() {}
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+			release = func() { <-l.slots }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if l.tokens != nil {
+		if err := l.tokens.Wait(ctx); err != nil {
+			release()
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// The next token comes after the deadline of the request
+			return nil, ErrLimitExceeded
+		}
+	}
+	return release, nil
+}
+
+func (l *Limiter) reportQueueDepth(waiting int64) {
+	if metrics.LimiterQueueDepth != nil {
+		metrics.LimiterQueueDepth.WithLabelValues(l.name).Set(float64(waiting))
+	}
+}
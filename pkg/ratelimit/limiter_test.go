@@ -0,0 +1,117 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+)
+
+var _ = BeforeSuite(func() {
+	metrics.InitializeMetrics("test_ratelimit", prometheus.NewRegistry())
+})
+
+var _ = Describe("Limiter", func() {
+	It("should not limit anything without limits", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("S3", ratelimit.Config{})
+		for i := 0; i < 100; i++ {
+			release, err := limiter.Acquire(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			defer release()
+		}
+	})
+
+	It("should make requests over the concurrency limit wait for a slot", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("concurrency", ratelimit.Config{MaxConcurrent: 1})
+		release, err := limiter.Acquire(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		acquired := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			second, err := limiter.Acquire(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			second()
+			close(acquired)
+		}()
+
+		Eventually(func() float64 {
+			return testutil.ToFloat64(metrics.LimiterQueueDepth.WithLabelValues("concurrency"))
+		}).Should(Equal(1.0))
+		Consistently(acquired, 100*time.Millisecond).ShouldNot(BeClosed())
+
+		release()
+		Eventually(acquired).Should(BeClosed())
+		Expect(testutil.ToFloat64(metrics.LimiterQueueDepth.WithLabelValues("concurrency"))).To(BeZero())
+		Expect(testutil.CollectAndCount(metrics.LimiterWaitDuration.WithLabelValues("concurrency").(prometheus.Histogram))).To(Equal(1))
+	}, SpecTimeout(5*time.Second))
+
+	It("should reject requests once the queue is full", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("queue", ratelimit.Config{MaxConcurrent: 1, MaxQueued: 1})
+		release, err := limiter.Acquire(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer release()
+
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_, _ = limiter.Acquire(waitCtx)
+		}()
+		Eventually(func() float64 {
+			return testutil.ToFloat64(metrics.LimiterQueueDepth.WithLabelValues("queue"))
+		}).Should(Equal(1.0))
+
+		_, err = limiter.Acquire(ctx)
+		Expect(errors.Is(err, ratelimit.ErrLimitExceeded)).To(BeTrue())
+	}, SpecTimeout(5*time.Second))
+
+	It("should stop waiting when the context is done", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("S3", ratelimit.Config{MaxConcurrent: 1})
+		release, err := limiter.Acquire(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer release()
+
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(waitCtx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	}, SpecTimeout(5*time.Second))
+
+	It("should space requests according to the rate", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("S3", ratelimit.Config{RequestsPerSecond: 20, Burst: 1})
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			release, err := limiter.Acquire(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			release()
+		}
+		Expect(time.Since(start)).To(BeNumerically(">=", 90*time.Millisecond))
+	}, SpecTimeout(5*time.Second))
+
+	It("should reject requests whose deadline comes before the next token", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("S3", ratelimit.Config{RequestsPerSecond: 0.1, Burst: 1})
+		release, err := limiter.Acquire(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		release()
+
+		waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		_, err = limiter.Acquire(waitCtx)
+		Expect(errors.Is(err, ratelimit.ErrLimitExceeded)).To(BeTrue())
+	}, SpecTimeout(5*time.Second))
+})
+
+var _ = Describe("Registry", func() {
+	It("should share one limiter per backend endpoint", func() {
+		registry := ratelimit.NewRegistry(ratelimit.Config{MaxConcurrent: 1}, ratelimit.Config{MaxConcurrent: 2})
+		Expect(registry.Backend("https://s3.ring-a.example.com")).To(BeIdenticalTo(registry.Backend("https://s3.ring-a.example.com")))
+		Expect(registry.Backend("https://s3.ring-a.example.com")).NotTo(BeIdenticalTo(registry.Backend("https://s3.ring-b.example.com")))
+		Expect(registry.Operations()).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/middleware"
+)
+
+// AttachRateLimitMiddleware makes every attempt wait for the limiter. It runs right after the
+// retry middleware, so retries are limited too, and before signing, so waiting does not age signatures.
+func AttachRateLimitMiddleware(stack *middleware.Stack, limiter *Limiter) error {
+	middlewareFunc := middleware.FinalizeMiddlewareFunc("RateLimit", func(
+		ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+	) (out middleware.FinalizeOutput, metadata middleware.Metadata, err error) {
+		release, err := limiter.Acquire(ctx)
+		if err != nil {
+			return out, metadata, err
+		}
+		defer release()
+		return next.HandleFinalize(ctx, in)
+	})
+
+	return stack.Finalize.Insert(middlewareFunc, "Retry", middleware.After)
+}
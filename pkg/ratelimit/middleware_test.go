@@ -0,0 +1,78 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/scality/cosi-driver/pkg/metrics"
+	"github.com/scality/cosi-driver/pkg/ratelimit"
+)
+
+// countingHandler counts the attempts reaching the end of the stack
+type countingHandler struct {
+	attempts *int
+}
+
+func (h countingHandler) HandleFinalize(ctx context.Context, in middleware.FinalizeInput) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	*h.attempts++
+	return middleware.FinalizeOutput{}, middleware.Metadata{}, nil
+}
+
+var _ = Describe("AttachRateLimitMiddleware", func() {
+	var stack *middleware.Stack
+
+	passThrough := func(id string) middleware.FinalizeMiddleware {
+		return middleware.FinalizeMiddlewareFunc(id, func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			return next.HandleFinalize(ctx, in)
+		})
+	}
+
+	BeforeEach(func() {
+		stack = middleware.NewStack("testStack", smithyhttp.NewStackRequest)
+		Expect(stack.Finalize.Add(passThrough("Retry"), middleware.After)).To(Succeed())
+		Expect(stack.Finalize.Add(passThrough("Signing"), middleware.After)).To(Succeed())
+	})
+
+	It("should be added between the retry and signing middlewares", func() {
+		Expect(ratelimit.AttachRateLimitMiddleware(stack, ratelimit.NewLimiter("S3", ratelimit.Config{}))).To(Succeed())
+		Expect(stack.Finalize.List()).To(Equal([]string{"Retry", "RateLimit", "Signing"}))
+	})
+
+	It("should fail attempts rejected by the limiter", func(ctx SpecContext) {
+		limiter := ratelimit.NewLimiter("middleware", ratelimit.Config{MaxConcurrent: 1, MaxQueued: 1})
+		Expect(ratelimit.AttachRateLimitMiddleware(stack, limiter)).To(Succeed())
+		rateLimit, ok := stack.Finalize.Get("RateLimit")
+		Expect(ok).To(BeTrue())
+
+		attempts := 0
+		_, _, err := rateLimit.HandleFinalize(ctx, middleware.FinalizeInput{}, countingHandler{attempts: &attempts})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(attempts).To(Equal(1))
+
+		// Hold the only slot and fill the queue
+		release, err := limiter.Acquire(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		defer release()
+		waitCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			_, _ = limiter.Acquire(waitCtx)
+		}()
+
+		Eventually(func() float64 {
+			return testutil.ToFloat64(metrics.LimiterQueueDepth.WithLabelValues("middleware"))
+		}).Should(Equal(1.0))
+
+		_, _, err = rateLimit.HandleFinalize(ctx, middleware.FinalizeInput{}, countingHandler{attempts: &attempts})
+		Expect(errors.Is(err, ratelimit.ErrLimitExceeded)).To(BeTrue())
+		Expect(attempts).To(Equal(1))
+	}, SpecTimeout(5*time.Second))
+})
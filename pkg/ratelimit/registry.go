@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"sync"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	"k8s.io/klog/v2"
+)
+
+// OperationsLimiter is the name of the limiter of driver operations.
+const OperationsLimiter = "operations"
+
+// Registry holds the limiter of driver operations and one limiter per backend endpoint, shared
+// by the S3/IAM/STS clients created for each request.
+type Registry struct {
+	operations *Limiter
+	backend    Config
+
+	mu       sync.Mutex
+	backends map[string]*Limiter // by endpoint
+}
+
+// Limiters is the registry used by the driver and the S3, IAM and STS clients. It is replaced at
+// startup to apply the configured limits, and does not limit anything until then.
+var Limiters = NewRegistry(Config{}, Config{})
+
+// NewRegistry creates a registry limiting driver operations with operations, and the requests
+// sent to each backend endpoint with backend.
+func NewRegistry(operations, backend Config) *Registry {
+	return &Registry{
+		operations: NewLimiter(OperationsLimiter, operations),
+		backend:    backend,
+		backends:   map[string]*Limiter{},
+	}
+}
+
+// Operations returns the limiter of driver operations.
+func (r *Registry) Operations() *Limiter {
+	return r.operations
+}
+
+// Backend returns the limiter of the requests sent to endpoint, creating it if needed. Clients of
+// different object storage secrets, or of different services, share it when they use the same endpoint.
+func (r *Registry) Backend(endpoint string) *Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if limiter, ok := r.backends[endpoint]; ok {
+		return limiter
+	}
+	limiter := NewLimiter(endpoint, r.backend)
+	r.backends[endpoint] = limiter
+	klog.V(c.LvlEvent).InfoS("Created backend limiter", "endpoint", endpoint, "maxConcurrent", r.backend.MaxConcurrent,
+		"maxQueued", r.backend.MaxQueued, "requestsPerSecond", r.backend.RequestsPerSecond, "burst", r.backend.Burst)
+	return limiter
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	c "github.com/scality/cosi-driver/pkg/constants"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// DefaultCABundleKey is the ConfigMap key holding the PEM bundle when none is configured.
+// It matches the key used by cert-manager's trust-manager in its examples.
+const DefaultCABundleKey = "ca.crt"
+
+// CABundleWatcher serves CA bundles stored in ConfigMaps, such as the ones distributed by
+// cert-manager's trust-manager. Each ConfigMap is watched from the first time it is requested,
+// so S3/IAM transports built afterwards always use the latest bundle without an API call.
+type CABundleWatcher struct {
+	mu      sync.Mutex
+	bundles map[string]*caBundleInformer
+}
+
+type caBundleInformer struct {
+	lister listersv1.ConfigMapLister
+	synced cache.InformerSynced
+	stop   chan struct{}
+}
+
+// NewCABundleWatcher creates an empty CABundleWatcher.
+func NewCABundleWatcher() *CABundleWatcher {
+	return &CABundleWatcher{
+		bundles: map[string]*caBundleInformer{},
+	}
+}
+
+// Get returns the PEM bundle stored under key in the given ConfigMap, starting a watch on it if needed.
+func (w *CABundleWatcher) Get(ctx context.Context, clientset kubernetes.Interface, namespace, name, key string) ([]byte, error) {
+	if key == "" {
+		key = DefaultCABundleKey
+	}
+
+	bundle := w.informerFor(clientset, namespace, name)
+	if !cache.WaitForCacheSync(ctx.Done(), bundle.synced) {
+		return nil, fmt.Errorf("timed out waiting for CA bundle ConfigMap %s/%s to sync", namespace, name)
+	}
+
+	configMap, err := bundle.lister.ConfigMaps(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		// Do not keep watching a ConfigMap that may never be created, for example after a typo in the secret
+		w.forget(namespace, name, bundle)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CA bundle ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	if data, ok := configMap.Data[key]; ok {
+		return []byte(data), nil
+	}
+	if data, ok := configMap.BinaryData[key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("key %q not found in CA bundle ConfigMap %s/%s", key, namespace, name)
+}
+
+// Stop stops all ConfigMap watches. The watcher can be reused afterwards.
+func (w *CABundleWatcher) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for id, bundle := range w.bundles {
+		close(bundle.stop)
+		delete(w.bundles, id)
+	}
+}
+
+// forget stops the watch of the ConfigMap, unless it was already replaced by another one.
+func (w *CABundleWatcher) forget(namespace, name string, bundle *caBundleInformer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := namespace + "/" + name
+	if w.bundles[id] == bundle {
+		close(bundle.stop)
+		delete(w.bundles, id)
+		klog.V(c.LvlDebug).InfoS("Stopped watching missing CA bundle ConfigMap", "namespace", namespace, "name", name)
+	}
+}
+
+func (w *CABundleWatcher) informerFor(clientset kubernetes.Interface, namespace, name string) *caBundleInformer {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := namespace + "/" + name
+	if bundle, ok := w.bundles[id]; ok {
+		return bundle
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	configMaps := factory.Core().V1().ConfigMaps()
+	_, err := configMaps.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if configMap, ok := newObj.(*corev1.ConfigMap); ok && configMap.Name == name {
+				klog.V(c.LvlInfo).InfoS("CA bundle ConfigMap changed, new transports will use the updated bundle", "namespace", namespace, "name", name)
+			}
+		},
+	})
+	if err != nil {
+		klog.ErrorS(err, "Failed to register CA bundle ConfigMap event handler", "namespace", namespace, "name", name)
+	}
+
+	bundle := &caBundleInformer{
+		lister: configMaps.Lister(),
+		synced: configMaps.Informer().HasSynced,
+		stop:   make(chan struct{}),
+	}
+	factory.Start(bundle.stop)
+	w.bundles[id] = bundle
+	klog.V(c.LvlDebug).InfoS("Started watching CA bundle ConfigMap", "namespace", namespace, "name", name)
+	return bundle
+}
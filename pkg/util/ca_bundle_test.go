@@ -0,0 +1,96 @@
+package util_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/scality/cosi-driver/pkg/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var _ = Describe("CABundleWatcher", func() {
+	const (
+		namespace = "cert-manager"
+		name      = "ring-ca-bundle"
+	)
+
+	var (
+		clientset *fake.Clientset
+		watcher   *util.CABundleWatcher
+	)
+
+	BeforeEach(func() {
+		clientset = fake.NewSimpleClientset(&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string]string{util.DefaultCABundleKey: "bundle-v1", "trust-bundle.pem": "custom-key"},
+		})
+		watcher = util.NewCABundleWatcher()
+	})
+
+	AfterEach(func() {
+		watcher.Stop()
+	})
+
+	It("should return the bundle stored under the default key", func(ctx SpecContext) {
+		bundle, err := watcher.Get(ctx, clientset, namespace, name, "")
+		Expect(err).To(BeNil())
+		Expect(string(bundle)).To(Equal("bundle-v1"))
+	})
+
+	It("should return the bundle stored under a custom key", func(ctx SpecContext) {
+		bundle, err := watcher.Get(ctx, clientset, namespace, name, "trust-bundle.pem")
+		Expect(err).To(BeNil())
+		Expect(string(bundle)).To(Equal("custom-key"))
+	})
+
+	It("should return an error if the key is missing", func(ctx SpecContext) {
+		_, err := watcher.Get(ctx, clientset, namespace, name, "missing.pem")
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("missing.pem"))
+	})
+
+	It("should return an error if the ConfigMap does not exist", func(ctx SpecContext) {
+		_, err := watcher.Get(ctx, clientset, namespace, "unknown", "")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should stop watching a ConfigMap that does not exist", func(ctx SpecContext) {
+		lists := func() int {
+			count := 0
+			for _, action := range clientset.Actions() {
+				if action.GetVerb() == "list" && action.GetResource().Resource == "configmaps" {
+					count++
+				}
+			}
+			return count
+		}
+
+		_, err := watcher.Get(ctx, clientset, namespace, "unknown", "")
+		Expect(err).To(HaveOccurred())
+		Expect(lists()).To(Equal(1))
+
+		// The next request starts a new watch instead of reusing the stopped one
+		_, err = watcher.Get(ctx, clientset, namespace, "unknown", "")
+		Expect(err).To(HaveOccurred())
+		Expect(lists()).To(Equal(2))
+	})
+
+	It("should serve the updated bundle after the ConfigMap changes", func(ctx SpecContext) {
+		_, err := watcher.Get(ctx, clientset, namespace, name, "")
+		Expect(err).To(BeNil())
+
+		_, err = clientset.CoreV1().ConfigMaps(namespace).Update(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       map[string]string{util.DefaultCABundleKey: "bundle-v2"},
+		}, metav1.UpdateOptions{})
+		Expect(err).To(BeNil())
+
+		Eventually(func() string {
+			bundle, _ := watcher.Get(ctx, clientset, namespace, name, "")
+			return string(bundle)
+		}).WithTimeout(5 * time.Second).Should(Equal("bundle-v2"))
+	})
+})
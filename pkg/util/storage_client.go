@@ -1,12 +1,21 @@
 package util
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	c "github.com/scality/cosi-driver/pkg/constants"
+	"golang.org/x/net/http/httpproxy"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"k8s.io/klog/v2"
@@ -16,6 +25,15 @@ import (
 const (
 	DefaultRegion         = "us-east-1"
 	DefaultRequestTimeout = 15 * time.Second
+	// DefaultWebIdentityTokenFile is where the Helm chart mounts the projected service account token
+	DefaultWebIdentityTokenFile = "/var/run/secrets/cosi.scality.com/serviceaccount/token"
+)
+
+// S3 addressing styles
+const (
+	AddressingStylePath    = "path"    // https://endpoint/bucket/key
+	AddressingStyleVirtual = "virtual" // https://bucket.endpoint/key
+	AddressingStyleAuto    = "auto"    // path for IP addresses and single-label hosts, virtual otherwise
 )
 
 // StorageClientParameters holds configuration for S3/IAM clients.
@@ -27,30 +45,220 @@ type StorageClientParameters struct {
 	Region          string // Optional field for region
 	TLSCert         []byte // Optional field for TLS certificates
 	Debug           bool   // Optional field for debug mode
+
+	RoleARN              string // Optional role assumed with a web identity token, replacing AccessKeyID/SecretAccessKey
+	WebIdentityTokenFile string // Optional path of the web identity token (default: DefaultWebIdentityTokenFile)
+	STSEndpoint          string // Optional STS endpoint used to assume RoleARN (default: IAMEndpoint)
+
+	Endpoints    []string // All S3 endpoints when several are configured for failover, Endpoint being the first
+	IAMEndpoints []string // All IAM endpoints when several are configured for failover, IAMEndpoint being the first
+
+	CABundleConfigMap    string // Optional ConfigMap holding a CA bundle, in the namespace of the secret
+	CABundleConfigMapKey string // Optional key of the CA bundle in CABundleConfigMap (default: ca.crt)
+
+	HTTPProxy string // Optional proxy URL for both HTTP and HTTPS endpoints (default: HTTP_PROXY/HTTPS_PROXY)
+	NoProxy   string // Optional comma-separated hosts bypassing the proxy (default: NO_PROXY)
+
+	RequestTimeout time.Duration // Optional timeout of a single HTTP attempt (default: DefaultRequestTimeout)
+	MaxAttempts    int           // Optional maximum number of attempts per SDK call (default: SDK default)
+	MaxBackoff     time.Duration // Optional maximum delay between attempts (default: SDK default)
+	RetryMode      aws.RetryMode // Optional retry mode, standard or adaptive (default: standard)
+
+	AddressingStyle string // Optional S3 addressing style: path, virtual or auto (default: path)
+
+	VaultEndpoint        string // Optional Vault administration endpoint, required to create Vault accounts
+	VaultAccessKeyID     string // Optional access key of the Vault administration API
+	VaultSecretAccessKey string // Optional secret key of the Vault administration API
 }
 
 // NewStorageClientParameters initializes default storage client parameters.
 func NewStorageClientParameters() *StorageClientParameters {
 	return &StorageClientParameters{
-		Region: DefaultRegion,
-		Debug:  false,
+		Region:          DefaultRegion,
+		Debug:           false,
+		RequestTimeout:  DefaultRequestTimeout,
+		RetryMode:       aws.RetryModeStandard,
+		AddressingStyle: AddressingStylePath,
 	}
 }
 
-// Validate checks that all required fields are set.
-func (p *StorageClientParameters) Validate() error {
-	if p.AccessKeyID == "" {
-		return status.Error(codes.InvalidArgument, "accessKeyID is required")
+// SetRetryOptions reads the requestTimeout, maxAttempts, maxBackoff and retryMode settings.
+// Settings that are absent keep their current value, so BucketClass parameters can override the secret.
+func (p *StorageClientParameters) SetRetryOptions(settings map[string]string) error {
+	if value := settings["requestTimeout"]; value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return status.Errorf(codes.InvalidArgument, "requestTimeout must be a positive duration, got %q", value)
+		}
+		p.RequestTimeout = timeout
+	}
+	if value := settings["maxAttempts"]; value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return status.Errorf(codes.InvalidArgument, "maxAttempts must be a positive integer, got %q", value)
+		}
+		p.MaxAttempts = attempts
+	}
+	if value := settings["maxBackoff"]; value != "" {
+		backoff, err := time.ParseDuration(value)
+		if err != nil || backoff <= 0 {
+			return status.Errorf(codes.InvalidArgument, "maxBackoff must be a positive duration, got %q", value)
+		}
+		p.MaxBackoff = backoff
 	}
-	if p.SecretAccessKey == "" {
-		return status.Error(codes.InvalidArgument, "secretAccessKey is required")
+	if value := settings["retryMode"]; value != "" {
+		mode, err := aws.ParseRetryMode(value)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "retryMode must be standard or adaptive, got %q", value)
+		}
+		p.RetryMode = mode
+	}
+	return nil
+}
+
+// NewRetryer returns the retryer constructor matching the retry settings of the parameters.
+func NewRetryer(params StorageClientParameters) func() aws.Retryer {
+	standardOptions := func(o *retry.StandardOptions) {
+		if params.MaxAttempts > 0 {
+			o.MaxAttempts = params.MaxAttempts
+		}
+		if params.MaxBackoff > 0 {
+			o.MaxBackoff = params.MaxBackoff
+		}
+	}
+
+	return func() aws.Retryer {
+		if params.RetryMode == aws.RetryModeAdaptive {
+			return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+				o.StandardOptions = append(o.StandardOptions, standardOptions)
+			})
+		}
+		return retry.NewStandard(standardOptions)
+	}
+}
+
+// Validate checks that all required fields are set. Either static keys or a role to assume are required.
+func (p *StorageClientParameters) Validate() error {
+	if p.RoleARN != "" {
+		if p.AccessKeyID != "" || p.SecretAccessKey != "" {
+			return status.Error(codes.InvalidArgument, "roleArn cannot be combined with accessKeyID and secretAccessKey")
+		}
+	} else {
+		if p.AccessKeyID == "" {
+			return status.Error(codes.InvalidArgument, "accessKeyID is required")
+		}
+		if p.SecretAccessKey == "" {
+			return status.Error(codes.InvalidArgument, "secretAccessKey is required")
+		}
 	}
 	if p.Endpoint == "" {
 		return status.Error(codes.InvalidArgument, "endpoint is required")
 	}
+	if err := validateEndpointSchemes(p.Endpoints); err != nil {
+		return err
+	}
+	if err := validateEndpointSchemes(p.IAMEndpoints); err != nil {
+		return err
+	}
+	if p.HTTPProxy != "" {
+		if _, err := url.Parse(p.HTTPProxy); err != nil {
+			return status.Error(codes.InvalidArgument, "httpProxy must be a valid URL")
+		}
+	}
+	if p.VaultEndpoint != "" && (p.VaultAccessKeyID == "" || p.VaultSecretAccessKey == "") {
+		return status.Error(codes.InvalidArgument, "vaultAccessKeyId and vaultSecretAccessKey are required with vaultEndpoint")
+	}
+	switch p.AddressingStyle {
+	case "", AddressingStylePath, AddressingStyleVirtual, AddressingStyleAuto:
+	default:
+		return status.Error(codes.InvalidArgument, "addressingStyle must be path, virtual or auto")
+	}
 	return nil
 }
 
+// validateEndpointSchemes checks that failover endpoints share the scheme of the first one,
+// since the TLS settings of a client are chosen from its first endpoint.
+func validateEndpointSchemes(endpoints []string) error {
+	for _, endpoint := range endpoints[min(1, len(endpoints)):] {
+		if strings.HasPrefix(endpoint, "https://") != strings.HasPrefix(endpoints[0], "https://") {
+			return status.Error(codes.InvalidArgument, "all endpoints of a list must use the same scheme")
+		}
+	}
+	return nil
+}
+
+// ResolvedAddressingStyle returns the concrete addressing style, path or virtual, used for the S3 endpoint.
+// In auto mode, endpoints that cannot serve bucket subdomains (IP addresses, localhost or other
+// single-label hosts) use path style and all others use virtual-hosted style.
+func (p *StorageClientParameters) ResolvedAddressingStyle() string {
+	switch p.AddressingStyle {
+	case AddressingStyleVirtual:
+		return AddressingStyleVirtual
+	case AddressingStyleAuto:
+		endpoint, err := url.Parse(p.Endpoint)
+		if err != nil {
+			return AddressingStylePath
+		}
+		host := endpoint.Hostname()
+		if net.ParseIP(host) != nil || !strings.Contains(host, ".") {
+			return AddressingStylePath
+		}
+		return AddressingStyleVirtual
+	default:
+		return AddressingStylePath
+	}
+}
+
+// NewHTTPClient builds the HTTP client used by S3/IAM clients to reach the given endpoint.
+func NewHTTPClient(endpoint string, params StorageClientParameters) *http.Client {
+	var transport *http.Transport
+	if strings.HasPrefix(endpoint, "https://") {
+		klog.V(c.LvlDebug).InfoS("Configuring TLS transport", "endpoint", endpoint)
+		transport = ConfigureTLSTransport(params.TLSCert)
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	ConfigureProxy(transport, params)
+
+	timeout := params.RequestTimeout
+	if timeout == 0 {
+		timeout = DefaultRequestTimeout
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+	}
+}
+
+// HTTPClientKey identifies the settings NewHTTPClient builds clients from, so that state tied to
+// the connections of a client, such as the health of endpoints, is only shared by identical clients.
+func HTTPClientKey(params StorageClientParameters) string {
+	hash := sha256.New()
+	for _, setting := range []string{string(params.TLSCert), params.HTTPProxy, params.NoProxy, params.RequestTimeout.String()} {
+		hash.Write([]byte(setting))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16]
+}
+
+// ConfigureProxy sets the proxy of the transport. The httpProxy and noProxy settings of the
+// secret take precedence over the standard HTTP_PROXY, HTTPS_PROXY and NO_PROXY variables.
+func ConfigureProxy(transport *http.Transport, params StorageClientParameters) {
+	proxyConfig := httpproxy.FromEnvironment()
+	if params.HTTPProxy != "" {
+		proxyConfig.HTTPProxy = params.HTTPProxy
+		proxyConfig.HTTPSProxy = params.HTTPProxy
+	}
+	if params.NoProxy != "" {
+		proxyConfig.NoProxy = params.NoProxy
+	}
+
+	proxyFunc := proxyConfig.ProxyFunc()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		return proxyFunc(req.URL)
+	}
+}
+
 func ConfigureTLSTransport(certData []byte) *http.Transport {
 	tlsSettings := &tls.Config{
 		MinVersion: tls.VersionTLS12,
@@ -1,6 +1,13 @@
 package util_test
 
 import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/scality/cosi-driver/pkg/util"
@@ -20,6 +27,86 @@ var _ = Describe("StorageClientUtilities", func() {
 			Expect(params.Endpoint).To(BeEmpty())
 			Expect(params.IAMEndpoint).To(BeEmpty())
 			Expect(params.TLSCert).To(BeNil())
+			Expect(params.RequestTimeout).To(Equal(util.DefaultRequestTimeout))
+			Expect(params.RetryMode).To(Equal(aws.RetryModeStandard))
+		})
+	})
+
+	Context("ResolvedAddressingStyle", func() {
+		DescribeTable("should resolve the addressing style of the endpoint",
+			func(style, endpoint, expected string) {
+				params := util.StorageClientParameters{AddressingStyle: style, Endpoint: endpoint}
+				Expect(params.ResolvedAddressingStyle()).To(Equal(expected))
+			},
+			Entry("default", "", "https://s3.ring.internal", util.AddressingStylePath),
+			Entry("path", util.AddressingStylePath, "https://s3.ring.internal", util.AddressingStylePath),
+			Entry("virtual", util.AddressingStyleVirtual, "http://10.0.0.1:8000", util.AddressingStyleVirtual),
+			Entry("auto with a DNS name", util.AddressingStyleAuto, "https://s3.ring.internal", util.AddressingStyleVirtual),
+			Entry("auto with an IP address", util.AddressingStyleAuto, "http://10.0.0.1:8000", util.AddressingStylePath),
+			Entry("auto with localhost", util.AddressingStyleAuto, "http://localhost:8000", util.AddressingStylePath),
+		)
+	})
+
+	Context("SetRetryOptions", func() {
+		var params *util.StorageClientParameters
+
+		BeforeEach(func() {
+			params = util.NewStorageClientParameters()
+		})
+
+		It("should parse all retry settings", func() {
+			err := params.SetRetryOptions(map[string]string{
+				"requestTimeout": "1m",
+				"maxAttempts":    "5",
+				"maxBackoff":     "30s",
+				"retryMode":      "adaptive",
+			})
+			Expect(err).To(BeNil())
+			Expect(params.RequestTimeout).To(Equal(time.Minute))
+			Expect(params.MaxAttempts).To(Equal(5))
+			Expect(params.MaxBackoff).To(Equal(30 * time.Second))
+			Expect(params.RetryMode).To(Equal(aws.RetryModeAdaptive))
+		})
+
+		It("should keep current values for absent settings", func() {
+			params.MaxAttempts = 7
+			err := params.SetRetryOptions(map[string]string{"requestTimeout": "20s"})
+			Expect(err).To(BeNil())
+			Expect(params.RequestTimeout).To(Equal(20 * time.Second))
+			Expect(params.MaxAttempts).To(Equal(7))
+		})
+
+		DescribeTable("should reject invalid settings",
+			func(key, value string) {
+				err := params.SetRetryOptions(map[string]string{key: value})
+				Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+				Expect(err.Error()).To(ContainSubstring(key))
+			},
+			Entry("non-duration timeout", "requestTimeout", "fast"),
+			Entry("negative timeout", "requestTimeout", "-1s"),
+			Entry("zero attempts", "maxAttempts", "0"),
+			Entry("non-integer attempts", "maxAttempts", "three"),
+			Entry("non-duration backoff", "maxBackoff", "5"),
+			Entry("unknown mode", "retryMode", "aggressive"),
+		)
+	})
+
+	Context("NewRetryer", func() {
+		It("should build a standard retryer with the configured limits", func() {
+			retryer := util.NewRetryer(util.StorageClientParameters{MaxAttempts: 6, MaxBackoff: time.Second})()
+			Expect(retryer).To(BeAssignableToTypeOf(&retry.Standard{}))
+			Expect(retryer.MaxAttempts()).To(Equal(6))
+		})
+
+		It("should keep the SDK defaults when no limits are configured", func() {
+			retryer := util.NewRetryer(util.StorageClientParameters{})()
+			Expect(retryer.MaxAttempts()).To(Equal(retry.DefaultMaxAttempts))
+		})
+
+		It("should build an adaptive retryer in adaptive mode", func() {
+			retryer := util.NewRetryer(util.StorageClientParameters{MaxAttempts: 4, RetryMode: aws.RetryModeAdaptive})()
+			Expect(retryer).To(BeAssignableToTypeOf(&retry.AdaptiveMode{}))
+			Expect(retryer.MaxAttempts()).To(Equal(4))
 		})
 	})
 
@@ -79,6 +166,58 @@ var _ = Describe("StorageClientUtilities", func() {
 			Expect(err).To(BeNil())
 		})
 
+		It("should reject an unknown addressing style", func() {
+			params.AccessKeyID = "test-access-key"
+			params.SecretAccessKey = "test-secret-key"
+			params.Endpoint = "https://test-endpoint"
+			params.AddressingStyle = "dns"
+
+			err := params.Validate()
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("addressingStyle"))
+		})
+
+		It("should accept a role to assume instead of static keys", func() {
+			params.Endpoint = "https://test-endpoint"
+			params.RoleARN = "arn:aws:iam::123456789012:role/cosi-driver"
+
+			Expect(params.Validate()).To(Succeed())
+		})
+
+		It("should reject a role to assume combined with static keys", func() {
+			params.AccessKeyID = "test-access-key"
+			params.SecretAccessKey = "test-secret-key"
+			params.Endpoint = "https://test-endpoint"
+			params.RoleARN = "arn:aws:iam::123456789012:role/cosi-driver"
+
+			err := params.Validate()
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("roleArn"))
+		})
+
+		It("should reject IAM endpoint lists mixing schemes", func() {
+			params.AccessKeyID = "test-access-key"
+			params.SecretAccessKey = "test-secret-key"
+			params.Endpoint = "https://test-endpoint"
+			params.IAMEndpoints = []string{"https://iam-a", "http://iam-b"}
+
+			err := params.Validate()
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("same scheme"))
+		})
+
+		It("should require the Vault administration keys with a Vault endpoint", func() {
+			params.AccessKeyID = "test-access-key"
+			params.SecretAccessKey = "test-secret-key"
+			params.Endpoint = "https://test-endpoint"
+			params.VaultEndpoint = "https://vault:8600"
+			params.VaultAccessKeyID = "vault-access-key"
+
+			err := params.Validate()
+			Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+			Expect(err.Error()).To(ContainSubstring("vaultSecretAccessKey"))
+		})
+
 		It("should treat empty strings as missing fields", func() {
 			params.AccessKeyID = ""
 			params.SecretAccessKey = "test-secret-key"
@@ -120,4 +259,75 @@ var _ = Describe("StorageClientUtilities", func() {
 			Expect(transport.TLSClientConfig.RootCAs).NotTo(BeNil())
 		})
 	})
+
+	Describe("NewHTTPClient", func() {
+		It("should configure TLS and the default timeout for HTTPS endpoints", func() {
+			client := util.NewHTTPClient("https://s3.ring.internal", util.StorageClientParameters{})
+
+			Expect(client.Timeout).To(Equal(util.DefaultRequestTimeout))
+			transport, ok := client.Transport.(*http.Transport)
+			Expect(ok).To(BeTrue())
+			Expect(transport.TLSClientConfig.InsecureSkipVerify).To(BeTrue())
+			Expect(transport.Proxy).NotTo(BeNil())
+		})
+
+		It("should use the configured request timeout", func() {
+			client := util.NewHTTPClient("http://s3.ring.internal", util.StorageClientParameters{RequestTimeout: time.Minute})
+			Expect(client.Timeout).To(Equal(time.Minute))
+		})
+
+		It("should configure a proxy for HTTP endpoints", func() {
+			client := util.NewHTTPClient("http://s3.ring.internal", util.StorageClientParameters{HTTPProxy: "http://proxy.internal:3128"})
+
+			transport, ok := client.Transport.(*http.Transport)
+			Expect(ok).To(BeTrue())
+			req, _ := http.NewRequest(http.MethodGet, "http://s3.ring.internal/bucket", nil)
+			proxyURL, err := transport.Proxy(req)
+			Expect(err).To(BeNil())
+			Expect(proxyURL.String()).To(Equal("http://proxy.internal:3128"))
+		})
+	})
+
+	Describe("ConfigureProxy", func() {
+		var transport *http.Transport
+
+		BeforeEach(func() {
+			transport = &http.Transport{}
+		})
+
+		It("should use the secret proxy for HTTPS requests", func() {
+			util.ConfigureProxy(transport, util.StorageClientParameters{HTTPProxy: "http://proxy.internal:3128"})
+
+			req, _ := http.NewRequest(http.MethodGet, "https://s3.ring.internal/bucket", nil)
+			proxyURL, err := transport.Proxy(req)
+			Expect(err).To(BeNil())
+			Expect(proxyURL.Host).To(Equal("proxy.internal:3128"))
+		})
+
+		It("should bypass the proxy for hosts in noProxy", func() {
+			util.ConfigureProxy(transport, util.StorageClientParameters{
+				HTTPProxy: "http://proxy.internal:3128",
+				NoProxy:   "s3.ring.internal",
+			})
+
+			req, _ := http.NewRequest(http.MethodGet, "https://s3.ring.internal/bucket", nil)
+			proxyURL, err := transport.Proxy(req)
+			Expect(err).To(BeNil())
+			Expect(proxyURL).To(BeNil())
+		})
+
+		It("should fall back to the proxy environment variables", func() {
+			DeferCleanup(os.Setenv, "HTTPS_PROXY", os.Getenv("HTTPS_PROXY"))
+			DeferCleanup(os.Setenv, "NO_PROXY", os.Getenv("NO_PROXY"))
+			Expect(os.Setenv("HTTPS_PROXY", "http://env-proxy.internal:8080")).To(Succeed())
+			Expect(os.Setenv("NO_PROXY", "")).To(Succeed())
+
+			util.ConfigureProxy(transport, util.StorageClientParameters{})
+
+			req, _ := http.NewRequest(http.MethodGet, "https://s3.ring.internal/bucket", nil)
+			proxyURL, err := transport.Proxy(req)
+			Expect(err).To(BeNil())
+			Expect(proxyURL.Host).To(Equal("env-proxy.internal:8080"))
+		})
+	})
 })